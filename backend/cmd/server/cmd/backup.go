@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOut  string
+	backupGzip bool
+	restoreIn  string
+
+	backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Write a consistent snapshot of the SQLite database",
+		Long: "Write a consistent snapshot of the SQLite database while the server keeps running.\n" +
+			"The snapshot is integrity-checked before --out is written.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runBackup,
+	}
+	restoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Replace the SQLite database with a backup",
+		Long: "Replace the SQLite database with a backup made by `sede backup`, plain or gzipped.\n" +
+			"Stop the server first. The current database is kept as <database>.pre-restore-<UTC time>.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runRestore,
+	}
+)
+
+func init() {
+	backupCmd.Flags().StringVar(&backupOut, "out", "", "Backup file to write")
+	backupCmd.Flags().BoolVar(&backupGzip, "gzip", false, "Compress the backup (implied by a .gz --out)")
+	backupCmd.MarkFlagRequired("out")
+	restoreCmd.Flags().StringVar(&restoreIn, "in", "", "Backup file to restore")
+	restoreCmd.MarkFlagRequired("in")
+
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	repo, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	compress := backupGzip || strings.HasSuffix(backupOut, ".gz")
+	if err := repo.Backup(cmd.Context(), backupOut, compress); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "backup written to %s\n", backupOut)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	c, err := maintenanceConfig()
+	if err != nil {
+		return err
+	}
+	driver, path, err := c.Database()
+	if err != nil {
+		return err
+	}
+	if driver != config.DriverSQLite {
+		return database.ErrBackupUnsupported
+	}
+	kept, err := database.Restore(cmd.Context(), restoreIn, path)
+	if err != nil {
+		return err
+	}
+	if kept != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "previous database kept as %s\n", kept)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "restored %s from %s; the schema is migrated on the next start\n", path, restoreIn)
+	return nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	deviceSpace   string
+	deviceName    string
+	deviceActions []string
+
+	devicesCmd = &cobra.Command{
+		Use:   "devices",
+		Short: "Manage the devices (buttons, kiosks, bots) allowed to call a space",
+		Long: "Manage the devices allowed to call a space's API, each with its own key.\n" +
+			"Devices send POST /s/{slug}/heartbeat and are reported offline when they stop.",
+	}
+	devicesAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Register a device and print its key",
+		Long: "Register a device and print its key. The key is shown only once: configure it\n" +
+			"on the device as X-API-KEY. Without --action the device can only send heartbeats.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runDevicesAdd,
+	}
+	devicesListCmd = &cobra.Command{
+		Use:          "list",
+		Short:        "List devices and their last heartbeat",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runDevicesList,
+	}
+	devicesRevokeCmd = &cobra.Command{
+		Use:          "revoke <device-id>",
+		Short:        "Revoke a device's key; other devices keep working",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runDevicesRevoke,
+	}
+)
+
+func init() {
+	devicesAddCmd.Flags().StringVar(&deviceSpace, "space", "", "Slug of the space the device belongs to")
+	devicesAddCmd.Flags().StringVar(&deviceName, "name", "", "Display name of the device")
+	devicesAddCmd.Flags().StringSliceVar(&deviceActions, "action", nil, "Allowed action: toggle or sensors; repeatable")
+	devicesAddCmd.MarkFlagRequired("space")
+	devicesAddCmd.MarkFlagRequired("name")
+
+	devicesCmd.AddCommand(devicesAddCmd, devicesListCmd, devicesRevokeCmd)
+	rootCmd.AddCommand(devicesCmd)
+}
+
+func runDevicesAdd(cmd *cobra.Command, args []string) error {
+	actions, err := database.NormalizeDeviceActions(deviceActions)
+	if err != nil {
+		return err
+	}
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	sp, err := repo.GetSpaceBySlug(ctx, deviceSpace)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("space %q not found", deviceSpace)
+	}
+	if err != nil {
+		return err
+	}
+	key, err := database.NewDeviceKey()
+	if err != nil {
+		return err
+	}
+	d := database.Device{SpaceID: sp.ID, Name: deviceName, KeyHash: database.DeviceKeyHash(key), Actions: actions}
+	if err := repo.CreateDevice(ctx, &d); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "added device %d (%s) to %s\nkey: %s\n", d.ID, d.Name, sp.Slug, key)
+	return nil
+}
+
+func runDevicesList(cmd *cobra.Command, args []string) error {
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	devices, err := repo.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	spaces, err := repo.ListSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	slugs := make(map[uint]string, len(spaces))
+	for _, sp := range spaces {
+		slugs[sp.ID] = sp.Slug
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSPACE\tNAME\tSTATUS\tACTIONS\tLAST HEARTBEAT")
+	for _, d := range devices {
+		space, ok := slugs[d.SpaceID]
+		if !ok {
+			space = "#" + strconv.FormatUint(uint64(d.SpaceID), 10)
+		}
+		actions := d.Actions
+		if actions == "" {
+			actions = "-"
+		}
+		seen := "never"
+		if d.LastHeartbeatAt != nil {
+			seen = d.LastHeartbeatAt.Local().Format(time.DateTime)
+			if d.Offline {
+				seen += " (offline)"
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", d.ID, space, d.Name, activeLabel(d.Active), actions, seen)
+	}
+	return w.Flush()
+}
+
+func runDevicesRevoke(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid device ID %q", args[0])
+	}
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	if err := repo.RevokeDevice(cmd.Context(), uint(id)); errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("device %d not found", id)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "revoked device %d\n", id)
+	return nil
+}
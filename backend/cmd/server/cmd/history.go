@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/history"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	exportSpace  string
+	exportFormat string
+	exportOut    string
+
+	importIn     string
+	importFormat string
+	importSpace  string
+	importMap    map[string]string
+
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export status history as CSV or JSON Lines",
+		Long: "Export status history as CSV or JSON Lines, in the format read by `sede import`.\n" +
+			"The database is migrated to the current schema first.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runExport,
+	}
+	importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Import status history exported by another instance",
+		Long: "Import status history written by `sede export` or GET /s/{slug}/history.csv.\n" +
+			"Records whose timestamp already exists for the space are skipped, so an import\n" +
+			"can be repeated. Target spaces must already exist.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runImport,
+	}
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&exportSpace, "space", "", "Slug of the space to export (default: all spaces)")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "csv or jsonl (default: from --out extension, else csv)")
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "Output file (default: stdout)")
+
+	importCmd.Flags().StringVar(&importIn, "in", "", "File to import")
+	importCmd.Flags().StringVar(&importFormat, "format", "", "csv or jsonl (default: from --in extension, else csv)")
+	importCmd.Flags().StringVar(&importSpace, "space", "", "Import every record into this space, whatever its slug")
+	importCmd.Flags().StringToStringVar(&importMap, "map", nil, "Rename spaces while importing, e.g. --map pescara=chieti")
+	importCmd.MarkFlagRequired("in")
+
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	format, err := history.FormatFor(exportFormat, exportOut)
+	if err != nil {
+		return err
+	}
+	c, err := maintenanceConfig()
+	if err != nil {
+		return err
+	}
+	repo, err := database.New(c)
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	var spaces []database.Space
+	if exportSpace != "" {
+		sp, err := repo.GetSpaceBySlug(ctx, exportSpace)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("space %q not found", exportSpace)
+		}
+		if err != nil {
+			return err
+		}
+		spaces = append(spaces, *sp)
+	} else if spaces, err = repo.ListSpaces(ctx); err != nil {
+		return err
+	}
+
+	var out io.Writer = cmd.OutOrStdout()
+	var file *os.File
+	if exportOut != "" {
+		if file, err = os.Create(exportOut); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w, err := history.NewWriter(out, format)
+	if err != nil {
+		return err
+	}
+	for i := range spaces {
+		sp := &spaces[i]
+		err := repo.EachStatus(ctx, sp.ID, func(s database.SedeStatus) error {
+			return w.Write(history.Record{
+				Space:     sp.Slug,
+				Timestamp: s.Timestamp,
+				Open:      s.IsOpen,
+				Reason:    s.Reason,
+				Actor:     s.ActorName,
+				Source:    s.Source,
+				ClientIP:  s.ClientIP,
+				CardHash:  s.CardHash,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("export %s: %w", sp.Slug, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	format, err := history.FormatFor(importFormat, importIn)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(importIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := history.NewReader(f, format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", importIn, err)
+	}
+
+	// Read and group everything first, so a bad record or unknown space
+	// fails the import before anything is written.
+	bySlug := map[string][]database.SedeStatus{}
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", importIn, err)
+		}
+		slug := rec.Space
+		if importSpace != "" {
+			slug = importSpace
+		} else if to, ok := importMap[slug]; ok {
+			slug = to
+		}
+		if slug == "" {
+			return fmt.Errorf("%s: record at %s has no space; use --space", importIn, rec.Timestamp)
+		}
+		bySlug[slug] = append(bySlug[slug], database.SedeStatus{
+			IsOpen:    rec.Open,
+			Reason:    rec.Reason,
+			ActorName: rec.Actor,
+			Source:    rec.Source,
+			ClientIP:  rec.ClientIP,
+			CardHash:  rec.CardHash,
+			Timestamp: rec.Timestamp,
+		})
+	}
+
+	c, err := maintenanceConfig()
+	if err != nil {
+		return err
+	}
+	repo, err := database.New(c)
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	slugs := make([]string, 0, len(bySlug))
+	ids := map[string]uint{}
+	for slug := range bySlug {
+		sp, err := repo.GetSpaceBySlug(ctx, slug)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("space %q not found; create it or use --map/--space", slug)
+		}
+		if err != nil {
+			return err
+		}
+		slugs = append(slugs, slug)
+		ids[slug] = sp.ID
+	}
+	sort.Strings(slugs)
+
+	for _, slug := range slugs {
+		statuses := bySlug[slug]
+		n, err := repo.ImportStatuses(ctx, ids[slug], statuses)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", slug, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: imported %d, skipped %d duplicates\n", slug, n, len(statuses)-n)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	memberName   string
+	memberID     uint
+	memberCard   string
+	memberHash   string
+	memberSpaces []string
+	revokeCard   string
+
+	membersCmd = &cobra.Command{
+		Use:   "members",
+		Short: "Manage the local members and RFID cards registry",
+		Long: "Manage the members and cards checked by the \"local\" card resolver, the default\n" +
+			"for spaces without a card_resolver when no manager API token is configured.",
+	}
+	membersAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Register a card, for a new member (--name) or an existing one (--member)",
+		Long: "Register a card, for a new member (--name) or an existing one (--member).\n" +
+			"Without --space the card opens every space. A revoked card can be registered again.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runMembersAdd,
+	}
+	membersListCmd = &cobra.Command{
+		Use:          "list",
+		Short:        "List members and their cards",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runMembersList,
+	}
+	membersRevokeCmd = &cobra.Command{
+		Use:          "revoke [member-id]",
+		Short:        "Revoke a member and all their cards, or a single card with --card",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE:         runMembersRevoke,
+	}
+)
+
+func init() {
+	membersAddCmd.Flags().StringVar(&memberName, "name", "", "Display name of a new member")
+	membersAddCmd.Flags().UintVar(&memberID, "member", 0, "ID of an existing member")
+	membersAddCmd.Flags().StringVar(&memberCard, "card", "", "Card UID, as read by the device (separators are ignored)")
+	membersAddCmd.Flags().StringVar(&memberHash, "hash", "", "Card hash, as sent by the device")
+	membersAddCmd.Flags().StringSliceVar(&memberSpaces, "space", nil, "Slug of a space the card opens; repeatable (default: all spaces)")
+	membersAddCmd.MarkFlagRequired("card")
+	membersAddCmd.MarkFlagRequired("hash")
+	membersAddCmd.MarkFlagsMutuallyExclusive("name", "member")
+	membersAddCmd.MarkFlagsOneRequired("name", "member")
+
+	membersRevokeCmd.Flags().StringVar(&revokeCard, "card", "", "UID of the card to revoke")
+
+	membersCmd.AddCommand(membersAddCmd, membersListCmd, membersRevokeCmd)
+	rootCmd.AddCommand(membersCmd)
+}
+
+func runMembersAdd(cmd *cobra.Command, args []string) error {
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	card := database.NewCard{UID: memberCard, Hash: memberHash}
+	for _, slug := range memberSpaces {
+		sp, err := repo.GetSpaceBySlug(ctx, slug)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("space %q not found", slug)
+		}
+		if err != nil {
+			return err
+		}
+		card.SpaceIDs = append(card.SpaceIDs, sp.ID)
+	}
+
+	if memberName != "" {
+		m, err := repo.CreateMember(ctx, memberName, card)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("card %s is already registered; revoke it first", memberCard)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "added member %d (%s) with card %s\n", m.ID, m.Name, m.Cards[0].UID)
+		return nil
+	}
+
+	c, err := repo.AddCard(ctx, memberID, card)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("member %d not found", memberID)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("card %s is already registered; revoke it first", memberCard)
+	case err != nil:
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "added card %s to member %d\n", c.UID, memberID)
+	return nil
+}
+
+func runMembersList(cmd *cobra.Command, args []string) error {
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	members, err := repo.ListMembers(ctx)
+	if err != nil {
+		return err
+	}
+	spaces, err := repo.ListSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	slugs := make(map[uint]string, len(spaces))
+	for _, sp := range spaces {
+		slugs[sp.ID] = sp.Slug
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCARD\tCARD STATUS\tSPACES")
+	for _, m := range members {
+		if len(m.Cards) == 0 {
+			fmt.Fprintf(w, "%d\t%s\t%s\t-\t-\t-\n", m.ID, m.Name, activeLabel(m.Active))
+		}
+		for _, c := range m.Cards {
+			scope := "all"
+			if len(c.Spaces) > 0 {
+				names := make([]string, 0, len(c.Spaces))
+				for _, s := range c.Spaces {
+					if slug, ok := slugs[s.SpaceID]; ok {
+						names = append(names, slug)
+					} else {
+						names = append(names, "#"+strconv.FormatUint(uint64(s.SpaceID), 10))
+					}
+				}
+				scope = strings.Join(names, ",")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", m.ID, m.Name, activeLabel(m.Active), c.UID, activeLabel(c.Active), scope)
+		}
+	}
+	return w.Flush()
+}
+
+func activeLabel(active bool) string {
+	if active {
+		return "active"
+	}
+	return "revoked"
+}
+
+func runMembersRevoke(cmd *cobra.Command, args []string) error {
+	if (len(args) == 1) == (revokeCard != "") {
+		return fmt.Errorf("give either a member ID or --card")
+	}
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	if revokeCard != "" {
+		if err := repo.RevokeCard(ctx, revokeCard); errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("card %s not found", revokeCard)
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "revoked card %s\n", revokeCard)
+		return nil
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid member ID %q", args[0])
+	}
+	if err := repo.RevokeMember(ctx, uint(id)); errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("member %d not found", id)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "revoked member %d and their cards\n", id)
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateTo    int
+	migrateSteps int
+
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Inspect and apply database schema migrations",
+	}
+	migrateStatusCmd = &cobra.Command{
+		Use:          "status",
+		Short:        "List migrations and whether they are applied",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runMigrateStatus,
+	}
+	migrateUpCmd = &cobra.Command{
+		Use:          "up",
+		Short:        "Apply pending migrations",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runMigrateUp,
+	}
+	migrateDownCmd = &cobra.Command{
+		Use:          "down",
+		Short:        "Revert the most recently applied migrations",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runMigrateDown,
+	}
+)
+
+func init() {
+	migrateUpCmd.Flags().IntVar(&migrateTo, "to", 0, "Stop after this version (default: latest)")
+	migrateDownCmd.Flags().IntVar(&migrateSteps, "steps", 1, "Number of migrations to revert")
+
+	migrateCmd.AddCommand(migrateStatusCmd, migrateUpCmd, migrateDownCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+// maintenanceConfig validates only the database settings, so maintenance
+// commands work without the server's API key or tokens, and sets up
+// logging. Progress is printed to stdout, so logs default to warnings only.
+func maintenanceConfig() (config.Config, error) {
+	c, err := config.DatabaseDefaults(cfg)
+	if err != nil {
+		return c, err
+	}
+	level := c.LogLevel
+	if level == "" {
+		level = "warn"
+	}
+	logger, err := logging.New(os.Stderr, level)
+	if err != nil {
+		return c, err
+	}
+	slog.SetDefault(logger)
+	return c, nil
+}
+
+// openDatabase opens the configured database without migrating it.
+func openDatabase() (*database.Repository, config.Config, error) {
+	c, err := maintenanceConfig()
+	if err != nil {
+		return nil, c, err
+	}
+	repo, err := database.Open(c)
+	return repo, c, err
+}
+
+// migratedDatabase opens the database, bringing the schema up to date, for
+// commands that manage registries (members, devices) in it.
+func migratedDatabase() (*database.Repository, error) {
+	c, err := maintenanceConfig()
+	if err != nil {
+		return nil, err
+	}
+	return database.New(c)
+}
+
+func runMigrateStatus(cmd *cobra.Command, args []string) error {
+	repo, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	status, err := repo.MigrationStatus(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
+
+func runMigrateUp(cmd *cobra.Command, args []string) error {
+	repo, c, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	applied, err := repo.MigrateUp(cmd.Context(), database.MigrateOptions{DefaultSpaceSlug: c.DefaultSpaceSlug}, migrateTo)
+	for _, v := range applied {
+		fmt.Fprintf(cmd.OutOrStdout(), "applied %d\n", v)
+	}
+	if err == nil && len(applied) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "schema is up to date")
+	}
+	return err
+}
+
+func runMigrateDown(cmd *cobra.Command, args []string) error {
+	if migrateSteps < 1 {
+		return fmt.Errorf("--steps must be at least 1")
+	}
+	repo, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	reverted, err := repo.MigrateDown(cmd.Context(), migrateSteps)
+	for _, v := range reverted {
+		fmt.Fprintf(cmd.OutOrStdout(), "reverted %d\n", v)
+	}
+	return err
+}
@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/metro-olografix/sede/internal/app"
 	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/logging"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -37,8 +39,18 @@ func init() {
 	rootCmd.PersistentFlags().Int64Var(&cfg.TelegramChatId, "telegram-chat-id", 0, "Telegram chat ID")
 	rootCmd.PersistentFlags().IntVar(&cfg.TelegramChatThreadId, "telegram-chat-thread-id", 0, "Telegram chat thread ID")
 
+	rootCmd.PersistentFlags().StringVar(&cfg.DatabaseURL, "database-url", "", "Database URL: postgres://... or sqlite://<path> (default: SQLite at database/sede.db)")
 	rootCmd.PersistentFlags().StringVar(&cfg.SpacesConfigPath, "spaces-config-path", "", "Path to the spaces.yaml config file")
 	rootCmd.PersistentFlags().StringVar(&cfg.DefaultSpaceSlug, "default-space-slug", "", "Slug of the space that legacy bare routes resolve to")
+	rootCmd.PersistentFlags().StringVar(&cfg.AdminToken, "admin-token", "", "Bearer token for the /admin API (empty leaves it to admin-scoped API tokens)")
+	rootCmd.PersistentFlags().StringVar(&cfg.MetricsToken, "metrics-token", "", "Bearer token required to scrape /metrics (empty leaves it public)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.BackupInterval, "backup-interval", 0, "Interval between scheduled SQLite backups (0 disables them)")
+	rootCmd.PersistentFlags().StringVar(&cfg.BackupDir, "backup-dir", "", "Directory for scheduled backups (default database/backups)")
+	rootCmd.PersistentFlags().IntVar(&cfg.BackupRetention, "backup-retention", 7, "Number of scheduled backups to keep")
+	rootCmd.PersistentFlags().StringVar(&cfg.LogLevel, "log-level", "", "Minimum log level: debug, info, warn or error (default info, debug with --debug)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.DeviceOfflineAfter, "device-offline-after", 5*time.Minute, "Report a device offline after this long without heartbeats (0 disables it)")
+	rootCmd.PersistentFlags().StringVar(&cfg.ManagerAPIToken, "manager-api-token", "", "Card manager API token for spaces without a card_resolver")
+	rootCmd.PersistentFlags().StringVar(&cfg.PublicURL, "public-url", "", "Externally visible base URL, used for absolute links")
 
 	// Bind flags to viper
 	viper.BindPFlag("port", rootCmd.PersistentFlags().Lookup("port"))
@@ -49,8 +61,20 @@ func init() {
 	viper.BindPFlag("telegram_token", rootCmd.PersistentFlags().Lookup("telegram-token"))
 	viper.BindPFlag("telegram_chat_id", rootCmd.PersistentFlags().Lookup("telegram-chat-id"))
 	viper.BindPFlag("telegram_chat_thread_id", rootCmd.PersistentFlags().Lookup("telegram-chat-thread-id"))
+	viper.BindPFlag("database_url", rootCmd.PersistentFlags().Lookup("database-url"))
 	viper.BindPFlag("spaces_config_path", rootCmd.PersistentFlags().Lookup("spaces-config-path"))
 	viper.BindPFlag("default_space_slug", rootCmd.PersistentFlags().Lookup("default-space-slug"))
+	viper.BindPFlag("admin_token", rootCmd.PersistentFlags().Lookup("admin-token"))
+	viper.BindPFlag("metrics_token", rootCmd.PersistentFlags().Lookup("metrics-token"))
+	viper.BindPFlag("backup_interval", rootCmd.PersistentFlags().Lookup("backup-interval"))
+	viper.BindPFlag("backup_dir", rootCmd.PersistentFlags().Lookup("backup-dir"))
+	viper.BindPFlag("backup_retention", rootCmd.PersistentFlags().Lookup("backup-retention"))
+	viper.BindPFlag("log_level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("public_url", rootCmd.PersistentFlags().Lookup("public-url"))
+	viper.BindPFlag("device_offline_after", rootCmd.PersistentFlags().Lookup("device-offline-after"))
+	viper.BindPFlag("manager_api_token", rootCmd.PersistentFlags().Lookup("manager-api-token"))
+	// Deployments predating the flag set SEDE_MANAGER_API_TOKEN.
+	viper.BindEnv("manager_api_token", "MANAGER_API_TOKEN", "SEDE_MANAGER_API_TOKEN")
 }
 
 func initConfig() {
@@ -66,25 +90,45 @@ func initConfig() {
 	cfg.TelegramToken = viper.GetString("telegram_token")
 	cfg.TelegramChatId = viper.GetInt64("telegram_chat_id")
 	cfg.TelegramChatThreadId = viper.GetInt("telegram_chat_thread_id")
+	cfg.DatabaseURL = viper.GetString("database_url")
 	cfg.SpacesConfigPath = viper.GetString("spaces_config_path")
 	cfg.DefaultSpaceSlug = viper.GetString("default_space_slug")
+	cfg.AdminToken = viper.GetString("admin_token")
+	cfg.MetricsToken = viper.GetString("metrics_token")
+	cfg.BackupInterval = viper.GetDuration("backup_interval")
+	cfg.BackupDir = viper.GetString("backup_dir")
+	cfg.BackupRetention = viper.GetInt("backup_retention")
+	cfg.LogLevel = viper.GetString("log_level")
+	cfg.PublicURL = viper.GetString("public_url")
+	cfg.ManagerAPIToken = viper.GetString("manager_api_token")
+	cfg.DeviceOfflineAfter = viper.GetDuration("device_offline_after")
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalf("Error executing command: %v", err)
+		slog.Error("error executing command", "error", err)
+		os.Exit(1)
 	}
 }
 
 func runServer(cmd *cobra.Command, args []string) {
 	cfg = config.ValidateAndSetDefaults(cfg)
 
+	logger, err := logging.New(os.Stdout, cfg.LogLevel)
+	if err != nil {
+		slog.Error("invalid log configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
 	application, err := app.NewApp(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+		slog.Error("failed to initialize application", "error", err)
+		os.Exit(1)
 	}
 
 	srv := application.CreateServer()
+	application.StartBackground()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -95,13 +139,25 @@ func runServer(cmd *cobra.Command, args []string) {
 	go func() {
 		defer wg.Done()
 		<-quit
-		log.Println("Shutting down server...")
+		slog.Info("shutting down server")
 		application.Shutdown(srv)
 	}()
 
-	log.Printf("Server starting on :%s", cfg.Port)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("SIGHUP received, reloading spaces config")
+			if err := application.ReloadSpaces(); err != nil {
+				slog.Error("spaces config reload failed, keeping previous config", "error", err)
+			}
+		}
+	}()
+
+	slog.Info("server starting", "port", cfg.Port)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server failed: %v", err)
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
 	}
 
 	wg.Wait()
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	tokenName    string
+	tokenScopes  []string
+	tokenSpace   string
+	tokenExpires string
+
+	tokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "Manage scoped API tokens for integrations",
+		Long: "Manage named API tokens, each limited to some scopes (" + strings.Join(database.Scopes, ", ") + ")\n" +
+			"and optionally to one space. Tokens are sent as \"Authorization: Bearer\" or X-API-KEY.",
+	}
+	tokenCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create a token and print it",
+		Long: "Create a token and print it. The token is shown only once: only its hash is\n" +
+			"stored. The admin scope can't be tied to a space.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runTokenCreate,
+	}
+	tokenListCmd = &cobra.Command{
+		Use:          "list",
+		Short:        "List tokens, their scopes and expiry",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runTokenList,
+	}
+	tokenRevokeCmd = &cobra.Command{
+		Use:          "revoke <token-id>",
+		Short:        "Revoke a token",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runTokenRevoke,
+	}
+)
+
+func init() {
+	tokenCreateCmd.Flags().StringVar(&tokenName, "name", "", "Name of the token, e.g. the integration using it")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scope", nil, "Granted scope: "+strings.Join(database.Scopes, ", ")+"; repeatable")
+	tokenCreateCmd.Flags().StringVar(&tokenSpace, "space", "", "Slug of the only space the token works on (default all)")
+	tokenCreateCmd.Flags().StringVar(&tokenExpires, "expires", "90d", "Lifetime (e.g. 30d, 12h), expiry date (YYYY-MM-DD) or \"never\"")
+	tokenCreateCmd.MarkFlagRequired("name")
+	tokenCreateCmd.MarkFlagRequired("scope")
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+// parseExpiry turns --expires into an expiry time after now; nil for "never".
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if s == "never" {
+		return nil, nil
+	}
+	var at time.Time
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expires %q", s)
+		}
+		at = now.AddDate(0, 0, n)
+	} else if d, err := time.ParseDuration(s); err == nil {
+		at = now.Add(d)
+	} else if at, err = time.ParseInLocation(time.DateOnly, s, time.Local); err != nil {
+		return nil, fmt.Errorf("invalid --expires %q", s)
+	}
+	if !at.After(now) {
+		return nil, fmt.Errorf("--expires %q is in the past", s)
+	}
+	at = at.UTC()
+	return &at, nil
+}
+
+func runTokenCreate(cmd *cobra.Command, args []string) error {
+	scopes, err := database.NormalizeScopes(tokenScopes)
+	if err != nil {
+		return err
+	}
+	if tokenSpace != "" && slices.Contains(tokenScopes, database.ScopeAdmin) {
+		return errors.New("the admin scope can't be tied to a space")
+	}
+	expires, err := parseExpiry(tokenExpires, time.Now())
+	if err != nil {
+		return err
+	}
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	tok := database.APIToken{Name: tokenName, Scopes: scopes, ExpiresAt: expires}
+	where := "all spaces"
+	if tokenSpace != "" {
+		sp, err := repo.GetSpaceBySlug(ctx, tokenSpace)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("space %q not found", tokenSpace)
+		}
+		if err != nil {
+			return err
+		}
+		tok.SpaceID = &sp.ID
+		where = sp.Slug
+	}
+	token, err := database.NewAPIToken()
+	if err != nil {
+		return err
+	}
+	tok.TokenHash = database.APITokenHash(token)
+	if err := repo.CreateAPIToken(ctx, &tok); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "created token %d (%s) with %s on %s, expires %s\ntoken: %s\n",
+		tok.ID, tok.Name, tok.Scopes, where, expiryLabel(tok.ExpiresAt), token)
+	return nil
+}
+
+func runTokenList(cmd *cobra.Command, args []string) error {
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	tokens, err := repo.ListAPITokens(ctx)
+	if err != nil {
+		return err
+	}
+	spaces, err := repo.ListSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	slugs := make(map[uint]string, len(spaces))
+	for _, sp := range spaces {
+		slugs[sp.ID] = sp.Slug
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSPACE\tSTATUS\tSCOPES\tEXPIRES")
+	for _, t := range tokens {
+		space := "*"
+		if t.SpaceID != nil {
+			var ok bool
+			if space, ok = slugs[*t.SpaceID]; !ok {
+				space = "#" + strconv.FormatUint(uint64(*t.SpaceID), 10)
+			}
+		}
+		status := activeLabel(t.Active)
+		if t.Active && t.ExpiresAt != nil && !t.ExpiresAt.After(now) {
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, space, status, t.Scopes, expiryLabel(t.ExpiresAt))
+	}
+	return w.Flush()
+}
+
+func expiryLabel(at *time.Time) string {
+	if at == nil {
+		return "never"
+	}
+	return at.Local().Format(time.DateTime)
+}
+
+func runTokenRevoke(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid token ID %q", args[0])
+	}
+	repo, err := migratedDatabase()
+	if err != nil {
+		return err
+	}
+	if err := repo.RevokeAPIToken(cmd.Context(), uint(id)); errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("token %d not found", id)
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "revoked token %d\n", id)
+	return nil
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/cards"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+// Reasons recorded in the access log.
+const (
+	accessCardAccepted = "card_accepted" // the resolver accepted the card
+	accessNoCard       = "no_card"       // no card was presented
+	accessUnknownCard  = "unknown_card"  // the resolver doesn't know the card
+	accessLookupFailed = "lookup_failed" // the resolver couldn't be asked
+	accessAdmin        = "admin"         // forced through the admin API
+)
+
+const (
+	defaultAccessLogLimit = 100
+	maxAccessLogLimit     = 1000
+)
+
+// toggleDecision is the outcome of checking a toggle against the card
+// presented with it and the space's require_card policy.
+type toggleDecision struct {
+	allowed bool
+	reason  string
+	cardUID string
+	name    string
+
+	// status and message answer a denied toggle.
+	status  int
+	message string
+}
+
+func (d toggleDecision) deny(status int, message string) toggleDecision {
+	d.allowed, d.status, d.message = false, status, message
+	return d
+}
+
+// AccessLogEntry is the admin API view of an access decision.
+type AccessLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Open      bool      `json:"open"`
+	Allowed   bool      `json:"allowed"`
+	Reason    string    `json:"reason"`
+	CardHash  string    `json:"card_hash,omitempty"`
+	By        string    `json:"by,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+}
+
+// decideToggle resolves the card presented with a toggle towards open and
+// decides whether the toggle may proceed. Closing is always allowed; a card
+// that can't be resolved just leaves it unnamed. Opening is refused for
+// unknown cards, and for failed lookups unless the resolver's on_error is
+// anonymous. With require_card, opening also needs a card that resolves to
+// a member, whatever on_error says. The error is only for a resolver that
+// can't be built.
+func (a *App) decideToggle(ctx context.Context, sp *database.Space, req ToggleStatusRequest, open bool) (toggleDecision, error) {
+	d := toggleDecision{allowed: true, reason: accessNoCard}
+	required := sp.RequireCard && open
+	if req.CardID == "" || req.Hash == "" {
+		if required {
+			return d.deny(http.StatusForbidden, "Card required"), nil
+		}
+		return d, nil
+	}
+
+	d.cardUID = cards.NormalizeID(req.CardID)
+	l, err := a.cardResolverFor(sp)
+	if err != nil {
+		return d, err
+	}
+	name, err := l.Resolve(ctx, cards.Card{ID: req.CardID, Hash: req.Hash, Space: sp.Slug})
+	switch {
+	case err == nil && (name != "" || !required):
+		d.reason, d.name = accessCardAccepted, name
+	case err == nil, errors.Is(err, cards.ErrUnknownCard):
+		d.reason = accessUnknownCard
+		if open {
+			return d.deny(http.StatusForbidden, "Unknown card"), nil
+		}
+	default:
+		d.reason = accessLookupFailed
+		if open && (required || l.OnError != cards.OnErrorAnonymous) {
+			slog.ErrorContext(ctx, "card lookup failed", "space", sp.Slug, "resolver", l.Type(), "error", err)
+			return d.deny(http.StatusBadGateway, fmt.Sprintf("Failed to contact card %s", l.Type())), nil
+		}
+		slog.WarnContext(ctx, "card lookup failed; toggling without a name", "space", sp.Slug, "resolver", l.Type(), "error", err)
+	}
+	return d, nil
+}
+
+// cardIDHash is the CardHash recorded on status rows and access decisions
+// for a normalised card UID; empty when no card was presented.
+func cardIDHash(uid string) string {
+	if uid == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(uid))
+	return hex.EncodeToString(sum[:])
+}
+
+// recordAccessDecision appends a decision about sp to the access log.
+func (a *App) recordAccessDecision(ctx context.Context, c *gin.Context, sp *database.Space, open bool, d toggleDecision) error {
+	return a.repo.CreateAccessDecision(ctx, &database.AccessDecision{
+		SpaceID:   sp.ID,
+		Timestamp: time.Now().UTC(),
+		Open:      open,
+		Allowed:   d.allowed,
+		Reason:    d.reason,
+		CardHash:  cardIDHash(d.cardUID),
+		ActorName: d.name,
+		ClientIP:  c.ClientIP(),
+	})
+}
+
+// adminAccessLog lists the most recent access decisions of a space,
+// newest first (limit, default 100, max 1000).
+func (a *App) adminAccessLog(c *gin.Context) {
+	limit := defaultAccessLogLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAccessLogLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAccessLogLimit)})
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sp, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	rows, err := a.repo.ListAccessDecisions(ctx, sp.ID, limit)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	out := make([]AccessLogEntry, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, AccessLogEntry{
+			Timestamp: r.Timestamp,
+			Open:      r.Open,
+			Allowed:   r.Allowed,
+			Reason:    r.Reason,
+			CardHash:  r.CardHash,
+			By:        r.ActorName,
+			ClientIP:  r.ClientIP,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func TestToggleStatus_RequireCard(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// PATCH goes through the admin API so the cached space is swapped, as
+	// a spaces.yaml reload would.
+	if w := doAdmin(router, "PATCH", "/admin/spaces/pescara", adminToken, map[string]any{"require_card": true}); w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+	pescara := mustSpace(t, app, "pescara")
+	if _, err := app.repo.CreateMember(ctx, "Mario", database.NewCard{UID: "0102", Hash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, body string
+		want       int
+	}{
+		{"no card", `{}`, http.StatusForbidden},
+		{"unknown card", `{"cardId":"ffff","hash":"h"}`, http.StatusForbidden},
+		{"wrong hash", `{"cardId":"0102","hash":"x"}`, http.StatusForbidden},
+		{"member", `{"cardId":"01-02","hash":"h"}`, http.StatusOK},
+	} {
+		if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, []byte(tc.body)); w.Code != tc.want {
+			t.Errorf("%s: want %d, got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+	status, err := app.repo.GetLatestStatus(ctx, pescara.ID)
+	if err != nil || !status.IsOpen || status.ActorName != "Mario" {
+		t.Fatalf("status %+v, %v", status, err)
+	}
+
+	// Closing needs no card, even an unknown one is fine. Age the opening
+	// past the cooldown first.
+	if err := app.repo.Db.Model(&database.SedeStatus{}).Where("space_id = ?", pescara.ID).
+		Update("timestamp", time.Now().UTC().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, []byte(`{"cardId":"ffff","hash":"h"}`)); w.Code != http.StatusOK {
+		t.Errorf("close with unknown card: %d %s", w.Code, w.Body.String())
+	}
+
+	var log []AccessLogEntry
+	w := doAdmin(router, "GET", "/admin/spaces/pescara/access-log", adminToken, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &log); err != nil {
+		t.Fatalf("access log: %d %s", w.Code, w.Body.String())
+	}
+	want := []struct {
+		open, allowed bool
+		reason        string
+	}{
+		{false, true, accessUnknownCard},
+		{true, true, accessCardAccepted},
+		{true, false, accessUnknownCard},
+		{true, false, accessUnknownCard},
+		{true, false, accessNoCard},
+	}
+	if len(log) != len(want) {
+		t.Fatalf("access log: %+v", log)
+	}
+	for i, e := range want {
+		if log[i].Open != e.open || log[i].Allowed != e.allowed || log[i].Reason != e.reason {
+			t.Errorf("entry %d: %+v, want %+v", i, log[i], e)
+		}
+	}
+	if log[1].CardHash != cardIDHash("0102") || log[1].By != "Mario" {
+		t.Errorf("accepted entry: %+v", log[1])
+	}
+
+	// The unprotected space keeps accepting toggles without a card.
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, []byte(`{}`)); w.Code != http.StatusOK {
+		t.Errorf("aquila: %d", w.Code)
+	}
+}
+
+func TestToggleStatus_RequireCardIgnoresAnonymousFallback(t *testing.T) {
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer manager.Close()
+
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	pescara := mustSpace(t, app, "pescara")
+	def, _ := json.Marshal(map[string]any{
+		"type":     "manager",
+		"settings": map[string]string{"url": manager.URL, "token": "t", "on_error": "anonymous"},
+	})
+	pescara.CardResolver, pescara.RequireCard = string(def), true
+
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, []byte(`{"cardId":"0102","hash":"h"}`)); w.Code != http.StatusBadGateway {
+		t.Errorf("open while the manager is down: want 502, got %d", w.Code)
+	}
+}
+
+func TestNewApp_RequireCardNeedsResolver(t *testing.T) {
+	dir := t.TempDir()
+	cfg := baseCfg(t, dir)
+	cfg.DatabasePath = filepath.Join(dir, "test.db")
+	cfg.SpacesConfigPath = writeYAML(t, dir, `spaces:
+  - slug: pescara
+    name: Pescara
+    lat: 42.45
+    lon: 14.22
+    api_key: pescara-key-1234567890
+    require_card: true
+    card_resolver: {type: none}
+`)
+	if _, err := NewApp(cfg); err == nil {
+		t.Fatal("expected boot failure: require_card with the none resolver")
+	}
+}
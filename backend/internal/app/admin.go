@@ -0,0 +1,573 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/spaceapi"
+	"gorm.io/gorm"
+)
+
+// apiKeyBytes is the entropy of generated per-space API keys; base64url
+// encoding yields a 43-character key, well above the 16-character minimum.
+const apiKeyBytes = 32
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// recentToggles is how many status changes the admin overview lists.
+const recentToggles = 50
+
+// reasonAdmin tags the status changes forced through the admin API.
+const reasonAdmin = "admin"
+
+// AdminSpace is the admin API view of a space. The API key hash is never
+// exposed; a plaintext key is only returned by create and rotate-key.
+type AdminSpace struct {
+	ID             uint           `json:"id"`
+	Slug           string         `json:"slug"`
+	Name           string         `json:"name"`
+	Address        string         `json:"address"`
+	Lat            float64        `json:"lat"`
+	Lon            float64        `json:"lon"`
+	Timezone       string         `json:"timezone"`
+	LogoURL        string         `json:"logo_url"`
+	URL            string         `json:"url"`
+	ContactEmail   string         `json:"contact_email"`
+	Message        string         `json:"message"`
+	TelegramChatID int64          `json:"telegram_chat_id"`
+	TelegramThread int            `json:"telegram_thread"`
+	Projects       []string       `json:"projects"`
+	Links          []SpaceAPILink `json:"links"`
+	RequireCard    bool           `json:"require_card"`
+	HideNames      bool           `json:"hide_names"`
+	Default        bool           `json:"default"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	APIKey         string         `json:"api_key,omitempty"`
+}
+
+// AdminSpaceRequest is the body of POST and PATCH /admin/spaces. Every field
+// is optional on PATCH; nil means "leave unchanged". On POST, slug and name
+// are required and an API key is generated when none is supplied.
+type AdminSpaceRequest struct {
+	Slug           *string         `json:"slug"`
+	Name           *string         `json:"name"`
+	Address        *string         `json:"address"`
+	Lat            *float64        `json:"lat"`
+	Lon            *float64        `json:"lon"`
+	Timezone       *string         `json:"timezone"`
+	LogoURL        *string         `json:"logo_url"`
+	URL            *string         `json:"url"`
+	ContactEmail   *string         `json:"contact_email"`
+	Message        *string         `json:"message"`
+	TelegramChatID *int64          `json:"telegram_chat_id"`
+	TelegramThread *int            `json:"telegram_thread"`
+	Projects       *[]string       `json:"projects"`
+	Links          *[]SpaceAPILink `json:"links"`
+	RequireCard    *bool           `json:"require_card"`
+	HideNames      *bool           `json:"hide_names"`
+	APIKey         *string         `json:"api_key"`
+}
+
+// AdminOverview is what the admin dashboard polls: the live status of every
+// served space and the latest status changes across all of them.
+type AdminOverview struct {
+	Spaces []AdminSpaceStatus `json:"spaces"`
+	Recent []AdminStatusEvent `json:"recent"`
+}
+
+// AdminStatusEvent is a status change with the attribution kept off the
+// public endpoints: the hash of the card presented and the client address.
+// Names are shown even for spaces with hide_names.
+type AdminStatusEvent struct {
+	StatusEvent
+	CardHash string `json:"card_hash,omitempty"`
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+func newAdminStatusEvent(sp *database.Space, s database.SedeStatus) AdminStatusEvent {
+	return AdminStatusEvent{StatusEvent: newStatusEvent(sp, s), CardHash: s.CardHash, ClientIP: s.ClientIP}
+}
+
+// AdminSpaceStatus is one space of the overview. LastChange is nil for a
+// space that was never toggled; Devices lists its active devices.
+type AdminSpaceStatus struct {
+	Slug       string            `json:"slug"`
+	Name       string            `json:"name"`
+	Default    bool              `json:"default"`
+	Open       bool              `json:"open"`
+	LastChange *AdminStatusEvent `json:"last_change"`
+	Devices    []AdminDevice     `json:"devices"`
+}
+
+// AdminStatusRequest is the body of POST /admin/spaces/:slug/status.
+type AdminStatusRequest struct {
+	Open *bool `json:"open"`
+}
+
+// bearerAuthMiddleware checks "Authorization: Bearer <token>" for realm
+// (/metrics). Both sides are hashed first so the
+// comparison is constant-time regardless of the presented token's length.
+// An empty token leaves the route open.
+func (a *App) bearerAuthMiddleware(realm, token string) gin.HandlerFunc {
+	if token == "" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		presented, ok := bearerToken(c)
+		if !ok {
+			a.rejectAuth(c, realm)
+			return
+		}
+		got := sha256.Sum256([]byte(presented))
+		if subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			logSecurityEvent(c, c.Param("slug"), "invalid "+realm+" token attempt")
+			a.rejectAuth(c, realm)
+			return
+		}
+		c.Next()
+	}
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	h := c.GetHeader("Authorization")
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+func (a *App) adminListSpaces(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	spaces, err := a.repo.ListSpaces(ctx)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	out := make([]AdminSpace, 0, len(spaces))
+	for i := range spaces {
+		out = append(out, a.adminView(&spaces[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (a *App) adminGetSpace(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sp, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, a.adminView(sp))
+}
+
+func (a *App) adminCreateSpace(c *gin.Context) {
+	a.spacesWriteMu.Lock()
+	defer a.spacesWriteMu.Unlock()
+
+	var req AdminSpaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if req.Slug == nil || !slugPattern.MatchString(*req.Slug) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "slug must match " + slugPattern.String()})
+		return
+	}
+
+	apiKey := ""
+	generated := false
+	if req.APIKey != nil {
+		apiKey = *req.APIKey
+	} else {
+		k, err := generateAPIKey()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+			return
+		}
+		apiKey, generated = k, true
+	}
+
+	sp := database.Space{Slug: *req.Slug}
+	if err := applySpaceRequest(&sp, req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAdminSpace(sp, apiKey); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := database.HashAPIKey(apiKey)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash API key"})
+		return
+	}
+	sp.APIKeyHash = hash
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	created, err := a.repo.CreateSpace(ctx, sp)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "space already exists"})
+		return
+	}
+	if handleDatabaseError(c, err) {
+		return
+	}
+	a.spaces.Store(created)
+
+	view := a.adminView(created)
+	if generated {
+		view.APIKey = apiKey
+	}
+	c.JSON(http.StatusCreated, view)
+}
+
+func (a *App) adminUpdateSpace(c *gin.Context) {
+	a.spacesWriteMu.Lock()
+	defer a.spacesWriteMu.Unlock()
+
+	var req AdminSpaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if req.Slug != nil && *req.Slug != c.Param("slug") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "slug cannot be changed"})
+		return
+	}
+	if req.APIKey != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "use rotate-key to change the API key"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	existing, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	sp := *existing
+	if err := applySpaceRequest(&sp, req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAdminSpace(sp, ""); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := a.repo.UpsertSpace(ctx, sp)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	a.spaces.Store(updated)
+	c.JSON(http.StatusOK, a.adminView(updated))
+}
+
+func (a *App) adminDeleteSpace(c *gin.Context) {
+	a.spacesWriteMu.Lock()
+	defer a.spacesWriteMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sp, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	if ds := a.spaces.Default(); ds != nil && ds.ID == sp.ID {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "cannot delete the default space"})
+		return
+	}
+
+	err := a.repo.DeleteSpace(ctx, sp.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "space not found"})
+		return
+	}
+	if handleDatabaseError(c, err) {
+		return
+	}
+	a.spaces.Invalidate(sp.Slug)
+	c.Status(http.StatusNoContent)
+}
+
+// adminRotateKey replaces the space's API key with a freshly generated one.
+// The old key stops working as soon as the response is sent.
+func (a *App) adminRotateKey(c *gin.Context) {
+	a.spacesWriteMu.Lock()
+	defer a.spacesWriteMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sp, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	hash, err := database.HashAPIKey(apiKey)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash API key"})
+		return
+	}
+
+	updated, err := a.repo.UpdateSpaceAPIKeyHash(ctx, sp.ID, hash)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	a.spaces.Store(updated)
+	logSecurityEvent(c, sp.Slug, "API key rotated via admin API")
+
+	view := a.adminView(updated)
+	view.APIKey = apiKey
+	c.JSON(http.StatusOK, view)
+}
+
+func (a *App) adminOverview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	devices, err := a.repo.ListDevices(ctx)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	devicesOf := make(map[uint][]AdminDevice)
+	for _, d := range devices {
+		if d.Active {
+			devicesOf[d.SpaceID] = append(devicesOf[d.SpaceID], newAdminDevice(d))
+		}
+	}
+
+	spaces := a.spaces.All()
+	byID := make(map[uint]*database.Space, len(spaces))
+	out := AdminOverview{Spaces: make([]AdminSpaceStatus, 0, len(spaces)), Recent: []AdminStatusEvent{}}
+	for _, sp := range spaces {
+		byID[sp.ID] = sp
+		st := AdminSpaceStatus{Slug: sp.Slug, Name: sp.Name, Devices: devicesOf[sp.ID]}
+		if st.Devices == nil {
+			st.Devices = []AdminDevice{}
+		}
+		if ds := a.spaces.Default(); ds != nil && ds.ID == sp.ID {
+			st.Default = true
+		}
+		latest, err := a.repo.GetLatestStatus(ctx, sp.ID)
+		switch {
+		case err == nil:
+			ev := newAdminStatusEvent(sp, latest)
+			st.Open, st.LastChange = latest.IsOpen, &ev
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			handleDatabaseError(c, err)
+			return
+		}
+		out.Spaces = append(out.Spaces, st)
+	}
+
+	recent, err := a.repo.RecentStatuses(ctx, recentToggles)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	for _, s := range recent {
+		// Rows of spaces no longer served have nothing to link to.
+		if sp, ok := byID[s.SpaceID]; ok {
+			out.Recent = append(out.Recent, newAdminStatusEvent(sp, s))
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// adminSetStatus forces a space open or closed, bypassing the toggle
+// cooldown. The change is announced like any other, with Reason "admin";
+// asking for the state the space is already in records nothing.
+func (a *App) adminSetStatus(c *gin.Context) {
+	var req AdminStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Open == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "open is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sp, ok := a.adminLoadSpace(ctx, c)
+	if !ok {
+		return
+	}
+	latest, err := a.repo.GetLatestStatus(ctx, sp.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		handleDatabaseError(c, err)
+		return
+	}
+	if err == nil && latest.IsOpen == *req.Open {
+		c.JSON(http.StatusOK, newAdminStatusEvent(sp, latest))
+		return
+	}
+
+	status := database.SedeStatus{
+		SpaceID:   sp.ID,
+		IsOpen:    *req.Open,
+		Reason:    reasonAdmin,
+		Source:    database.SourceAdmin,
+		ClientIP:  c.ClientIP(),
+		Timestamp: time.Now().UTC(),
+	}
+	if err := a.recordAccessDecision(ctx, c, sp, status.IsOpen, toggleDecision{allowed: true, reason: accessAdmin}); err != nil {
+		handleDatabaseError(c, err)
+		return
+	}
+	if err := a.recordStatusChange(ctx, sp, &status); err != nil {
+		handleDatabaseError(c, err)
+		return
+	}
+	logSecurityEvent(c, sp.Slug, "status overridden via admin API")
+	c.JSON(http.StatusOK, newAdminStatusEvent(sp, status))
+}
+
+// adminLoadSpace reads :slug straight from the DB, so admin reads always
+// reflect persisted state rather than the request-path cache.
+func (a *App) adminLoadSpace(ctx context.Context, c *gin.Context) (*database.Space, bool) {
+	sp, err := a.repo.GetSpaceBySlug(ctx, c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "space not found"})
+		return nil, false
+	}
+	if handleDatabaseError(c, err) {
+		return nil, false
+	}
+	return sp, true
+}
+
+func (a *App) adminView(sp *database.Space) AdminSpace {
+	v := AdminSpace{
+		ID:             sp.ID,
+		Slug:           sp.Slug,
+		Name:           sp.Name,
+		Address:        sp.Address,
+		Lat:            sp.Lat,
+		Lon:            sp.Lon,
+		Timezone:       sp.Timezone,
+		LogoURL:        sp.LogoURL,
+		URL:            sp.URL,
+		ContactEmail:   sp.ContactEmail,
+		Message:        sp.Message,
+		TelegramChatID: sp.TelegramChatID,
+		TelegramThread: sp.TelegramThread,
+		Projects:       []string{},
+		Links:          []SpaceAPILink{},
+		RequireCard:    sp.RequireCard,
+		HideNames:      sp.HideNames,
+		CreatedAt:      sp.CreatedAt,
+		UpdatedAt:      sp.UpdatedAt,
+	}
+	if sp.Projects != "" {
+		_ = json.Unmarshal([]byte(sp.Projects), &v.Projects)
+	}
+	if sp.Links != "" {
+		_ = json.Unmarshal([]byte(sp.Links), &v.Links)
+	}
+	if ds := a.spaces.Default(); ds != nil && ds.ID == sp.ID {
+		v.Default = true
+	}
+	return v
+}
+
+func applySpaceRequest(sp *database.Space, req AdminSpaceRequest) error {
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setString(&sp.Name, req.Name)
+	setString(&sp.Address, req.Address)
+	setString(&sp.Timezone, req.Timezone)
+	setString(&sp.LogoURL, req.LogoURL)
+	setString(&sp.URL, req.URL)
+	setString(&sp.ContactEmail, req.ContactEmail)
+	setString(&sp.Message, req.Message)
+	if req.Lat != nil {
+		sp.Lat = *req.Lat
+	}
+	if req.Lon != nil {
+		sp.Lon = *req.Lon
+	}
+	if req.TelegramChatID != nil {
+		sp.TelegramChatID = *req.TelegramChatID
+	}
+	if req.TelegramThread != nil {
+		sp.TelegramThread = *req.TelegramThread
+	}
+	if req.RequireCard != nil {
+		sp.RequireCard = *req.RequireCard
+	}
+	if req.HideNames != nil {
+		sp.HideNames = *req.HideNames
+	}
+	if req.Projects != nil {
+		raw, err := json.Marshal(*req.Projects)
+		if err != nil {
+			return fmt.Errorf("encode projects: %w", err)
+		}
+		sp.Projects = string(raw)
+	}
+	if req.Links != nil {
+		raw, err := json.Marshal(*req.Links)
+		if err != nil {
+			return fmt.Errorf("encode links: %w", err)
+		}
+		sp.Links = string(raw)
+	}
+	return nil
+}
+
+// validateAdminSpace applies the same rules as spaces.yaml. apiKey is only
+// checked on create; an empty value on update stands for "unchanged".
+func validateAdminSpace(sp database.Space, apiKey string) error {
+	if apiKey == "" {
+		apiKey = "unchanged"
+	} else if len(apiKey) < 16 {
+		return errors.New("api_key must be at least 16 characters")
+	}
+	if err := config.ValidateSpaces([]config.SpaceDef{{
+		Slug:     sp.Slug,
+		Name:     sp.Name,
+		Lat:      sp.Lat,
+		Lon:      sp.Lon,
+		Timezone: sp.Timezone,
+		APIKey:   apiKey,
+	}}); err != nil {
+		return err
+	}
+	return spaceapi.Validate(newSpaceAPIResponse(&sp, nil, nil))
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
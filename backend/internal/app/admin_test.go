@@ -0,0 +1,286 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+const adminToken = "admin-token-1234567890"
+
+func setupAdminRouter(t *testing.T) (*App, *gin.Engine, func()) {
+	t.Helper()
+	app, cleanup := setupTestApp(t)
+	app.config.AdminToken = adminToken
+	return app, app.setupRouter(), cleanup
+}
+
+func doAdmin(router *gin.Engine, method, path, token string, body any) *httptest.ResponseRecorder {
+	var buf *bytes.Buffer
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		buf = bytes.NewBuffer(raw)
+	} else {
+		buf = &bytes.Buffer{}
+	}
+	r, _ := http.NewRequest(method, path, buf)
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdmin_DisabledWithoutToken(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	w := doAdmin(app.setupRouter(), "GET", "/admin/spaces", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("admin API should not be mounted without a token, got %d", w.Code)
+	}
+}
+
+func TestAdmin_RequiresAdminToken(t *testing.T) {
+	_, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	for _, tok := range []string{"", "wrong-token-000000000", pescaraKey} {
+		if w := doAdmin(router, "GET", "/admin/spaces", tok, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: want 401, got %d", tok, w.Code)
+		}
+	}
+	// A space API key in X-API-KEY must not unlock admin either.
+	w := doReq(router, "GET", "/admin/spaces", pescaraKey, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("X-API-KEY on admin: want 401, got %d", w.Code)
+	}
+}
+
+func TestAdmin_ListAndGet(t *testing.T) {
+	_, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	w := doAdmin(router, "GET", "/admin/spaces", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+	var spaces []AdminSpace
+	if err := json.Unmarshal(w.Body.Bytes(), &spaces); err != nil {
+		t.Fatal(err)
+	}
+	if len(spaces) != 2 || spaces[0].Slug != "pescara" || !spaces[0].Default || spaces[1].Default {
+		t.Errorf("list: %+v", spaces)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("api_key")) {
+		t.Error("list must not expose api keys or hashes")
+	}
+
+	w = doAdmin(router, "GET", "/admin/spaces/aquila", adminToken, nil)
+	var aquila AdminSpace
+	_ = json.Unmarshal(w.Body.Bytes(), &aquila)
+	if w.Code != http.StatusOK || aquila.Name != "Metro Olografix L'Aquila" {
+		t.Errorf("get aquila: %d %+v", w.Code, aquila)
+	}
+
+	if w := doAdmin(router, "GET", "/admin/spaces/nope", adminToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("get unknown: %d", w.Code)
+	}
+}
+
+func TestAdmin_CreateServesImmediately(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	w := doAdmin(router, "POST", "/admin/spaces", adminToken, map[string]any{
+		"slug": "chieti", "name": "Metro Olografix Chieti", "lat": 42.35, "lon": 14.16,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var created AdminSpace
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.APIKey == "" || created.ID == 0 {
+		t.Fatalf("expected generated key and id: %+v", created)
+	}
+
+	if w := doReq(router, "GET", "/s/chieti/status", "", nil); w.Code != http.StatusInternalServerError && w.Code != http.StatusOK {
+		t.Errorf("new space not routable: %d", w.Code)
+	}
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/chieti/toggle", created.APIKey, body); w.Code != http.StatusOK {
+		t.Errorf("toggle with generated key: %d %s", w.Code, w.Body.String())
+	}
+
+	// A fresh boot on the same DB keeps serving the space even though it is
+	// not declared in spaces.yaml.
+	restarted, err := NewApp(app.config)
+	if err != nil {
+		t.Fatalf("NewApp on existing DB: %v", err)
+	}
+	defer func() {
+		if sqlDB, err := restarted.repo.Db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+	if _, ok := restarted.spaces.Lookup("chieti"); !ok {
+		t.Error("admin-created space lost after restart")
+	}
+
+	if w := doAdmin(router, "POST", "/admin/spaces", adminToken, map[string]any{"slug": "chieti", "name": "dup"}); w.Code != http.StatusConflict {
+		t.Errorf("duplicate create: want 409, got %d", w.Code)
+	}
+	for _, bad := range []map[string]any{
+		{"slug": "Bad Slug", "name": "x"},
+		{"slug": "ok-slug"},
+		{"slug": "ok-slug", "name": "x", "lat": 123.0},
+		{"slug": "ok-slug", "name": "x", "api_key": "short"},
+	} {
+		if w := doAdmin(router, "POST", "/admin/spaces", adminToken, bad); w.Code != http.StatusBadRequest {
+			t.Errorf("create %v: want 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestAdmin_PatchUpdatesCacheAndDefault(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	w := doAdmin(router, "PATCH", "/admin/spaces/pescara", adminToken, map[string]any{
+		"message": "Aperti il lunedì", "telegram_thread": 99,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+
+	sp, _ := app.spaces.Lookup("pescara")
+	if sp.Message != "Aperti il lunedì" || sp.TelegramThread != 99 || sp.Name != "Metro Olografix Pescara" {
+		t.Errorf("cache not updated or unrelated fields lost: %+v", sp)
+	}
+	if app.spaces.Default() != sp {
+		t.Error("default space pointer not swapped")
+	}
+
+	var resp SpaceAPIResponse
+	_ = json.Unmarshal(doReq(router, "GET", "/spaceapi.json", "", nil).Body.Bytes(), &resp)
+	if resp.State.Message != "Aperti il lunedì" {
+		t.Errorf("legacy route still serves old message: %q", resp.State.Message)
+	}
+
+	if w := doAdmin(router, "PATCH", "/admin/spaces/pescara", adminToken, map[string]any{"slug": "other"}); w.Code != http.StatusBadRequest {
+		t.Errorf("slug change: want 400, got %d", w.Code)
+	}
+	if w := doAdmin(router, "PATCH", "/admin/spaces/pescara", adminToken, map[string]any{"api_key": "new-key-1234567890"}); w.Code != http.StatusBadRequest {
+		t.Errorf("api_key via patch: want 400, got %d", w.Code)
+	}
+}
+
+func TestAdmin_RotateKey(t *testing.T) {
+	_, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	w := doAdmin(router, "POST", "/admin/spaces/aquila/rotate-key", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body.String())
+	}
+	var rotated AdminSpace
+	_ = json.Unmarshal(w.Body.Bytes(), &rotated)
+	if rotated.APIKey == "" || rotated.APIKey == aquilaKey {
+		t.Fatalf("expected a fresh key, got %q", rotated.APIKey)
+	}
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, body); w.Code != http.StatusUnauthorized {
+		t.Errorf("old key should be rejected, got %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", rotated.APIKey, body); w.Code != http.StatusOK {
+		t.Errorf("new key should work, got %d", w.Code)
+	}
+}
+
+func TestAdmin_Delete(t *testing.T) {
+	_, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	if w := doAdmin(router, "DELETE", "/admin/spaces/pescara", adminToken, nil); w.Code != http.StatusConflict {
+		t.Errorf("deleting default space: want 409, got %d", w.Code)
+	}
+	if w := doAdmin(router, "DELETE", "/admin/spaces/aquila", adminToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete aquila: %d %s", w.Code, w.Body.String())
+	}
+	if w := doReq(router, "GET", "/s/aquila/status", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleted space still served: %d", w.Code)
+	}
+	if w := doAdmin(router, "DELETE", "/admin/spaces/aquila", adminToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("second delete: want 404, got %d", w.Code)
+	}
+}
+
+func TestAdmin_OverviewAndStatusOverride(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	createTestStatusFor(t, app, mustSpace(t, app, "pescara").ID, true, time.Now().UTC().Add(-time.Hour))
+
+	// The override bypasses the toggle cooldown and is tagged "admin".
+	w := doAdmin(router, "POST", "/admin/spaces/pescara/status", adminToken, map[string]bool{"open": false})
+	if w.Code != http.StatusOK {
+		t.Fatalf("override: %d %s", w.Code, w.Body.String())
+	}
+	var ev AdminStatusEvent
+	_ = json.Unmarshal(w.Body.Bytes(), &ev)
+	if ev.Open || ev.Reason != reasonAdmin || ev.Source != database.SourceAdmin || ev.Space != "pescara" {
+		t.Errorf("override event: %+v", ev)
+	}
+	// Asking again for the current state records nothing.
+	doAdmin(router, "POST", "/admin/spaces/pescara/status", adminToken, map[string]bool{"open": false})
+	if w := doAdmin(router, "POST", "/admin/spaces/pescara/status", adminToken, map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("missing open: want 400, got %d", w.Code)
+	}
+
+	w = doAdmin(router, "GET", "/admin/overview", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("overview: %d %s", w.Code, w.Body.String())
+	}
+	var ov AdminOverview
+	if err := json.Unmarshal(w.Body.Bytes(), &ov); err != nil {
+		t.Fatal(err)
+	}
+	if len(ov.Spaces) != 2 || ov.Spaces[0].Slug != "aquila" || ov.Spaces[1].Slug != "pescara" {
+		t.Fatalf("overview spaces: %+v", ov.Spaces)
+	}
+	if aquila := ov.Spaces[0]; aquila.Open || aquila.LastChange != nil || aquila.Default {
+		t.Errorf("aquila was never toggled: %+v", aquila)
+	}
+	if pescara := ov.Spaces[1]; pescara.Open || !pescara.Default || pescara.LastChange == nil || pescara.LastChange.Reason != reasonAdmin {
+		t.Errorf("pescara: %+v", pescara)
+	}
+	if len(ov.Recent) != 2 || ov.Recent[0].Reason != reasonAdmin || !ov.Recent[1].Open {
+		t.Errorf("recent: %+v", ov.Recent)
+	}
+
+	if w := doAdmin(router, "GET", "/admin/overview", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("overview without token: want 401, got %d", w.Code)
+	}
+}
+
+func TestUI_ServedFromBinary(t *testing.T) {
+	_, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	for _, path := range []string{"/ui/", "/ui/admin.html", "/s/aquila/ui/"} {
+		w := doReq(router, "GET", path, "", nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+			t.Errorf("%s: %d", path, w.Code)
+		}
+	}
+}
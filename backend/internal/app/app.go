@@ -5,30 +5,48 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/metro-olografix/sede/internal/cards"
 	"github.com/metro-olografix/sede/internal/config"
 	"github.com/metro-olografix/sede/internal/database"
 	"github.com/metro-olografix/sede/internal/notification"
+	"github.com/metro-olografix/sede/internal/spaceapi"
+	"github.com/metro-olografix/sede/internal/webhook"
 	"github.com/ulule/limiter/v3"
 	"github.com/ulule/limiter/v3/drivers/store/memory"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/time/rate"
+	"gorm.io/gorm"
 )
 
 type App struct {
-	repo         *database.Repository
-	config       config.Config
-	validate     *validator.Validate
-	limiter      *rate.Limiter
-	rateLimiter  *limiter.Limiter
-	telegram     *notification.Dispatcher
-	spaces       map[string]*database.Space
-	defaultSpace *database.Space
+	repo        *database.Repository
+	config      config.Config
+	validate    *validator.Validate
+	limiter     *rate.Limiter
+	rateLimiter *limiter.Limiter
+	notifiers   *notification.Registry
+	cards       *cards.Registry
+	events      *eventHub
+	webhooks    *webhook.Worker
+	metrics     *appMetrics
+
+	spaces *SpaceRegistry
+	// spacesWriteMu serialises the admin API and config reloads, which
+	// both write the DB and then the registry, so a reload cannot drop a
+	// concurrent admin change (or vice versa).
+	spacesWriteMu sync.Mutex
+
+	cardLookupsMu sync.Mutex
+	cardLookups   map[string]cardLookup
+
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
 }
 
 const (
@@ -43,7 +61,11 @@ func NewApp(cfg config.Config) (*App, error) {
 		config:   cfg,
 		validate: validator.New(),
 		limiter:  rate.NewLimiter(rate.Every(rateLimitDuration/rateLimitRequests), rateLimitRequests),
-		spaces:   make(map[string]*database.Space),
+		events:   newEventHub(),
+		spaces:   NewSpaceRegistry(),
+		cards:    cards.NewRegistry(&http.Client{}),
+
+		cardLookups: make(map[string]cardLookup),
 	}
 
 	repo, err := database.New(cfg)
@@ -51,6 +73,17 @@ func NewApp(cfg config.Config) (*App, error) {
 		return nil, fmt.Errorf("database initialization failed: %w", err)
 	}
 	app.repo = repo
+	app.webhooks = webhook.NewWorker(repo)
+	app.cards.Register("local", func(cards.Settings) (cards.Resolver, error) {
+		return localResolver{repo: repo, spaces: app.spaces}, nil
+	})
+
+	app.metrics = newAppMetrics(app)
+	if err := repo.ObserveQueries(func(op string, d time.Duration) {
+		app.metrics.dbDuration.WithLabelValues(op).Observe(d.Seconds())
+	}); err != nil {
+		return nil, fmt.Errorf("database instrumentation failed: %w", err)
+	}
 
 	app.rateLimiter = limiter.New(memory.NewStore(), limiter.Rate{
 		Period: rateLimitDuration,
@@ -59,9 +92,9 @@ func NewApp(cfg config.Config) (*App, error) {
 
 	telegram, err := notification.NewDispatcher(cfg.TelegramToken)
 	if err != nil {
-		log.Printf("telegram notification not initialized: %s", err.Error())
+		slog.Warn("telegram notification not initialized", "error", err)
 	}
-	app.telegram = telegram
+	app.notifiers = notification.NewRegistry(telegram)
 
 	if err := app.loadAndSeedSpaces(); err != nil {
 		return nil, fmt.Errorf("space bootstrap failed: %w", err)
@@ -71,90 +104,250 @@ func NewApp(cfg config.Config) (*App, error) {
 }
 
 // loadAndSeedSpaces reads spaces.yaml (or synthesises a single space from the
-// legacy env vars when the file is missing), upserts every entry into the DB
-// with a bcrypt-hashed API key, builds the hot lookup map, and backfills any
-// legacy status rows carrying space_id = 0 onto the default space.
+// legacy env vars when the file is missing), syncs every entry into the DB
+// and builds the hot lookup map (including spaces that only exist in the
+// DB).
 func (a *App) loadAndSeedSpaces() error {
-	slug := a.config.DefaultSpaceSlug
-	if slug == "" {
-		slug = "pescara"
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	spaces, ds, err := a.syncSpaces(ctx)
+	if err != nil {
+		return err
 	}
+	a.spaces.Replace(spaces, ds.Slug)
+	return nil
+}
 
+// loadSpaceDefs reads and validates spaces.yaml, falling back to a single
+// space built from the legacy env vars when the file does not exist.
+func (a *App) loadSpaceDefs() ([]config.SpaceDef, error) {
 	defs, err := config.LoadSpaces(a.config.SpacesConfigPath)
+	if err == nil {
+		return defs, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if a.config.APIKey == "" {
+		return nil, fmt.Errorf("no spaces config at %s and no legacy API_KEY to synthesise a default space", a.config.SpacesConfigPath)
+	}
+	legacy := config.LegacySpaceFromConfig(a.config)
+	if legacy.Slug == "" {
+		legacy.Slug = a.defaultSpaceSlug()
+	}
+	slog.Warn("spaces config not found; synthesising single space from legacy env vars", "path", a.config.SpacesConfigPath, "space", legacy.Slug)
+	return []config.SpaceDef{legacy}, nil
+}
+
+func (a *App) defaultSpaceSlug() string {
+	if a.config.DefaultSpaceSlug == "" {
+		return "pescara"
+	}
+	return a.config.DefaultSpaceSlug
+}
+
+// syncSpaces loads the space definitions, syncs them and returns a fresh
+// lookup map plus the default space. Nothing is written unless every
+// definition is valid, notifier and card resolver settings included; the caller decides when
+// to publish the result.
+func (a *App) syncSpaces(ctx context.Context) (map[string]*database.Space, *database.Space, error) {
+	defs, err := a.loadSpaceDefs()
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return err
+		return nil, nil, err
+	}
+
+	// Build every row, notifier and SpaceAPI document up front so bad
+	// settings fail the boot (or the reload) before anything is written,
+	// instead of failing the first toggle or spaceapi.json request.
+	rows := make([]database.Space, len(defs))
+	for i, d := range defs {
+		for j, n := range d.Notifiers {
+			if _, err := a.notifiers.Build(n.Type, n.Settings); err != nil {
+				return nil, nil, fmt.Errorf("space %q notifiers[%d]: %w", d.Slug, j, err)
+			}
 		}
-		if a.config.APIKey == "" {
-			return fmt.Errorf("no spaces config at %s and no legacy API_KEY to synthesise a default space", a.config.SpacesConfigPath)
+		l, err := a.buildCardResolver(d.CardResolver)
+		if err != nil {
+			return nil, nil, fmt.Errorf("space %q: %w", d.Slug, err)
 		}
-		legacy := config.LegacySpaceFromConfig(a.config)
-		if legacy.Slug == "" {
-			legacy.Slug = slug
+		if d.RequireCard && l.Type() == "none" {
+			return nil, nil, fmt.Errorf("space %q: require_card needs a card_resolver that identifies members", d.Slug)
 		}
-		defs = []config.SpaceDef{legacy}
-		log.Printf("spaces config not found at %s; synthesising single space %q from legacy env vars", a.config.SpacesConfigPath, legacy.Slug)
+		sp, err := spaceFromDef(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := spaceapi.Validate(newSpaceAPIResponse(&sp, nil, nil)); err != nil {
+			return nil, nil, fmt.Errorf("space %q: %w", d.Slug, err)
+		}
+		rows[i] = sp
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
+	declared := make(map[string]bool, len(defs))
 	for _, d := range defs {
-		hash, err := bcrypt.GenerateFromPassword([]byte(d.APIKey), bcrypt.DefaultCost)
+		declared[d.Slug] = true
+	}
+
+	// The file is applied whole or not at all, so a failure halfway leaves
+	// the DB matching the registry, which keeps the previous config.
+	spaces := make(map[string]*database.Space)
+	var removed []database.Space
+	err = a.repo.Transaction(ctx, func(tx *database.Repository) error {
+		// Spaces created through the admin API live only in the DB; keep
+		// serving them alongside the ones declared in the file. Those the
+		// file used to declare and no longer does are deleted, history
+		// aside.
+		stored, err := tx.ListSpaces(ctx)
 		if err != nil {
-			return fmt.Errorf("hash api key for space %q: %w", d.Slug, err)
+			return fmt.Errorf("list stored spaces: %w", err)
 		}
-		projectsJSON, err := json.Marshal(d.Projects)
-		if err != nil {
-			return fmt.Errorf("encode projects for space %q: %w", d.Slug, err)
+		kept := make(map[string]*database.Space)
+		for i := range stored {
+			switch sp := &stored[i]; {
+			case declared[sp.Slug]:
+			case sp.FileState != "":
+				removed = append(removed, *sp)
+			default:
+				kept[sp.Slug] = sp
+			}
 		}
-		linksJSON, err := json.Marshal(d.Links)
-		if err != nil {
-			return fmt.Errorf("encode links for space %q: %w", d.Slug, err)
+		if slug := a.defaultSpaceSlug(); !declared[slug] && kept[slug] == nil {
+			return fmt.Errorf("default space slug %q not found in loaded spaces", slug)
 		}
 
-		sp, err := a.repo.UpsertSpace(ctx, database.Space{
-			Slug:           d.Slug,
-			Name:           d.Name,
-			Address:        d.Address,
-			Lat:            d.Lat,
-			Lon:            d.Lon,
-			Timezone:       d.Timezone,
-			LogoURL:        d.LogoURL,
-			URL:            d.URL,
-			ContactEmail:   d.ContactEmail,
-			Message:        d.Message,
-			APIKeyHash:     hash,
-			TelegramChatID: d.TelegramChatID,
-			TelegramThread: d.TelegramThread,
-			Projects:       string(projectsJSON),
-			Links:          string(linksJSON),
-		})
-		if err != nil {
-			return fmt.Errorf("upsert space %q: %w", d.Slug, err)
+		for i, d := range defs {
+			sp, err := tx.SyncFileSpace(ctx, rows[i], d.APIKey)
+			if err != nil {
+				return fmt.Errorf("sync space %q: %w", d.Slug, err)
+			}
+			spaces[sp.Slug] = sp
 		}
-		a.spaces[sp.Slug] = sp
+		for _, sp := range removed {
+			err := tx.DeleteSpace(ctx, sp.ID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("delete space %q: %w", sp.Slug, err)
+			}
+		}
+		for slug, sp := range kept {
+			spaces[slug] = sp
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sp := range removed {
+		slog.WarnContext(ctx, "space removed from the spaces config, no longer served", "space", sp.Slug)
 	}
 
-	ds, ok := a.spaces[slug]
+	slug := a.defaultSpaceSlug()
+	ds, ok := spaces[slug]
 	if !ok {
-		return fmt.Errorf("default space slug %q not found in loaded spaces", slug)
+		return nil, nil, fmt.Errorf("default space slug %q not found in loaded spaces", slug)
 	}
-	a.defaultSpace = ds
+	return spaces, ds, nil
+}
 
-	n, err := a.repo.BackfillDefaultSpaceID(ctx, ds.ID)
-	if err != nil {
-		return fmt.Errorf("backfill legacy sede_statuses: %w", err)
+// spaceFromDef converts a config definition into a Space row, JSON-encoding
+// the list and object columns. APIKeyHash is left to SyncFileSpace.
+func spaceFromDef(d config.SpaceDef) (database.Space, error) {
+	sp := database.Space{
+		Slug:             d.Slug,
+		Name:             d.Name,
+		Address:          d.Address,
+		Lat:              d.Lat,
+		Lon:              d.Lon,
+		Timezone:         d.Timezone,
+		LogoURL:          d.LogoURL,
+		URL:              d.URL,
+		ContactEmail:     d.ContactEmail,
+		Message:          d.Message,
+		TelegramChatID:   d.TelegramChatID,
+		TelegramThread:   d.TelegramThread,
+		ContactMatrix:    d.Contact.Matrix,
+		ContactMastodon:  d.Contact.Mastodon,
+		ContactIRC:       d.Contact.IRC,
+		ContactPhone:     d.Contact.Phone,
+		ContactIssueMail: d.Contact.IssueMail,
+		RequireCard:      d.RequireCard,
+		HideNames:        d.HideNames,
 	}
-	if n > 0 {
-		log.Printf("backfilled %d legacy sede_statuses rows onto space %q (id=%d)", n, ds.Slug, ds.ID)
+	if d.Icon != nil {
+		sp.IconOpen, sp.IconClosed = d.Icon.Open, d.Icon.Closed
 	}
+	for _, col := range []struct {
+		name string
+		dst  *string
+		v    any
+	}{
+		{"projects", &sp.Projects, d.Projects},
+		{"links", &sp.Links, d.Links},
+		{"webhooks", &sp.Webhooks, d.Webhooks},
+		{"notifiers", &sp.Notifiers, d.Notifiers},
+		{"auto_close", &sp.AutoClose, d.AutoClose},
+		{"stats_hours", &sp.StatsHours, d.StatsHours},
+		{"calendar", &sp.Calendar, d.Calendar},
+		{"card_resolver", &sp.CardResolver, d.CardResolver},
+		{"feeds", &sp.Feeds, d.Feeds},
+		{"sensors", &sp.Sensors, d.Sensors},
+		{"membership_plans", &sp.MembershipPlans, d.MembershipPlans},
+		{"areas", &sp.Areas, d.Areas},
+		{"spacefed", &sp.SpaceFed, d.SpaceFed},
+	} {
+		raw, err := json.Marshal(col.v)
+		if err != nil {
+			return database.Space{}, fmt.Errorf("encode %s for space %q: %w", col.name, d.Slug, err)
+		}
+		*col.dst = string(raw)
+	}
+	return sp, nil
+}
 
-	return nil
+// StartBackground launches the long-running workers (webhook delivery, the
+// spaces.yaml watcher, the auto-close scheduler and the device monitor).
+// They run until Shutdown.
+func (a *App) StartBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackground = cancel
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		a.webhooks.Run(ctx)
+	}()
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		a.watchSpacesConfig(ctx)
+	}()
+
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		a.runAutoClose(ctx)
+	}()
+
+	if a.config.DeviceOfflineAfter > 0 {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			a.runDeviceMonitor(ctx)
+		}()
+	}
+
+	if a.config.BackupInterval > 0 {
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			a.runBackups(ctx)
+		}()
+	}
 }
 
 func (a *App) CreateServer() *http.Server {
-	return &http.Server{
+	srv := &http.Server{
 		Addr:              ":" + a.config.Port,
 		Handler:           a.setupRouter(),
 		ReadTimeout:       5 * time.Second,
@@ -163,6 +356,9 @@ func (a *App) CreateServer() *http.Server {
 		ReadHeaderTimeout: 2 * time.Second,
 		MaxHeaderBytes:    1 << 20,
 	}
+	// SSE streams never go idle on their own; end them so Shutdown can drain.
+	srv.RegisterOnShutdown(a.events.close)
+	return srv
 }
 
 func (a *App) Shutdown(srv *http.Server) {
@@ -170,7 +366,12 @@ func (a *App) Shutdown(srv *http.Server) {
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		slog.Error("server shutdown", "error", err)
+	}
+
+	if a.stopBackground != nil {
+		a.stopBackground()
+		a.background.Wait()
 	}
 
 	if sqlDB, err := a.repo.Db.DB(); err == nil {
@@ -7,9 +7,15 @@ import (
 	"testing"
 
 	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
+func TestMain(m *testing.M) {
+	database.APIKeyHashCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
 func writeYAML(t *testing.T, dir, body string) string {
 	t.Helper()
 	p := filepath.Join(dir, "spaces.yaml")
@@ -41,16 +47,16 @@ func TestNewApp_LegacyUpgradePath(t *testing.T) {
 	}
 	defer closeApp(app)
 
-	if app.defaultSpace == nil {
+	if app.spaces.Default() == nil {
 		t.Fatal("defaultSpace nil")
 	}
-	if app.defaultSpace.Slug != "pescara" {
-		t.Errorf("want slug pescara, got %q", app.defaultSpace.Slug)
+	if app.spaces.Default().Slug != "pescara" {
+		t.Errorf("want slug pescara, got %q", app.spaces.Default().Slug)
 	}
-	if len(app.spaces) != 1 {
-		t.Errorf("want 1 space, got %d", len(app.spaces))
+	if app.spaces.Len() != 1 {
+		t.Errorf("want 1 space, got %d", app.spaces.Len())
 	}
-	if err := bcrypt.CompareHashAndPassword(app.defaultSpace.APIKeyHash, []byte(cfg.APIKey)); err != nil {
+	if err := bcrypt.CompareHashAndPassword(app.spaces.Default().APIKeyHash, []byte(cfg.APIKey)); err != nil {
 		t.Errorf("legacy api key not hashed into default space: %v", err)
 	}
 }
@@ -88,13 +94,13 @@ func TestNewApp_LoadsYAMLAndSeedsDB(t *testing.T) {
 	}
 	defer closeApp(app)
 
-	if len(app.spaces) != 2 {
-		t.Fatalf("want 2 spaces, got %d", len(app.spaces))
+	if app.spaces.Len() != 2 {
+		t.Fatalf("want 2 spaces, got %d", app.spaces.Len())
 	}
-	if app.defaultSpace == nil || app.defaultSpace.Slug != "pescara" {
-		t.Errorf("default space not pescara: %+v", app.defaultSpace)
+	if app.spaces.Default() == nil || app.spaces.Default().Slug != "pescara" {
+		t.Errorf("default space not pescara: %+v", app.spaces.Default())
 	}
-	aquila := app.spaces["aquila"]
+	aquila := mustSpace(t, app, "aquila")
 	if aquila == nil {
 		t.Fatal("aquila missing")
 	}
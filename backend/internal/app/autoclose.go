@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+	"gorm.io/gorm"
+)
+
+// reasonAuto tags the closures made by the auto-close scheduler.
+const reasonAuto = "auto"
+
+// autoCloseInterval is how often the scheduler checks for spaces left open.
+// Closures happen at most this late after the configured deadline.
+const autoCloseInterval = time.Minute
+
+// runAutoClose closes spaces past their auto_close deadline until ctx is
+// cancelled.
+func (a *App) runAutoClose(ctx context.Context) {
+	ticker := time.NewTicker(autoCloseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.autoCloseDue(ctx, now)
+		}
+	}
+}
+
+// autoCloseDue records a closed status, with Reason "auto", for every open
+// space whose auto_close deadline has passed at now. The deadline is
+// computed from the time the space was opened, in the space's timezone.
+func (a *App) autoCloseDue(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, contextTimeout)
+	defer cancel()
+
+	spaces, err := a.repo.ListSpaces(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "auto-close: list spaces", "error", err)
+		return
+	}
+	for i := range spaces {
+		sp := &spaces[i]
+		var policy *config.AutoClosePolicy
+		decodeSpaceJSON(sp, "auto_close", sp.AutoClose, &policy)
+		if policy == nil {
+			continue
+		}
+
+		latest, err := a.repo.GetLatestStatus(ctx, sp.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "auto-close: latest status", "space", sp.Slug, "error", err)
+			continue
+		}
+		if !latest.IsOpen {
+			continue
+		}
+
+		loc, err := time.LoadLocation(sp.Timezone)
+		if err != nil {
+			slog.ErrorContext(ctx, "auto-close: timezone", "space", sp.Slug, "error", err)
+			continue
+		}
+		deadline, err := policy.Deadline(latest.Timestamp, loc)
+		if err != nil {
+			slog.ErrorContext(ctx, "auto-close", "space", sp.Slug, "error", err)
+			continue
+		}
+		if now.Before(deadline) {
+			continue
+		}
+
+		status := database.SedeStatus{
+			SpaceID:   sp.ID,
+			IsOpen:    false,
+			Reason:    reasonAuto,
+			Source:    database.SourceScheduler,
+			Timestamp: now.UTC(),
+		}
+		// Only close if nobody toggled since latest was read, and only
+		// once when several replicas run the scheduler.
+		created, err := a.repo.CreateStatusIfLatest(ctx, &status, latest.ID, webhookDeliveries(sp))
+		if err != nil {
+			slog.ErrorContext(ctx, "auto-close", "space", sp.Slug, "error", err)
+			continue
+		}
+		if !created {
+			continue
+		}
+		a.announceStatusChange(sp, &status)
+		slog.InfoContext(ctx, "auto-closed", "space", sp.Slug, "open_since", latest.Timestamp)
+	}
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAutoCloseDue(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", "    message: Pescara welcomes you\n    auto_close:\n      at: \"03:00\"\n")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	pescara := mustSpace(t, app, "pescara")
+	aquila := mustSpace(t, app, "aquila")
+
+	rome, _ := time.LoadLocation("Europe/Rome")
+	opened := time.Date(2024, 5, 1, 21, 0, 0, 0, rome)
+	createTestStatusFor(t, app, pescara.ID, true, opened)
+	// aquila has no policy and must stay open.
+	createTestStatusFor(t, app, aquila.ID, true, opened)
+
+	ctx := context.Background()
+	app.autoCloseDue(ctx, time.Date(2024, 5, 2, 2, 59, 0, 0, rome))
+	if st, _ := app.repo.GetLatestStatus(ctx, pescara.ID); !st.IsOpen {
+		t.Fatal("closed before the deadline")
+	}
+
+	closeAt := time.Date(2024, 5, 2, 3, 0, 30, 0, rome)
+	app.autoCloseDue(ctx, closeAt)
+	st, err := app.repo.GetLatestStatus(ctx, pescara.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.IsOpen || st.Reason != reasonAuto || !st.Timestamp.Equal(closeAt) {
+		t.Fatalf("want auto close at %s, got %+v", closeAt, st)
+	}
+	if st, _ := app.repo.GetLatestStatus(ctx, aquila.ID); !st.IsOpen {
+		t.Error("space without auto_close was closed")
+	}
+
+	// A later tick must not add a second closure.
+	app.autoCloseDue(ctx, closeAt.Add(time.Hour))
+	var n int64
+	app.repo.Db.Table("sede_statuses").Where("space_id = ?", pescara.ID).Count(&n)
+	if n != 2 {
+		t.Errorf("want 2 status rows, got %d", n)
+	}
+
+	w := doReq(app.setupRouter(), "GET", "/s/pescara/spaceapi.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("spaceapi: %d", w.Code)
+	}
+	var resp SpaceAPIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.State.Open || resp.State.Message != "Chiusa automaticamente: nessuno aveva chiuso la sede 🌙" {
+		t.Errorf("state: %+v", resp.State)
+	}
+}
+
+func TestAutoCloseDue_PublishesEvent(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", "    message: Pescara welcomes you\n    auto_close:\n      after: 8h\n")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	pescara := mustSpace(t, app, "pescara")
+
+	opened := time.Now().Add(-9 * time.Hour)
+	createTestStatusFor(t, app, pescara.ID, true, opened)
+
+	ch, unsubscribe := app.events.subscribe(pescara.ID)
+	defer unsubscribe()
+
+	app.autoCloseDue(context.Background(), time.Now())
+	select {
+	case ev := <-ch:
+		if ev.Open || ev.Reason != reasonAuto {
+			t.Errorf("event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no status event published")
+	}
+}
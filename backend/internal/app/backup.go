@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	backupPrefix     = "sede-"
+	backupSuffix     = ".db.gz"
+	backupTimeLayout = "20060102T150405Z"
+	backupTimeout    = 10 * time.Minute
+)
+
+// runBackups snapshots the database every BackupInterval until ctx is
+// cancelled.
+func (a *App) runBackups(ctx context.Context) {
+	ticker := time.NewTicker(a.config.BackupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := a.scheduledBackup(ctx, now); err != nil {
+				slog.ErrorContext(ctx, "scheduled backup failed", "error", err)
+			}
+		}
+	}
+}
+
+// scheduledBackup writes a compressed snapshot named after now to
+// BackupDir, then deletes all but the newest BackupRetention snapshots.
+// Names sort chronologically, so pruning never has to parse them.
+func (a *App) scheduledBackup(ctx context.Context, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+
+	dir := a.config.BackupDir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, backupPrefix+now.UTC().Format(backupTimeLayout)+backupSuffix)
+	if err := a.repo.Backup(ctx, path, true); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "backup written", "path", path)
+
+	backups, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > a.config.BackupRetention {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("prune %s: %w", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledBackup_Retention(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.config.BackupDir = filepath.Join(t.TempDir(), "backups")
+	app.config.BackupRetention = 2
+
+	// Not a backup: must survive pruning.
+	os.MkdirAll(app.config.BackupDir, 0o700)
+	other := filepath.Join(app.config.BackupDir, "notes.txt")
+	os.WriteFile(other, nil, 0o600)
+
+	start := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if err := app.scheduledBackup(context.Background(), start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, _ := filepath.Glob(filepath.Join(app.config.BackupDir, "sede-*.db.gz"))
+	want := []string{
+		filepath.Join(app.config.BackupDir, "sede-20240501T050000Z.db.gz"),
+		filepath.Join(app.config.BackupDir, "sede-20240501T060000Z.db.gz"),
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("backups = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file pruned: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+const (
+	// calendarHistory is how far back calendar.ics lists past sessions.
+	calendarHistory = 90 * 24 * time.Hour
+	// calendarLookahead is how many days of "likely open" events are
+	// predicted, starting today.
+	calendarLookahead = 7
+	icsTimeLayout     = "20060102T150405Z"
+)
+
+// getCalendar serves the space's opening hours as an iCalendar feed: past
+// sessions rebuilt from the status history and, when the space sets
+// calendar.likely_open_threshold, tentative events for the hours of the
+// coming week whose /stats probability reaches the threshold.
+func (a *App) getCalendar(c *gin.Context) {
+	sp := spaceFrom(c)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	sessions, err := a.repo.ListSessions(ctx, sp.ID, now.Add(-calendarHistory), now)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	hideSessionNames(sp, sessions)
+
+	var settings *config.CalendarSettings
+	decodeSpaceJSON(sp, "calendar", sp.Calendar, &settings)
+	var likely []likelyOpenSlot
+	if settings != nil && settings.LikelyOpenThreshold > 0 {
+		w := statsWindow(sp)
+		stats, err := a.repo.GetWeeklyStats(ctx, sp.ID, w)
+		if handleDatabaseError(c, err) {
+			return
+		}
+		likely = likelyOpenSlots(stats, settings.LikelyOpenThreshold, w.Location, now)
+	}
+
+	c.Header("Cache-Control", "no-cache, must-revalidate")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(renderCalendar(sp, sessions, likely, now)))
+}
+
+// likelyOpenSlot is a run of consecutive hours predicted open.
+type likelyOpenSlot struct {
+	Start, End  time.Time
+	Probability float64 // mean over the run
+}
+
+// likelyOpenSlots maps the weekly probabilities onto the next
+// calendarLookahead local days, merging consecutive hours at or above
+// threshold into one slot. Slots that already ended are dropped.
+func likelyOpenSlots(stats []database.WeeklyStatsDetailed, threshold float64, loc *time.Location, now time.Time) []likelyOpenSlot {
+	byDay := make(map[string]map[int]float64, len(stats))
+	for _, d := range stats {
+		hours := make(map[int]float64, len(d.Hourly))
+		for _, h := range d.Hourly {
+			var hour int
+			if _, err := fmt.Sscanf(h.Hour, "%d", &hour); err == nil {
+				hours[hour] = h.Probability
+			}
+		}
+		byDay[d.Day] = hours
+	}
+
+	var slots []likelyOpenSlot
+	today := now.In(loc)
+	for i := 0; i < calendarLookahead; i++ {
+		y, m, d := today.Date()
+		date := time.Date(y, m, d+i, 0, 0, 0, 0, loc)
+		hours := byDay[date.Weekday().String()]
+
+		var cur *likelyOpenSlot
+		var sum float64
+		var n int
+		flush := func() {
+			if cur != nil {
+				cur.Probability = sum / float64(n)
+				if cur.End.After(now) {
+					slots = append(slots, *cur)
+				}
+				cur, sum, n = nil, 0, 0
+			}
+		}
+		for hour := 0; hour < 24; hour++ {
+			p, ok := hours[hour]
+			if !ok || p < threshold {
+				flush()
+				continue
+			}
+			end := time.Date(y, m, d+i, hour+1, 0, 0, 0, loc)
+			if cur == nil {
+				cur = &likelyOpenSlot{Start: time.Date(y, m, d+i, hour, 0, 0, 0, loc)}
+			}
+			cur.End = end
+			sum += p
+			n++
+		}
+		flush()
+	}
+	return slots
+}
+
+func renderCalendar(sp *database.Space, sessions []database.Session, likely []likelyOpenSlot, now time.Time) string {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICSLine(s))
+		b.WriteString("\r\n")
+	}
+	stamp := now.UTC().Format(icsTimeLayout)
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Metro Olografix//sede//IT")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICSText(sp.Name))
+	if sp.Timezone != "" {
+		line("X-WR-TIMEZONE:" + sp.Timezone)
+	}
+
+	for _, s := range sessions {
+		end := now
+		summary := "Sede aperta"
+		if s.End != nil {
+			end = *s.End
+		} else {
+			summary = "Sede aperta (in corso)"
+		}
+		var desc []string
+		if s.OpenedBy != "" {
+			desc = append(desc, "Aperta da "+s.OpenedBy)
+		}
+		if s.ClosedBy != "" {
+			desc = append(desc, "Chiusa da "+s.ClosedBy)
+		}
+		switch s.CloseReason {
+		case reasonGelatino:
+			desc = append(desc, "Chiusa per gelatino")
+		case reasonAuto:
+			desc = append(desc, "Chiusa automaticamente")
+		}
+
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:session-%d-%s@sede", s.Start.Unix(), sp.Slug))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + s.Start.UTC().Format(icsTimeLayout))
+		line("DTEND:" + end.UTC().Format(icsTimeLayout))
+		line("SUMMARY:" + escapeICSText(summary))
+		if len(desc) > 0 {
+			line("DESCRIPTION:" + escapeICSText(strings.Join(desc, "\n")))
+		}
+		line("STATUS:CONFIRMED")
+		line("END:VEVENT")
+	}
+
+	for _, l := range likely {
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:likely-%d-%s@sede", l.Start.Unix(), sp.Slug))
+		line("DTSTAMP:" + stamp)
+		line("DTSTART:" + l.Start.UTC().Format(icsTimeLayout))
+		line("DTEND:" + l.End.UTC().Format(icsTimeLayout))
+		line("SUMMARY:" + escapeICSText("Sede probabilmente aperta"))
+		line("DESCRIPTION:" + escapeICSText(fmt.Sprintf("Probabilità di apertura %.0f%% (ultimi 90 giorni)", l.Probability*100)))
+		line("STATUS:TENTATIVE")
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// escapeICSText escapes a TEXT value as required by RFC 5545 §3.3.11.
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine splits content lines longer than 75 octets, continuing them
+// with a leading space, without cutting a UTF-8 sequence in half.
+func foldICSLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		n := len(string(r))
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	return b.String()
+}
+
+// calendarURL is the absolute calendar.ics URL of sp, or "" without
+// PUBLIC_URL. It is never derived from the request: the Host header is the
+// client's to choose, and the SpaceAPI document linking it is cacheable.
+func (a *App) calendarURL(sp *database.Space) string {
+	if a.config.PublicURL == "" {
+		return ""
+	}
+	return a.config.PublicURL + "/s/" + sp.Slug + "/calendar.ics"
+}
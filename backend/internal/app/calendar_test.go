@@ -0,0 +1,154 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func TestGetCalendar_HistoricalSessions(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	id := mustSpace(t, app, "pescara").ID
+	opened := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Second)
+	for _, s := range []database.SedeStatus{
+		{SpaceID: id, IsOpen: true, ActorName: "Rossi, Mario", Timestamp: opened},
+		{SpaceID: id, IsOpen: false, Reason: reasonGelatino, Timestamp: opened.Add(2 * time.Hour)},
+	} {
+		createStatus(t, app, s)
+	}
+
+	w := doReq(router, "GET", "/s/pescara/calendar.ics", "", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("code %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Metro Olografix Pescara\r\n",
+		"DTSTART:" + opened.Format(icsTimeLayout) + "\r\n",
+		"DTEND:" + opened.Add(2*time.Hour).Format(icsTimeLayout) + "\r\n",
+		`DESCRIPTION:Aperta da Rossi\, Mario\nChiusa per gelatino` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calendar lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "TENTATIVE") {
+		t.Error("likely-open events need calendar.likely_open_threshold")
+	}
+}
+
+func TestGetCalendar_LikelyOpenEvents(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", "    message: Pescara welcomes you\n    calendar:\n      likely_open_threshold: 0.5\n")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	// Open since two weeks ago: every slot is fully open.
+	createStatus(t, app, database.SedeStatus{SpaceID: mustSpace(t, app, "pescara").ID, IsOpen: true, Timestamp: time.Now().Add(-14 * 24 * time.Hour)})
+
+	w := doReq(app.setupRouter(), "GET", "/s/pescara/calendar.ics", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d", w.Code)
+	}
+	if n := strings.Count(w.Body.String(), "STATUS:TENTATIVE"); n < calendarLookahead-1 {
+		t.Errorf("want one likely-open event per upcoming day, got %d:\n%s", n, w.Body.String())
+	}
+}
+
+func TestLikelyOpenSlots(t *testing.T) {
+	rome, _ := time.LoadLocation("Europe/Rome")
+	stats := []database.WeeklyStatsDetailed{{
+		Day: "Monday",
+		Hourly: []database.HourlyStat{
+			{Hour: "17", Probability: 0.2},
+			{Hour: "18", Probability: 0.6},
+			{Hour: "19", Probability: 0.8},
+			{Hour: "20", Probability: 0.4},
+			{Hour: "21", Probability: 0.9},
+		},
+	}}
+	// Sunday 5 May 2024, noon in Rome.
+	now := time.Date(2024, 5, 5, 12, 0, 0, 0, rome)
+
+	slots := likelyOpenSlots(stats, 0.5, rome, now)
+	if len(slots) != 2 {
+		t.Fatalf("want 2 slots, got %+v", slots)
+	}
+	if !slots[0].Start.Equal(time.Date(2024, 5, 6, 18, 0, 0, 0, rome)) || !slots[0].End.Equal(time.Date(2024, 5, 6, 20, 0, 0, 0, rome)) {
+		t.Errorf("first slot: %+v", slots[0])
+	}
+	if p := slots[0].Probability; p < 0.69 || p > 0.71 {
+		t.Errorf("mean probability: %v", p)
+	}
+	if !slots[1].Start.Equal(time.Date(2024, 5, 6, 21, 0, 0, 0, rome)) {
+		t.Errorf("second slot: %+v", slots[1])
+	}
+
+	// At 20:30 on Monday the 18-20 slot is over; only the 21:00 one is left.
+	if slots := likelyOpenSlots(stats, 0.5, rome, time.Date(2024, 5, 6, 20, 30, 0, 0, rome)); len(slots) != 1 {
+		t.Errorf("past slots should be dropped: %+v", slots)
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("è", 60)
+	folded := foldICSLine(long)
+	for _, l := range strings.Split(folded, "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != long {
+		t.Error("unfolding does not restore the line")
+	}
+}
+
+func TestGetSpaceAPI_AdvertisesCalendarFeed(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	// Without PUBLIC_URL the feed is left out rather than built from a
+	// Host header the client controls.
+	r := httptest.NewRequest("GET", "/s/aquila/spaceapi.json", nil)
+	r.Host = "evil.example"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "evil.example") {
+		t.Errorf("spaceapi.json: %d %s", w.Code, w.Body.String())
+	}
+	var resp SpaceAPIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := resp.Feeds["calendar"]; ok {
+		t.Errorf("feed without PUBLIC_URL: %+v", got)
+	}
+
+	app.config.PublicURL = "https://sede.example.org"
+	w = doReq(router, "GET", "/s/aquila/spaceapi.json", "", nil)
+	resp = SpaceAPIResponse{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if got := resp.Feeds["calendar"]; got.Type != "ical" || got.URL != "https://sede.example.org/s/aquila/calendar.ics" {
+		t.Errorf("feed with PUBLIC_URL: %+v", got)
+	}
+}
+
+func createStatus(t *testing.T, app *App, s database.SedeStatus) {
+	t.Helper()
+	if err := app.repo.CreateStatus(t.Context(), &s); err != nil {
+		t.Fatalf("CreateStatus: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/metro-olografix/sede/internal/cards"
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+// cardLookup is a built resolver together with the configuration it was
+// built from, so a reload that changes the block gets a fresh cache.
+type cardLookup struct {
+	raw    string
+	lookup *cards.Lookup
+}
+
+// localResolver checks cards against the members registry managed with
+// `sede members`, honouring each card's space scope.
+type localResolver struct {
+	repo   *database.Repository
+	spaces *SpaceRegistry
+}
+
+func (localResolver) Type() string { return "local" }
+func (localResolver) Local()       {}
+
+func (r localResolver) Resolve(ctx context.Context, card cards.Card) (string, error) {
+	sp, ok := r.spaces.Lookup(card.Space)
+	if !ok {
+		return "", fmt.Errorf("space %q not loaded", card.Space)
+	}
+	m, err := r.repo.AuthorizeCard(ctx, sp.ID, card.ID, card.Hash)
+	if errors.Is(err, database.ErrCardNotAuthorized) {
+		return "", cards.ErrUnknownCard
+	}
+	if err != nil {
+		return "", err
+	}
+	return m.Name, nil
+}
+
+// buildCardResolver builds the resolver configured for a space. Spaces
+// without a card_resolver block use the Metro Olografix manager when a
+// manager API token is configured, and the local members registry
+// otherwise.
+func (a *App) buildCardResolver(def *config.CardResolverDef) (*cards.Lookup, error) {
+	if def == nil {
+		if a.config.ManagerAPIToken == "" {
+			return a.cards.Build("local", nil)
+		}
+		return a.cards.Build("manager", cards.Settings{"token": a.config.ManagerAPIToken})
+	}
+	return a.cards.Build(def.Type, def.Settings)
+}
+
+// cardResolverFor returns the resolver of sp, building it on first use and
+// whenever the space's card_resolver column changes.
+func (a *App) cardResolverFor(sp *database.Space) (*cards.Lookup, error) {
+	a.cardLookupsMu.Lock()
+	defer a.cardLookupsMu.Unlock()
+	if cl, ok := a.cardLookups[sp.Slug]; ok && cl.raw == sp.CardResolver {
+		return cl.lookup, nil
+	}
+
+	var def *config.CardResolverDef
+	decodeSpaceJSON(sp, "card_resolver", sp.CardResolver, &def)
+	l, err := a.buildCardResolver(def)
+	if err != nil {
+		return nil, err
+	}
+	a.cardLookups[sp.Slug] = cardLookup{raw: sp.CardResolver, lookup: l}
+	return l, nil
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func TestToggleStatus_CardResolver(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     int
+		onError    string
+		wantCode   int
+		wantActor  string
+		wantRecord bool
+	}{
+		{"resolved", http.StatusOK, "", http.StatusOK, "Mario", true},
+		{"unknown card", http.StatusNotFound, "anonymous", http.StatusForbidden, "", false},
+		{"manager down", http.StatusInternalServerError, "", http.StatusBadGateway, "", false},
+		{"manager down, anonymous", http.StatusInternalServerError, "anonymous", http.StatusOK, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-API-TOKEN") != "mgr-token" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(`"Mario Rossi"`))
+			}))
+			defer manager.Close()
+
+			app, cleanup := setupTestApp(t)
+			defer cleanup()
+			router := app.setupRouter()
+
+			pescara := mustSpace(t, app, "pescara")
+			def, _ := json.Marshal(map[string]any{
+				"type":     "manager",
+				"settings": map[string]string{"url": manager.URL, "token": "mgr-token", "on_error": tc.onError},
+			})
+			pescara.CardResolver = string(def)
+
+			w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, []byte(`{"cardId":"04-A2-1B","hash":"h"}`))
+			if w.Code != tc.wantCode {
+				t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+			}
+
+			status, err := app.repo.GetLatestStatus(context.Background(), pescara.ID)
+			if !tc.wantRecord {
+				if err == nil {
+					t.Errorf("status recorded despite %d: %+v", tc.wantCode, status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !status.IsOpen || status.ActorName != tc.wantActor {
+				t.Errorf("status %+v, want open by %q", status, tc.wantActor)
+			}
+		})
+	}
+}
+
+func TestCardResolverFor_DefaultsAndReload(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	pescara := mustSpace(t, app, "pescara")
+
+	// No card_resolver and no manager token: the local registry.
+	l, err := app.cardResolverFor(pescara)
+	if err != nil || l.Type() != "local" {
+		t.Fatalf("default resolver: %v, %v", l, err)
+	}
+	if again, _ := app.cardResolverFor(pescara); again != l {
+		t.Error("resolver rebuilt although its configuration did not change")
+	}
+
+	app.config.ManagerAPIToken = "mgr-token"
+	if l, err := app.buildCardResolver(nil); err != nil || l.Type() != "manager" {
+		t.Fatalf("default resolver with token: %v, %v", l, err)
+	}
+
+	pescara.CardResolver = `{"type":"bogus","settings":{}}`
+	if _, err := app.cardResolverFor(pescara); err == nil {
+		t.Error("expected an error for an unknown resolver type")
+	}
+}
+
+func TestToggleStatus_LocalRegistry(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+	ctx := context.Background()
+
+	aquila := mustSpace(t, app, "aquila")
+	if _, err := app.repo.CreateMember(ctx, "Anna Bianchi", database.NewCard{UID: "04:A2:1B", Hash: "h", SpaceIDs: []uint{aquila.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	card := []byte(`{"cardId":"04-A2-1B","hash":"h"}`)
+
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, card); w.Code != http.StatusForbidden {
+		t.Errorf("card scoped to aquila opened pescara: %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, []byte(`{"cardId":"04-A2-1B","hash":"x"}`)); w.Code != http.StatusForbidden {
+		t.Errorf("wrong hash: %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, card); w.Code != http.StatusOK {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+	}
+	status, err := app.repo.GetLatestStatus(ctx, aquila.ID)
+	if err != nil || status.ActorName != "Anna Bianchi" {
+		t.Errorf("status %+v, %v", status, err)
+	}
+}
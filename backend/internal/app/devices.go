@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/notification"
+)
+
+const deviceContextKey = "device"
+
+// scopeHeartbeat is what authMiddleware is given for the heartbeat route:
+// any active device may send heartbeats, whatever its actions. It is not a
+// token scope.
+const scopeHeartbeat = "heartbeat"
+
+// scopeDeviceActions maps the scopes of the protected routes to the device
+// action allowing them. Scopes missing here are never granted to devices.
+var scopeDeviceActions = map[string]string{
+	database.ScopeStatusWrite:  database.DeviceActionToggle,
+	database.ScopeSensorsWrite: database.DeviceActionSensors,
+}
+
+// deviceMonitorInterval is how often heartbeats are checked. Devices are
+// reported at most this late after the offline threshold.
+const deviceMonitorInterval = 30 * time.Second
+
+// AdminDevice is a device of the admin overview. LastHeartbeat is nil for a
+// device that never sent one, which is not monitored.
+type AdminDevice struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Actions       string     `json:"actions"`
+	LastHeartbeat *time.Time `json:"last_heartbeat"`
+	Offline       bool       `json:"offline"`
+}
+
+func deviceFrom(c *gin.Context) *database.Device {
+	v, ok := c.Get(deviceContextKey)
+	if !ok {
+		return nil
+	}
+	d, _ := v.(*database.Device)
+	return d
+}
+
+// heartbeat records that the device authenticated by the request is alive,
+// announcing it if it had been reported offline. It needs a device key:
+// the space key doesn't say which device is calling.
+func (a *App) heartbeat(c *gin.Context) {
+	sp := spaceFrom(c)
+	d := deviceFrom(c)
+	if d == nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Heartbeats need a device key"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	wasOffline, err := a.repo.RecordHeartbeat(ctx, d.ID, time.Now().UTC())
+	if handleDatabaseError(c, err) {
+		return
+	}
+	if wasOffline {
+		slog.InfoContext(ctx, "device back online", "space", sp.Slug, "device", d.Name)
+		a.notifyDevice(sp, d, false)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// runDeviceMonitor reports devices that stopped sending heartbeats until ctx
+// is cancelled.
+func (a *App) runDeviceMonitor(ctx context.Context) {
+	ticker := time.NewTicker(deviceMonitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.devicesOfflineDue(ctx, now)
+		}
+	}
+}
+
+// devicesOfflineDue marks offline, and announces through the space's
+// notifiers, every device whose last heartbeat is older than the configured
+// threshold at now.
+func (a *App) devicesOfflineDue(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, contextTimeout)
+	defer cancel()
+
+	devices, err := a.repo.MarkDevicesOffline(ctx, now.Add(-a.config.DeviceOfflineAfter).UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "device monitor", "error", err)
+	}
+	if len(devices) == 0 {
+		return
+	}
+	spaces, err := a.repo.ListSpaces(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "device monitor: list spaces", "error", err)
+		return
+	}
+	byID := make(map[uint]*database.Space, len(spaces))
+	for i := range spaces {
+		byID[spaces[i].ID] = &spaces[i]
+	}
+	for i := range devices {
+		d := &devices[i]
+		sp, ok := byID[d.SpaceID]
+		if !ok {
+			continue
+		}
+		slog.WarnContext(ctx, "device offline", "space", sp.Slug, "device", d.Name, "last_heartbeat", d.LastHeartbeatAt)
+		a.notifyDevice(sp, d, true)
+	}
+}
+
+// notifyDevice announces through the notifiers of sp that d went offline
+// or came back.
+func (a *App) notifyDevice(sp *database.Space, d *database.Device, offline bool) {
+	a.deliver(sp, notification.Event{
+		Slug:      sp.Slug,
+		Space:     sp.Name,
+		Device:    d.Name,
+		Offline:   offline,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+func newAdminDevice(d database.Device) AdminDevice {
+	return AdminDevice{
+		ID:            d.ID,
+		Name:          d.Name,
+		Actions:       d.Actions,
+		LastHeartbeat: d.LastHeartbeatAt,
+		Offline:       d.Offline,
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func createTestDevice(t *testing.T, app *App, slug, name, actions string) (*database.Device, string) {
+	t.Helper()
+	key, err := database.NewDeviceKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := database.Device{SpaceID: mustSpace(t, app, slug).ID, Name: name, KeyHash: database.DeviceKeyHash(key), Actions: actions}
+	if err := app.repo.CreateDevice(context.Background(), &d); err != nil {
+		t.Fatal(err)
+	}
+	return &d, key
+}
+
+func TestDeviceKeys_ActionsAndRevocation(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	button, buttonKey := createTestDevice(t, app, "pescara", "button", "toggle")
+	_, kioskKey := createTestDevice(t, app, "pescara", "kiosk", "sensors")
+	sensors := pushBody(t, SensorReadingInput{Kind: "temperature", Value: 21.5, Location: "sala"})
+
+	for _, tc := range []struct {
+		name, method, path, key string
+		body                    []byte
+		want                    int
+	}{
+		{"button toggles", "POST", "/s/pescara/toggle", buttonKey, []byte(`{}`), http.StatusOK},
+		{"button can't push sensors", "POST", "/s/pescara/sensors", buttonKey, sensors, http.StatusForbidden},
+		{"kiosk pushes sensors", "POST", "/s/pescara/sensors", kioskKey, sensors, http.StatusCreated},
+		{"kiosk can't toggle", "POST", "/s/pescara/toggle", kioskKey, []byte(`{}`), http.StatusForbidden},
+		{"device keys can't export history", "GET", "/s/pescara/history.csv", kioskKey, nil, http.StatusForbidden},
+		{"key of another space", "POST", "/s/aquila/toggle", buttonKey, []byte(`{}`), http.StatusUnauthorized},
+		{"heartbeat", "POST", "/s/pescara/heartbeat", kioskKey, nil, http.StatusNoContent},
+		{"heartbeat with the space key", "POST", "/s/pescara/heartbeat", pescaraKey, nil, http.StatusForbidden},
+	} {
+		if w := doReq(router, tc.method, tc.path, tc.key, tc.body); w.Code != tc.want {
+			t.Errorf("%s: want %d, got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	if err := app.repo.RevokeDevice(context.Background(), button.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := doReq(router, "POST", "/s/pescara/heartbeat", buttonKey, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked device: want 401, got %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/pescara/sensors", kioskKey, sensors); w.Code != http.StatusCreated {
+		t.Errorf("revoking the button broke the kiosk: %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, sensors); w.Code != http.StatusCreated {
+		t.Errorf("revoking the button broke the space key: %d", w.Code)
+	}
+}
+
+func TestDeviceMonitor_AlertsOnceAndOnRecovery(t *testing.T) {
+	messages := make(chan string, 4)
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		messages <- body["content"]
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer discord.Close()
+
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+	app.config.DeviceOfflineAfter = 5 * time.Minute
+	ctx := context.Background()
+
+	aquila := mustSpace(t, app, "aquila")
+	notifiers := `[{"type":"discord","settings":{"webhook_url":"` + discord.URL + `"}}]`
+	if err := app.repo.Db.Model(&database.Space{}).Where("id = ?", aquila.ID).Update("notifiers", notifiers).Error; err != nil {
+		t.Fatal(err)
+	}
+	aquila.Notifiers = notifiers
+
+	kiosk, kioskKey := createTestDevice(t, app, "aquila", "kiosk", "")
+	createTestDevice(t, app, "aquila", "never-seen", "")
+	now := time.Now().UTC()
+	if _, err := app.repo.RecordHeartbeat(ctx, kiosk.ID, now.Add(-10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-messages:
+			if got != want {
+				t.Errorf("message %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no notification, want %q", want)
+		}
+	}
+
+	app.devicesOfflineDue(ctx, now)
+	expect("⚠️ dispositivo kiosk offline")
+	app.devicesOfflineDue(ctx, now.Add(time.Minute))
+
+	var ov AdminOverview
+	_ = json.Unmarshal(doAdmin(router, "GET", "/admin/overview", adminToken, nil).Body.Bytes(), &ov)
+	if devices := ov.Spaces[0].Devices; len(devices) != 2 || !devices[0].Offline || devices[1].Offline || devices[1].LastHeartbeat != nil {
+		t.Errorf("aquila devices: %+v", devices)
+	}
+
+	if w := doReq(router, "POST", "/s/aquila/heartbeat", kioskKey, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("heartbeat: %d", w.Code)
+	}
+	expect("✅ dispositivo kiosk di nuovo online")
+	select {
+	case extra := <-messages:
+		t.Errorf("unexpected notification %q", extra)
+	default:
+	}
+}
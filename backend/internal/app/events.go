@@ -0,0 +1,258 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	sseWriteTimeout      = 10 * time.Second
+	sseReplayLimit       = 500
+	sseSubscriberBuffer  = 16
+)
+
+// StatusEvent is the wire shape of a single open/close change pushed to
+// /s/{slug}/events subscribers. ID is the sede_statuses row ID, so it is
+// monotonic per instance and usable as the SSE event id. Source is how the
+// change came in (button, api, admin or scheduler).
+type StatusEvent struct {
+	ID        uint      `json:"id"`
+	Space     string    `json:"space"`
+	Open      bool      `json:"open"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	By        string    `json:"by,omitempty"`
+	Source    string    `json:"source,omitempty"`
+}
+
+func newStatusEvent(sp *database.Space, s database.SedeStatus) StatusEvent {
+	return StatusEvent{
+		ID:        s.ID,
+		Space:     sp.Slug,
+		Open:      s.IsOpen,
+		Reason:    s.Reason,
+		Timestamp: s.Timestamp,
+		By:        s.ActorName,
+		Source:    s.Source,
+	}
+}
+
+// publicStatusEvent is ev as it leaves the admin API (event stream,
+// notifications, webhooks): without the name when the space hides them.
+func publicStatusEvent(sp *database.Space, ev StatusEvent) StatusEvent {
+	if sp.HideNames {
+		ev.By = ""
+	}
+	return ev
+}
+
+// eventHub fans status events out to the SSE subscribers of each space.
+// Publishing never blocks: a subscriber whose buffer is full misses the
+// event live and picks it up from the DB on its next reconnect.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[uint]map[chan StatusEvent]struct{}
+	closed bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[uint]map[chan StatusEvent]struct{})}
+}
+
+// subscribe registers a new listener for spaceID. The returned cancel func
+// must be called once the listener goes away. On a closed hub the channel is
+// returned already closed.
+func (h *eventHub) subscribe(spaceID uint) (<-chan StatusEvent, func()) {
+	ch := make(chan StatusEvent, sseSubscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[spaceID] == nil {
+		h.subs[spaceID] = make(map[chan StatusEvent]struct{})
+	}
+	h.subs[spaceID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[spaceID][ch]; !ok {
+			return
+		}
+		delete(h.subs[spaceID], ch)
+		if len(h.subs[spaceID]) == 0 {
+			delete(h.subs, spaceID)
+		}
+		close(ch)
+	}
+}
+
+func (h *eventHub) publish(spaceID uint, ev StatusEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[spaceID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// close disconnects every subscriber so open streams end and the HTTP
+// server can drain during shutdown.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, set := range h.subs {
+		for ch := range set {
+			close(ch)
+		}
+	}
+	h.subs = make(map[uint]map[chan StatusEvent]struct{})
+}
+
+// streamEvents serves a text/event-stream of status changes for the resolved
+// space. A client reconnecting with Last-Event-ID (header, or lastEventId
+// query param for EventSource polyfills) first receives every row it missed
+// from sede_statuses; a fresh client receives the current state.
+func (a *App) streamEvents(c *gin.Context) {
+	sp := spaceFrom(c)
+	ctx := c.Request.Context()
+
+	lastID, resume, err := parseLastEventID(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+		return
+	}
+
+	// Subscribe before reading the backlog so nothing published in between
+	// is lost; duplicates are filtered by ID below.
+	events, unsubscribe := a.events.subscribe(sp.ID)
+	defer unsubscribe()
+
+	var backlog []database.SedeStatus
+	if resume {
+		backlog, err = a.repo.ListStatusesAfter(ctx, sp.ID, lastID, sseReplayLimit)
+		if handleDatabaseError(c, err) {
+			return
+		}
+	} else {
+		latest, err := a.repo.GetLatestStatus(ctx, sp.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			handleDatabaseError(c, err)
+			return
+		}
+		if err == nil {
+			backlog = []database.SedeStatus{latest}
+		}
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// The server-wide WriteTimeout would otherwise cut every stream after a
+	// few seconds; push the deadline forward before each write instead.
+	rc := http.NewResponseController(c.Writer)
+	send := func(write func(io.Writer) error) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if err := write(c.Writer); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	if !send(func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", sseHeartbeatInterval.Milliseconds())
+		return err
+	}) {
+		return
+	}
+
+	for _, s := range backlog {
+		ev := publicStatusEvent(sp, newStatusEvent(sp, s))
+		if !send(func(w io.Writer) error { return writeStatusEvent(w, ev) }) {
+			return
+		}
+		lastID = ev.ID
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.ID <= lastID {
+				continue
+			}
+			ev = publicStatusEvent(sp, ev)
+			if !send(func(w io.Writer) error { return writeStatusEvent(w, ev) }) {
+				return
+			}
+			lastID = ev.ID
+		case <-heartbeat.C:
+			if !send(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err
+			}) {
+				return
+			}
+		}
+	}
+}
+
+func writeStatusEvent(w io.Writer, ev StatusEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("encode status event", "event_id", ev.ID, "error", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", ev.ID, data)
+	return err
+}
+
+// parseLastEventID reports the ID the client last saw and whether it asked to
+// resume at all. An empty value is a fresh connection, not an error.
+func parseLastEventID(c *gin.Context) (uint, bool, error) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("lastEventId")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(id), true, nil
+}
@@ -0,0 +1,209 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+// readEvent scans the stream until the next complete "status" event and
+// returns its id line and decoded payload. Comments and retry hints are
+// skipped.
+func readEvent(t *testing.T, sc *bufio.Scanner) (string, StatusEvent) {
+	t.Helper()
+	var id, data, event string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if event == "status" {
+				var ev StatusEvent
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					t.Fatalf("decode event %q: %v", data, err)
+				}
+				return id, ev
+			}
+			id, data, event = "", "", ""
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended before next event: %v", sc.Err())
+	return "", StatusEvent{}
+}
+
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) *bufio.Scanner {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type %q", ct)
+	}
+	return bufio.NewScanner(resp.Body)
+}
+
+func TestStreamEvents_InitialStateThenLiveToggle(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(app.setupRouter())
+	defer srv.Close()
+
+	createTestStatusFor(t, app, mustSpace(t, app, "pescara").ID, true, time.Now().UTC().Add(-time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sc := openStream(t, ctx, srv.URL+"/s/pescara/events", "")
+
+	_, initial := readEvent(t, sc)
+	if !initial.Open || initial.Space != "pescara" {
+		t.Fatalf("initial event: %+v", initial)
+	}
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(app.setupRouter(), "POST", "/s/pescara/toggle", pescaraKey, body); w.Code != http.StatusOK {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+	}
+
+	_, live := readEvent(t, sc)
+	if live.Open || live.ID <= initial.ID {
+		t.Errorf("live event: %+v (initial %+v)", live, initial)
+	}
+}
+
+func TestStreamEvents_ResumeFromLastEventID(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(app.setupRouter())
+	defer srv.Close()
+
+	spaceID := mustSpace(t, app, "pescara").ID
+	base := time.Now().UTC().Add(-3 * time.Hour)
+	var rows []database.SedeStatus
+	for i, open := range []bool{true, false, true} {
+		s := database.SedeStatus{SpaceID: spaceID, IsOpen: open, ActorName: "mario", Timestamp: base.Add(time.Duration(i) * time.Hour)}
+		if err := app.repo.CreateStatus(context.Background(), &s); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, s)
+	}
+	// Another space's rows must never leak into this stream.
+	createTestStatusFor(t, app, mustSpace(t, app, "aquila").ID, true, base)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sc := openStream(t, ctx, srv.URL+"/s/pescara/events", strconv.FormatUint(uint64(rows[0].ID), 10))
+
+	for _, want := range rows[1:] {
+		_, ev := readEvent(t, sc)
+		if ev.ID != want.ID || ev.Open != want.IsOpen || ev.By != "mario" || ev.Space != "pescara" {
+			t.Errorf("replayed %+v, want id=%d open=%v", ev, want.ID, want.IsOpen)
+		}
+	}
+}
+
+func TestStreamEvents_ResumeSkipsImportedHistory(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	srv := httptest.NewServer(app.setupRouter())
+	defer srv.Close()
+
+	ctx := context.Background()
+	spaceID := mustSpace(t, app, "pescara").ID
+	seen := database.SedeStatus{SpaceID: spaceID, IsOpen: true, Timestamp: time.Now().UTC().Add(-time.Hour)}
+	if err := app.repo.CreateStatus(ctx, &seen); err != nil {
+		t.Fatal(err)
+	}
+
+	// Imported rows get IDs above the one the client last saw, but they
+	// are months old and must not be replayed as news.
+	past := time.Now().UTC().AddDate(0, -3, 0)
+	imported, err := app.repo.ImportStatuses(ctx, spaceID, []database.SedeStatus{
+		{IsOpen: true, Timestamp: past},
+		{IsOpen: false, Timestamp: past.Add(time.Hour)},
+	})
+	if err != nil || imported != 2 {
+		t.Fatalf("import: %d, %v", imported, err)
+	}
+	missed := database.SedeStatus{SpaceID: spaceID, IsOpen: false, Timestamp: time.Now().UTC()}
+	if err := app.repo.CreateStatus(ctx, &missed); err != nil {
+		t.Fatal(err)
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	sc := openStream(t, streamCtx, srv.URL+"/s/pescara/events", strconv.FormatUint(uint64(seen.ID), 10))
+
+	if _, ev := readEvent(t, sc); ev.ID != missed.ID || ev.Open {
+		t.Errorf("replayed %+v, want only id=%d", ev, missed.ID)
+	}
+}
+
+func TestStreamEvents_InvalidLastEventID(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/s/pescara/events", nil)
+	r.Header.Set("Last-Event-ID", "not-a-number")
+	app.setupRouter().ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("want 400, got %d", w.Code)
+	}
+}
+
+func TestEventHub_PublishIsPerSpaceAndCloseEndsStreams(t *testing.T) {
+	h := newEventHub()
+	a, cancelA := h.subscribe(1)
+	defer cancelA()
+	b, cancelB := h.subscribe(2)
+	defer cancelB()
+
+	h.publish(1, StatusEvent{ID: 7})
+	select {
+	case ev := <-a:
+		if ev.ID != 7 {
+			t.Errorf("got %+v", ev)
+		}
+	default:
+		t.Fatal("space 1 subscriber got nothing")
+	}
+	select {
+	case ev := <-b:
+		t.Fatalf("space 2 subscriber got %+v", ev)
+	default:
+	}
+
+	h.close()
+	if _, ok := <-a; ok {
+		t.Error("expected closed channel after hub close")
+	}
+	if _, ok := <-b; ok {
+		t.Error("expected closed channel after hub close")
+	}
+	late, _ := h.subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("subscribe on closed hub should return a closed channel")
+	}
+}
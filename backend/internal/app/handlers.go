@@ -1,19 +1,17 @@
 package app
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/config"
 	"github.com/metro-olografix/sede/internal/database"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -42,24 +40,60 @@ type WeeklyStatsDetailed struct {
 	Hourly           []HourlyStat `json:"hourly"`
 }
 
-// authMiddleware compares X-API-KEY against the bcrypt hash stored on the
-// resolved space. Every space owns its own key so one space's secret cannot
-// unlock another's toggle endpoint.
-func (a *App) authMiddleware() gin.HandlerFunc {
+// authMiddleware authorizes the resolved space's protected routes for
+// scope. The credential comes from X-API-KEY or "Authorization: Bearer" and
+// may be an API token holding scope for this space, the key of an active
+// device of the space allowed the matching action, or the space key itself,
+// compared against its bcrypt hash, which holds every scope. Every space
+// owns its own keys so one space's secret cannot unlock another's toggle
+// endpoint. scopeHeartbeat is open to any device of the space.
+func (a *App) authMiddleware(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		sp := spaceFrom(c)
 		if sp == nil {
-			abortUnauthorized(c)
+			a.rejectAuth(c, "api_key")
 			return
 		}
-		apiKey := c.GetHeader("X-API-KEY")
+		apiKey := apiCredential(c)
 		if apiKey == "" {
-			abortUnauthorized(c)
+			a.rejectAuth(c, "api_key")
+			return
+		}
+		ctx := c.Request.Context()
+
+		if strings.HasPrefix(apiKey, database.APITokenPrefix) {
+			tok, err := a.repo.AuthenticateAPIToken(ctx, apiKey, time.Now().UTC())
+			switch {
+			case err == nil && !tok.Allows(scope, sp.ID):
+				logSecurityEvent(c, sp.Slug, fmt.Sprintf("token %q not allowed on %s", tok.Name, c.FullPath()))
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token not allowed"})
+				return
+			case err == nil:
+				c.Next()
+				return
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				handleDatabaseError(c, err)
+				return
+			}
+		}
+
+		d, err := a.repo.AuthenticateDevice(ctx, sp.ID, apiKey)
+		switch {
+		case err == nil && scope != scopeHeartbeat && !d.Allows(scopeDeviceActions[scope]):
+			logSecurityEvent(c, sp.Slug, fmt.Sprintf("device %q not allowed on %s", d.Name, c.FullPath()))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Device not allowed"})
+			return
+		case err == nil:
+			c.Set(deviceContextKey, d)
+			c.Next()
+			return
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			handleDatabaseError(c, err)
 			return
 		}
 		if err := bcrypt.CompareHashAndPassword(sp.APIKeyHash, []byte(apiKey)); err != nil {
-			logSecurityEvent(fmt.Sprintf("invalid API key attempt for space %q", sp.Slug))
-			abortUnauthorized(c)
+			logSecurityEvent(c, sp.Slug, "invalid API key attempt")
+			a.rejectAuth(c, "api_key")
 			return
 		}
 		c.Next()
@@ -117,14 +151,6 @@ func (a *App) toggleStatus(c *gin.Context) {
 		return
 	}
 
-	var cardName string
-	if req.CardID != "" && req.Hash != "" {
-		cardName = a.getCardName(ctx, req.CardID, req.Hash, c)
-		if c.IsAborted() {
-			return
-		}
-	}
-
 	// "gelatino" is a forced close, not a flip: a double-click should always
 	// land in the closed state regardless of the previous one.
 	newIsOpen := !currentStatus.IsOpen
@@ -132,94 +158,66 @@ func (a *App) toggleStatus(c *gin.Context) {
 		newIsOpen = false
 	}
 
+	decision, err := a.decideToggle(ctx, sp, req, newIsOpen)
+	if err != nil {
+		slog.ErrorContext(ctx, "build card resolver", "space", sp.Slug, "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Card resolver misconfigured"})
+		return
+	}
+	if err := a.recordAccessDecision(ctx, c, sp, newIsOpen, decision); err != nil {
+		handleDatabaseError(c, err)
+		return
+	}
+	if !decision.allowed {
+		logSecurityEvent(c, sp.Slug, "toggle denied: "+decision.reason)
+		c.AbortWithStatusJSON(decision.status, gin.H{"error": decision.message})
+		return
+	}
+
 	newStatus := database.SedeStatus{
 		SpaceID:   sp.ID,
 		IsOpen:    newIsOpen,
 		Reason:    req.Reason,
+		ActorName: decision.name,
+		CardHash:  cardIDHash(decision.cardUID),
+		Source:    database.SourceAPI,
+		ClientIP:  c.ClientIP(),
 		Timestamp: time.Now().UTC(),
 	}
+	if decision.cardUID != "" {
+		newStatus.Source = database.SourceButton
+	}
 
-	if err := a.repo.CreateStatus(ctx, newStatus); err != nil {
+	if err := a.recordStatusChange(ctx, sp, &newStatus); err != nil {
 		handleDatabaseError(c, err)
 		return
 	}
 
-	if a.telegram.IsInitialized() && sp.TelegramChatID != 0 {
-		go func() {
-			emoji := "🟢"
-			action := "aperta"
-			if !newStatus.IsOpen {
-				emoji = "🔴"
-				action = "chiusa"
-			}
-			if newStatus.Reason == reasonGelatino {
-				emoji = "🍦"
-				action = "chiusa per gelatino"
-			}
-
-			var msg string
-			if cardName != "" {
-				msg = fmt.Sprintf("%s sede %s da %s", emoji, action, cardName)
-			} else {
-				msg = fmt.Sprintf("%s sede %s", emoji, action)
-			}
-
-			if err := a.telegram.Send(sp.TelegramChatID, sp.TelegramThread, msg); err != nil {
-				log.Printf("Failed to send Telegram notification: %v", err)
-			}
-		}()
-	}
-
 	c.String(http.StatusOK, fmt.Sprintf("%v", newStatus.IsOpen))
 }
 
-func (a *App) getCardName(ctx context.Context, cardID, hash string, c *gin.Context) string {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	cardID = strings.ReplaceAll(cardID, "-", "")
-
-	payload := map[string]string{
-		"cardId": cardID,
-		"hash":   hash,
-	}
-
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
-		return ""
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://manager.olografix.org/api/card/name", bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
-		return ""
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-TOKEN", os.Getenv("SEDE_MANAGER_API_TOKEN"))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "Failed to contact card manager"})
-		return ""
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "Card manager returned error"})
-		return ""
+// recordStatusChange persists status together with its webhook deliveries
+// and announces it to event-stream subscribers and notifiers.
+func (a *App) recordStatusChange(ctx context.Context, sp *database.Space, status *database.SedeStatus) error {
+	if err := a.repo.CreateStatusWithWebhooks(ctx, status, webhookDeliveries(sp)); err != nil {
+		return err
 	}
+	a.announceStatusChange(sp, status)
+	return nil
+}
 
-	nameBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read card name response: %v", err)
-		return ""
+// announceStatusChange announces a status persisted with its webhook
+// deliveries. Toggles and the auto-close scheduler both go through it so
+// every status change is announced the same way.
+func (a *App) announceStatusChange(sp *database.Space, status *database.SedeStatus) {
+	a.metrics.observeStatusChange(sp, status)
+	ev := newStatusEvent(sp, *status)
+	a.events.publish(sp.ID, ev)
+	if sp.Webhooks != "" {
+		a.webhooks.Kick()
 	}
 
-	cardName := string(nameBytes)
-	cardName = strings.Split(cardName, " ")[0]
-	cardName = strings.ReplaceAll(cardName, "\"", "")
-	return cardName
+	a.notify(sp, ev)
 }
 
 func (a *App) getStats(c *gin.Context) {
@@ -227,7 +225,7 @@ func (a *App) getStats(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
 	defer cancel()
 
-	weeklyStats, err := a.repo.GetWeeklyStats(ctx, sp.ID)
+	weeklyStats, err := a.repo.GetWeeklyStats(ctx, sp.ID, statsWindow(sp))
 	if handleDatabaseError(c, err) {
 		return
 	}
@@ -235,14 +233,38 @@ func (a *App) getStats(c *gin.Context) {
 	c.JSON(http.StatusOK, weeklyStats)
 }
 
+// statsWindow buckets statistics in the space's timezone and configured hour
+// range. Spaces without a (valid) timezone fall back to UTC.
+func statsWindow(sp *database.Space) database.StatsWindow {
+	loc, err := time.LoadLocation(sp.Timezone)
+	if err != nil {
+		slog.Error("invalid timezone", "space", sp.Slug, "timezone", sp.Timezone, "error", err)
+		loc = time.UTC
+	}
+	w := database.DefaultStatsWindow(loc)
+	var hours *config.StatsHours
+	decodeSpaceJSON(sp, "stats_hours", sp.StatsHours, &hours)
+	if hours != nil {
+		w.FromHour, w.ToHour = hours.From, hours.To
+	}
+	return w
+}
+
 func abortUnauthorized(c *gin.Context) {
 	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 		"error": "Invalid or missing API key",
 	})
 }
 
-func logSecurityEvent(message string) {
-	log.Printf("[SECURITY] %s", message)
+// logSecurityEvent records a security-relevant event (failed credentials,
+// key rotation) with the space and client IP, so failed attempts can be
+// traced and alerted on.
+func logSecurityEvent(c *gin.Context, slug, message string) {
+	slog.WarnContext(c.Request.Context(), message,
+		"security", true,
+		"space", slug,
+		"client_ip", c.ClientIP(),
+	)
 }
 
 func handleDatabaseError(c *gin.Context, err error) bool {
@@ -250,7 +272,11 @@ func handleDatabaseError(c *gin.Context, err error) bool {
 		return false
 	}
 
-	log.Printf("Database error: %v", err)
+	ctx := context.Background()
+	if c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	slog.ErrorContext(ctx, "database error", "error", err)
 
 	if errors.Is(err, context.DeadlineExceeded) {
 		c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
@@ -265,21 +291,26 @@ func handleDatabaseError(c *gin.Context, err error) bool {
 }
 
 type SpaceAPIResponse struct {
-	APICompatibility []string          `json:"api_compatibility"`
-	Space            string            `json:"space"`
-	Logo             string            `json:"logo"`
-	URL              string            `json:"url"`
-	Location         map[string]any    `json:"location"`
-	State            SpaceAPIState     `json:"state"`
-	Contact          map[string]string `json:"contact"`
-	Projects         []string          `json:"projects"`
-	Links            []SpaceAPILink    `json:"links"`
+	APICompatibility []string                    `json:"api_compatibility"`
+	Space            string                      `json:"space"`
+	Logo             string                      `json:"logo"`
+	URL              string                      `json:"url"`
+	Location         map[string]any              `json:"location"`
+	SpaceFed         *config.SpaceFed            `json:"spacefed,omitempty"`
+	State            SpaceAPIState               `json:"state"`
+	Contact          map[string]string           `json:"contact"`
+	Sensors          map[string]any              `json:"sensors,omitempty"`
+	Feeds            map[string]config.SpaceFeed `json:"feeds,omitempty"`
+	Projects         []string                    `json:"projects,omitempty"`
+	Links            []SpaceAPILink              `json:"links,omitempty"`
+	MembershipPlans  []config.MembershipPlan     `json:"membership_plans,omitempty"`
 }
 
 type SpaceAPIState struct {
-	Open       bool   `json:"open"`
-	Message    string `json:"message"`
-	LastChange int64  `json:"lastchange"`
+	Open       bool              `json:"open"`
+	Message    string            `json:"message"`
+	LastChange int64             `json:"lastchange"`
+	Icon       *config.SpaceIcon `json:"icon,omitempty"`
 }
 
 type SpaceAPILink struct {
@@ -298,35 +329,56 @@ func (a *App) getSpaceAPI(c *gin.Context) {
 		handleDatabaseError(c, err)
 		return
 	}
+	var latest *database.SedeStatus
+	if err == nil {
+		latest = &status
+	}
+	readings, err := a.repo.LatestSensorReadings(ctx, sp.ID)
+	if handleDatabaseError(c, err) {
+		return
+	}
+
+	resp := newSpaceAPIResponse(sp, latest, readings)
+	// Advertise our own calendar feed unless spaces.yaml points elsewhere.
+	if _, ok := resp.Feeds["calendar"]; !ok {
+		if u := a.calendarURL(sp); u != "" {
+			if resp.Feeds == nil {
+				resp.Feeds = map[string]config.SpaceFeed{}
+			}
+			resp.Feeds["calendar"] = config.SpaceFeed{Type: "ical", URL: u}
+		}
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Cache-Control", "no-cache, must-revalidate")
+	c.JSON(http.StatusOK, resp)
+}
 
+// newSpaceAPIResponse renders sp as a SpaceAPI v15 document. latest is the
+// most recent status row, or nil when the space has never been toggled;
+// readings are the latest device sensor values, published next to the
+// static sensors from spaces.yaml.
+// Optional sections are omitted when unset so the document stays valid
+// against the v15 schema (e.g. an empty timezone would fail its pattern).
+func newSpaceAPIResponse(sp *database.Space, latest *database.SedeStatus, readings []database.SensorReading) SpaceAPIResponse {
 	var isOpen bool
 	var lastChange int64
 	var reason string
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		isOpen = status.IsOpen
-		lastChange = status.Timestamp.Unix()
-		reason = status.Reason
+	if latest != nil {
+		isOpen = latest.IsOpen
+		lastChange = latest.Timestamp.Unix()
+		reason = latest.Reason
 	}
 
-	// When the latest event is a gelatino closure, surface it in the SpaceAPI
-	// message field so any external consumer (websites, dashboards) sees the
+	// When the latest event is a gelatino or automatic closure, surface it in
+	// the SpaceAPI message field so any external consumer (websites, dashboards) sees the
 	// reason rather than just "closed".
 	message := sp.Message
 	if !isOpen && reason == reasonGelatino {
 		message = "Chiusa per gelatino 🍦"
 	}
-
-	var projects []string
-	if sp.Projects != "" {
-		if err := json.Unmarshal([]byte(sp.Projects), &projects); err != nil {
-			log.Printf("space %q: decode projects: %v", sp.Slug, err)
-		}
-	}
-	var links []SpaceAPILink
-	if sp.Links != "" {
-		if err := json.Unmarshal([]byte(sp.Links), &links); err != nil {
-			log.Printf("space %q: decode links: %v", sp.Slug, err)
-		}
+	if !isOpen && reason == reasonAuto {
+		message = "Chiusa automaticamente: nessuno aveva chiuso la sede 🌙"
 	}
 
 	resp := SpaceAPIResponse{
@@ -335,10 +387,8 @@ func (a *App) getSpaceAPI(c *gin.Context) {
 		Logo:             sp.LogoURL,
 		URL:              sp.URL,
 		Location: map[string]any{
-			"address":  sp.Address,
-			"lat":      sp.Lat,
-			"lon":      sp.Lon,
-			"timezone": sp.Timezone,
+			"lat": sp.Lat,
+			"lon": sp.Lon,
 		},
 		State: SpaceAPIState{
 			Open:       isOpen,
@@ -348,11 +398,56 @@ func (a *App) getSpaceAPI(c *gin.Context) {
 		Contact: map[string]string{
 			"email": sp.ContactEmail,
 		},
-		Projects: projects,
-		Links:    links,
+	}
+	if sp.Address != "" {
+		resp.Location["address"] = sp.Address
+	}
+	if sp.Timezone != "" {
+		resp.Location["timezone"] = sp.Timezone
+	}
+	if sp.IconOpen != "" || sp.IconClosed != "" {
+		resp.State.Icon = &config.SpaceIcon{Open: sp.IconOpen, Closed: sp.IconClosed}
+	}
+	for key, v := range map[string]string{
+		"matrix":     sp.ContactMatrix,
+		"mastodon":   sp.ContactMastodon,
+		"irc":        sp.ContactIRC,
+		"phone":      sp.ContactPhone,
+		"issue_mail": sp.ContactIssueMail,
+	} {
+		if v != "" {
+			resp.Contact[key] = v
+		}
 	}
 
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Cache-Control", "no-cache, must-revalidate")
-	c.JSON(http.StatusOK, resp)
+	var areas []config.SpaceArea
+	decodeSpaceJSON(sp, "projects", sp.Projects, &resp.Projects)
+	decodeSpaceJSON(sp, "links", sp.Links, &resp.Links)
+	decodeSpaceJSON(sp, "feeds", sp.Feeds, &resp.Feeds)
+	decodeSpaceJSON(sp, "sensors", sp.Sensors, &resp.Sensors)
+	decodeSpaceJSON(sp, "membership_plans", sp.MembershipPlans, &resp.MembershipPlans)
+	decodeSpaceJSON(sp, "areas", sp.Areas, &areas)
+	decodeSpaceJSON(sp, "spacefed", sp.SpaceFed, &resp.SpaceFed)
+	if len(areas) > 0 {
+		resp.Location["areas"] = areas
+	}
+	for _, r := range readings {
+		if resp.Sensors == nil {
+			resp.Sensors = map[string]any{}
+		}
+		entries, _ := resp.Sensors[r.Kind].([]any)
+		resp.Sensors[r.Kind] = append(entries, spaceAPISensor(r))
+	}
+	return resp
+}
+
+// decodeSpaceJSON unmarshals one of the JSON-encoded Space columns into dst,
+// logging rather than failing so a bad column degrades a single section.
+func decodeSpaceJSON(sp *database.Space, field, raw string, dst any) {
+	if raw == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(raw), dst); err != nil {
+		slog.Error("decode space setting", "space", sp.Slug, "field", field, "error", err)
+	}
 }
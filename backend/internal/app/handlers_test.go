@@ -15,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/metro-olografix/sede/internal/config"
 	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/spaceapi"
 )
 
 const (
@@ -99,9 +100,18 @@ func setupTestApp(t *testing.T) (*App, func()) {
 	return app, cleanup
 }
 
+func mustSpace(t *testing.T, app *App, slug string) *database.Space {
+	t.Helper()
+	sp, ok := app.spaces.Lookup(slug)
+	if !ok {
+		t.Fatalf("space %q not loaded", slug)
+	}
+	return sp
+}
+
 func createTestStatusFor(t *testing.T, app *App, spaceID uint, isOpen bool, timestamp time.Time) {
 	t.Helper()
-	if err := app.repo.CreateStatus(context.Background(), database.SedeStatus{
+	if err := app.repo.CreateStatus(context.Background(), &database.SedeStatus{
 		SpaceID:   spaceID,
 		IsOpen:    isOpen,
 		Timestamp: timestamp,
@@ -131,8 +141,8 @@ func TestGetStatus_PerSpace(t *testing.T) {
 	defer cleanup()
 	router := app.setupRouter()
 
-	pescaraID := app.spaces["pescara"].ID
-	aquilaID := app.spaces["aquila"].ID
+	pescaraID := mustSpace(t, app, "pescara").ID
+	aquilaID := mustSpace(t, app, "aquila").ID
 	createTestStatusFor(t, app, pescaraID, true, time.Now().UTC())
 	createTestStatusFor(t, app, aquilaID, false, time.Now().UTC())
 
@@ -169,7 +179,7 @@ func TestLegacyAlias_MatchesDefault(t *testing.T) {
 	defer cleanup()
 	router := app.setupRouter()
 
-	createTestStatusFor(t, app, app.defaultSpace.ID, true, time.Now().UTC())
+	createTestStatusFor(t, app, app.spaces.Default().ID, true, time.Now().UTC())
 
 	for _, p := range []string{"/status", "/stats", "/spaceapi.json"} {
 		legacy := doReq(router, "GET", p, "", nil)
@@ -221,7 +231,7 @@ func TestToggleStatus_FlipsOnlyTargetSpace(t *testing.T) {
 		t.Fatalf("pescara toggle failed: %d %s", w.Code, w.Body.String())
 	}
 
-	pescara, err := app.repo.GetLatestStatus(context.Background(), app.spaces["pescara"].ID)
+	pescara, err := app.repo.GetLatestStatus(context.Background(), mustSpace(t, app, "pescara").ID)
 	if err != nil {
 		t.Fatalf("get pescara: %v", err)
 	}
@@ -229,11 +239,37 @@ func TestToggleStatus_FlipsOnlyTargetSpace(t *testing.T) {
 		t.Error("pescara should be open after toggle")
 	}
 
-	if _, err := app.repo.GetLatestStatus(context.Background(), app.spaces["aquila"].ID); err == nil {
+	if _, err := app.repo.GetLatestStatus(context.Background(), mustSpace(t, app, "aquila").ID); err == nil {
 		t.Error("aquila should have no rows after pescara-only toggle")
 	}
 }
 
+func TestToggleStatus_RecordsAttribution(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+	ctx := context.Background()
+
+	if _, err := app.repo.CreateMember(ctx, "Mario", database.NewCard{UID: "0102", Hash: "h"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, []byte(`{"cardId":"01:02","hash":"h"}`)); w.Code != http.StatusOK {
+		t.Fatalf("toggle with card: %d %s", w.Code, w.Body.String())
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, []byte(`{}`)); w.Code != http.StatusOK {
+		t.Fatalf("toggle without card: %d %s", w.Code, w.Body.String())
+	}
+
+	pescara, _ := app.repo.GetLatestStatus(ctx, mustSpace(t, app, "pescara").ID)
+	if pescara.Source != database.SourceButton || pescara.ActorName != "Mario" || pescara.CardHash != cardIDHash("0102") || pescara.CardHash == "" {
+		t.Errorf("pescara: %+v", pescara)
+	}
+	aquila, _ := app.repo.GetLatestStatus(ctx, mustSpace(t, app, "aquila").ID)
+	if aquila.Source != database.SourceAPI || aquila.CardHash != "" || aquila.ActorName != "" {
+		t.Errorf("aquila: %+v", aquila)
+	}
+}
+
 func TestToggleStatus_CooldownIsPerSpace(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
@@ -274,7 +310,7 @@ func TestGetSpaceAPI_PerSpaceMetadata(t *testing.T) {
 	router := app.setupRouter()
 
 	testTime := time.Now().UTC().Truncate(time.Second)
-	createTestStatusFor(t, app, app.spaces["pescara"].ID, true, testTime)
+	createTestStatusFor(t, app, mustSpace(t, app, "pescara").ID, true, testTime)
 
 	w := doReq(router, "GET", "/s/pescara/spaceapi.json", "", nil)
 	if w.Code != http.StatusOK {
@@ -317,6 +353,106 @@ func TestGetSpaceAPI_PerSpaceMetadata(t *testing.T) {
 	}
 }
 
+func TestGetSpaceAPI_V15Sections(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", `    message: Pescara welcomes you
+    icon:
+      open: https://pescara.example/open.png
+      closed: https://pescara.example/closed.png
+    feeds:
+      calendar:
+        type: ical
+        url: https://pescara.example/calendar.ics
+    sensors:
+      temperature:
+        - value: 21.5
+          unit: "°C"
+          location: sala
+    membership_plans:
+      - name: Socio
+        value: 50
+        currency: EUR
+        billing_interval: yearly
+    areas:
+      - name: Sala
+        square_meters: 80
+    spacefed:
+      spacenet: false
+      spacesaml: false
+`)
+	editSpacesYAML(t, app, "      email: pescara@example.org\n", "      email: pescara@example.org\n      matrix: \"#sede:example.org\"\n")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	w := doReq(app.setupRouter(), "GET", "/s/pescara/spaceapi.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d", w.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := spaceapi.Validate(doc); err != nil {
+		t.Fatalf("served document is not valid v15: %v", err)
+	}
+
+	var resp SpaceAPIResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.State.Icon == nil || resp.State.Icon.Open != "https://pescara.example/open.png" {
+		t.Errorf("icon: %+v", resp.State.Icon)
+	}
+	if resp.Contact["matrix"] != "#sede:example.org" {
+		t.Errorf("contact: %v", resp.Contact)
+	}
+	if _, ok := resp.Contact["irc"]; ok {
+		t.Error("unset contact fields should be omitted")
+	}
+	if resp.Feeds["calendar"].URL != "https://pescara.example/calendar.ics" {
+		t.Errorf("feeds: %+v", resp.Feeds)
+	}
+	if _, ok := resp.Sensors["temperature"]; !ok {
+		t.Errorf("sensors: %+v", resp.Sensors)
+	}
+	if len(resp.MembershipPlans) != 1 || resp.MembershipPlans[0].Currency != "EUR" {
+		t.Errorf("membership_plans: %+v", resp.MembershipPlans)
+	}
+	if _, ok := resp.Location["areas"]; !ok {
+		t.Errorf("location.areas missing: %+v", resp.Location)
+	}
+	if resp.SpaceFed == nil {
+		t.Error("spacefed missing")
+	}
+
+	// Minimal spaces (aquila has no extras) are valid too.
+	w = doReq(app.setupRouter(), "GET", "/s/aquila/spaceapi.json", "", nil)
+	var minimal map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &minimal)
+	if err := spaceapi.Validate(minimal); err != nil {
+		t.Errorf("minimal document is not valid v15: %v", err)
+	}
+}
+
+func TestLoadSpaces_RejectsInvalidSpaceAPIDocument(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", `    message: Pescara welcomes you
+    membership_plans:
+      - name: Socio
+        value: 50
+        currency: euro
+        billing_interval: yearly
+`)
+	err := app.ReloadSpaces()
+	if err == nil || !strings.Contains(err.Error(), "spaceapi v15") {
+		t.Fatalf("expected schema error, got %v", err)
+	}
+	if _, err := NewApp(app.config); err == nil {
+		t.Error("boot should fail on an invalid SpaceAPI document")
+	}
+}
+
 func TestGetStats_EmptySpace(t *testing.T) {
 	app, cleanup := setupTestApp(t)
 	defer cleanup()
@@ -367,3 +503,21 @@ func TestUtilityFunctions(t *testing.T) {
 		}
 	})
 }
+
+func TestStatsWindow_FollowsSpaceConfig(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	editSpacesYAML(t, app, "    message: Pescara welcomes you\n", "    message: Pescara welcomes you\n    stats_hours:\n      from: 7\n      to: 23\n")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	w := statsWindow(mustSpace(t, app, "pescara"))
+	if w.Location.String() != "Europe/Rome" || w.FromHour != 7 || w.ToHour != 23 {
+		t.Errorf("pescara window: %+v", w)
+	}
+	w = statsWindow(mustSpace(t, app, "aquila"))
+	if w.Location.String() != "Europe/Rome" || w.FromHour != 9 || w.ToHour != 21 {
+		t.Errorf("aquila should use the default hours: %+v", w)
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/history"
+)
+
+// getHistoryCSV streams the space's full status history in the format of
+// `sede export`, so it can be fed to `sede import` on another instance.
+// It includes who toggled, hence the API key requirement.
+func (a *App) getHistoryCSV(c *gin.Context) {
+	sp := spaceFrom(c)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-history.csv"`, sp.Slug))
+	w, err := history.NewWriter(c.Writer, history.FormatCSV)
+	if err == nil {
+		err = a.repo.EachStatus(ctx, sp.ID, func(s database.SedeStatus) error {
+			return w.Write(statusRecord(sp, s))
+		})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	// Nothing reaches the client until the CSV writer's buffer fills, so
+	// early failures can still get a proper error response.
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		handleDatabaseError(c, err)
+		return
+	}
+	slog.ErrorContext(ctx, "history export interrupted", "space", sp.Slug, "error", err)
+}
+
+func statusRecord(sp *database.Space, s database.SedeStatus) history.Record {
+	return history.Record{
+		Space:     sp.Slug,
+		Timestamp: s.Timestamp,
+		Open:      s.IsOpen,
+		Reason:    s.Reason,
+		Actor:     s.ActorName,
+		Source:    s.Source,
+		ClientIP:  s.ClientIP,
+		CardHash:  s.CardHash,
+	}
+}
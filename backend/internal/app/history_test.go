@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/history"
+)
+
+func TestGetHistoryCSV(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	seedSessions(t, app)
+	router := app.setupRouter()
+
+	for _, tc := range []struct {
+		name, key string
+		want      int
+	}{
+		{"no key", "", http.StatusUnauthorized},
+		{"other space's key", aquilaKey, http.StatusUnauthorized},
+		{"own key", pescaraKey, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doReq(router, "GET", "/s/pescara/history.csv", tc.key, nil)
+			if w.Code != tc.want {
+				t.Fatalf("code %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+
+	w := doReq(router, "GET", "/s/pescara/history.csv", pescaraKey, nil)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// The body is what `sede import` reads.
+	r, err := history.NewReader(w.Body, history.FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []history.Record
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 6 {
+		t.Fatalf("got %d records, want 6", len(recs))
+	}
+	first := history.Record{Space: "pescara", Timestamp: time.Date(2024, 5, 6, 18, 0, 0, 0, time.UTC), Open: true, Actor: "=Mario",
+		Source: "button", ClientIP: "10.0.0.7", CardHash: "9f86d081"}
+	if recs[0] != first {
+		t.Errorf("first record = %+v, want %+v", recs[0], first)
+	}
+	if recs[1].Open || recs[1].Reason != "gelatino" {
+		t.Errorf("second record = %+v", recs[1])
+	}
+}
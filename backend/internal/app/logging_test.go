@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/metro-olografix/sede/internal/logging"
+)
+
+// captureLogs routes the default slog logger to a buffer at debug level for
+// the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestRequestID_PropagatesToRepositoryLogs(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+	buf := captureLogs(t)
+
+	r := httptest.NewRequest("GET", "/s/pescara/status", nil)
+	r.Header.Set(logging.RequestIDHeader, "probe-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if got := w.Header().Get(logging.RequestIDHeader); got != "probe-1" {
+		t.Errorf("echoed request id %q", got)
+	}
+
+	var query, access bool
+	for _, rec := range logRecords(t, buf) {
+		if rec["request_id"] != "probe-1" {
+			continue
+		}
+		switch rec["msg"] {
+		case "query":
+			query = true
+		case "request":
+			access = rec["route"] == "/s/:slug/status"
+		}
+	}
+	if !query || !access {
+		t.Errorf("query logged: %v, access logged: %v\n%s", query, access, buf.String())
+	}
+}
+
+func TestRequestID_GeneratedWhenMissingOrUnsafe(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	for _, h := range []string{"", "bad id\r\nX-Injected: 1"} {
+		r := httptest.NewRequest("GET", "/s/pescara/status", nil)
+		if h != "" {
+			r.Header.Set(logging.RequestIDHeader, h)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if got := w.Header().Get(logging.RequestIDHeader); len(got) != 32 {
+			t.Errorf("header %q: got request id %q", h, got)
+		}
+	}
+}
+
+func TestLogSecurityEvent_CarriesSpaceAndClientIP(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+	buf := captureLogs(t)
+
+	r := httptest.NewRequest("POST", "/s/aquila/toggle", strings.NewReader("{}"))
+	r.Header.Set("X-API-KEY", pescaraKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("want 401, got %d", w.Code)
+	}
+	for _, rec := range logRecords(t, buf) {
+		if rec["security"] == true {
+			if rec["level"] != "WARN" || rec["space"] != "aquila" || rec["client_ip"] != "192.0.2.1" || rec["request_id"] == nil {
+				t.Errorf("security record: %v", rec)
+			}
+			return
+		}
+	}
+	t.Errorf("no security record:\n%s", buf.String())
+}
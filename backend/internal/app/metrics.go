@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// appMetrics are the series exposed on /metrics. Each App has its own
+// registry rather than using the global one, so tests can build many apps.
+type appMetrics struct {
+	registry       *prometheus.Registry
+	httpDuration   *prometheus.HistogramVec
+	statusChanges  *prometheus.CounterVec
+	rateLimited    prometheus.Counter
+	authFailures   *prometheus.CounterVec
+	notifyFailures *prometheus.CounterVec
+	dbDuration     *prometheus.HistogramVec
+}
+
+func newAppMetrics(a *App) *appMetrics {
+	m := &appMetrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "sede_http_request_duration_seconds",
+			Help:    "HTTP request latency by route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		statusChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sede_status_changes_total",
+			Help: "Recorded status changes by space, new state and reason.",
+		}, []string{"space", "state", "reason"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sede_rate_limited_requests_total",
+			Help: "Requests rejected by the per-IP rate limiter.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sede_auth_failures_total",
+			Help: "Rejected credentials by realm (api_key, admin, metrics).",
+		}, []string{"realm"}),
+		notifyFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sede_notification_failures_total",
+			Help: "Notifications that could not be delivered, by space and backend.",
+		}, []string{"space", "notifier"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "sede_db_query_duration_seconds",
+			Help:    "Database statement latency by GORM operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.statusChanges,
+		m.rateLimited,
+		m.authFailures,
+		m.notifyFailures,
+		m.dbDuration,
+		spaceStateCollector{app: a},
+	)
+	return m
+}
+
+var (
+	spaceOpenDesc = prometheus.NewDesc("sede_space_open",
+		"1 if the space is currently open, 0 otherwise.", []string{"space"}, nil)
+	spaceLastChangeDesc = prometheus.NewDesc("sede_space_last_change_timestamp_seconds",
+		"Unix time of the space's latest status change.", []string{"space"}, nil)
+)
+
+// spaceStateCollector reads every space's open state from the database at
+// scrape time rather than mirroring it in memory, so the gauges stay right
+// across restarts and instances sharing the DB.
+type spaceStateCollector struct {
+	app *App
+}
+
+func (c spaceStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- spaceOpenDesc
+	ch <- spaceLastChangeDesc
+}
+
+func (c spaceStateCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.app.spaceStates() {
+		open := 0.0
+		if s.status.IsOpen {
+			open = 1
+		}
+		ch <- prometheus.MustNewConstMetric(spaceOpenDesc, prometheus.GaugeValue, open, s.slug)
+		if !s.status.Timestamp.IsZero() {
+			ch <- prometheus.MustNewConstMetric(spaceLastChangeDesc, prometheus.GaugeValue, float64(s.status.Timestamp.Unix()), s.slug)
+		}
+	}
+}
+
+type spaceState struct {
+	slug   string
+	status database.SedeStatus // zero if the space has no history
+}
+
+// spaceStates loads the latest status of every space. Errors are logged and
+// yield a partial result: a scrape should not fail because one query did.
+func (a *App) spaceStates() []spaceState {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	spaces, err := a.repo.ListSpaces(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "metrics: list spaces", "error", err)
+		return nil
+	}
+	out := make([]spaceState, 0, len(spaces))
+	for _, sp := range spaces {
+		status, err := a.repo.GetLatestStatus(ctx, sp.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.ErrorContext(ctx, "metrics: latest status", "space", sp.Slug, "error", err)
+			continue
+		}
+		out = append(out, spaceState{slug: sp.Slug, status: status})
+	}
+	return out
+}
+
+// metricsMiddleware times every request by its route template, so /s/:slug
+// paths don't explode the label set. Event streams are skipped: their
+// duration is the length of the subscription, not a latency.
+func (a *App) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		a.metrics.httpDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeStatusChange counts a recorded change. The reason comes from the
+// client, so only the reasons the server knows get their own label; normal
+// toggles carry none and are labelled "none", anything else "other".
+func (m *appMetrics) observeStatusChange(sp *database.Space, status *database.SedeStatus) {
+	state := "closed"
+	if status.IsOpen {
+		state = "open"
+	}
+	var reason string
+	switch status.Reason {
+	case "":
+		reason = "none"
+	case reasonGelatino, reasonAuto, reasonAdmin:
+		reason = status.Reason
+	default:
+		reason = "other"
+	}
+	m.statusChanges.WithLabelValues(sp.Slug, state, reason).Inc()
+}
+
+// rejectAuth counts a failed authentication in realm and aborts with 401.
+func (a *App) rejectAuth(c *gin.Context, realm string) {
+	a.metrics.authFailures.WithLabelValues(realm).Inc()
+	abortUnauthorized(c)
+}
+
+func (a *App) getMetrics(c *gin.Context) {
+	promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
+}
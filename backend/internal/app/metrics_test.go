@@ -0,0 +1,114 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+)
+
+func TestGetMetrics_ExposesAppSeries(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, body); w.Code != http.StatusOK {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", pescaraKey, body); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key: %d", w.Code)
+	}
+	doReq(router, "GET", "/s/pescara/status", "", nil)
+
+	w := doReq(router, "GET", "/metrics", "", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("code %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	out := w.Body.String()
+	for _, want := range []string{
+		`sede_space_open{space="aquila"} 0`,
+		`sede_space_open{space="pescara"} 1`,
+		`sede_space_last_change_timestamp_seconds{space="pescara"} `,
+		`sede_status_changes_total{reason="none",space="pescara",state="open"} 1`,
+		`sede_auth_failures_total{realm="api_key"} 1`,
+		`sede_http_request_duration_seconds_count{method="GET",route="/s/:slug/status",status="200"} 1`,
+		`sede_db_query_duration_seconds_count{operation="create"} `,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics lack %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `sede_space_last_change_timestamp_seconds{space="aquila"}`) {
+		t.Error("a space without history has no last change")
+	}
+}
+
+func TestObserveStatusChange_BoundedReasons(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	pescara := mustSpace(t, app, "pescara")
+
+	for _, reason := range []string{"", "gelatino", "auto", "admin", "pizza", "pizza-2", "x" + strings.Repeat("y", 100)} {
+		app.metrics.observeStatusChange(pescara, &database.SedeStatus{Reason: reason})
+	}
+	for reason, want := range map[string]float64{"none": 1, "gelatino": 1, "auto": 1, "admin": 1, "other": 3} {
+		if got := testutil.ToFloat64(app.metrics.statusChanges.WithLabelValues("pescara", "closed", reason)); got != want {
+			t.Errorf("reason %q: %v, want %v", reason, got, want)
+		}
+	}
+	if n := testutil.CollectAndCount(app.metrics.statusChanges); n != 5 {
+		t.Errorf("%d series, want 5", n)
+	}
+}
+
+func TestGetMetrics_CountsRateLimitedRequests(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.rateLimiter = limiter.New(memory.NewStore(), limiter.Rate{Period: time.Minute, Limit: 1})
+	router := app.setupRouter()
+
+	doReq(router, "GET", "/s/pescara/status", "", nil)
+	if w := doReq(router, "GET", "/s/pescara/status", "", nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("want 429, got %d", w.Code)
+	}
+	if got := testutil.ToFloat64(app.metrics.rateLimited); got != 1 {
+		t.Errorf("rate limited: %v", got)
+	}
+}
+
+func TestGetMetrics_BearerToken(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	app.config.MetricsToken = "metrics-token-123456"
+	router := app.setupRouter()
+
+	scrape := func(auth string) int {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := scrape(""); code != http.StatusUnauthorized {
+		t.Errorf("no token: %d", code)
+	}
+	if code := scrape("Bearer wrong-token-123456"); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: %d", code)
+	}
+	if code := scrape("Bearer metrics-token-123456"); code != http.StatusOK {
+		t.Errorf("right token: %d", code)
+	}
+	if got := testutil.ToFloat64(app.metrics.authFailures.WithLabelValues("metrics")); got != 2 {
+		t.Errorf("metrics auth failures: %v", got)
+	}
+}
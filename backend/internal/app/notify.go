@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/notification"
+)
+
+const notifyTimeout = 15 * time.Second
+
+// notifiersFor builds the notifiers enabled for sp: the legacy telegram
+// chat/thread columns first, then every entry of its notifiers list.
+// Entries that fail to build are logged and skipped; they were already
+// validated when the space was loaded.
+func (a *App) notifiersFor(sp *database.Space) []notification.Notifier {
+	var out []notification.Notifier
+
+	if sp.TelegramChatID != 0 {
+		n, err := a.notifiers.Build("telegram", notification.Settings{
+			"chat_id":   strconv.FormatInt(sp.TelegramChatID, 10),
+			"thread_id": strconv.Itoa(sp.TelegramThread),
+		})
+		if err != nil {
+			slog.Error("telegram notifier", "space", sp.Slug, "error", err)
+		} else {
+			out = append(out, n)
+		}
+	}
+
+	if sp.Notifiers == "" {
+		return out
+	}
+	var defs []config.NotifierDef
+	if err := json.Unmarshal([]byte(sp.Notifiers), &defs); err != nil {
+		slog.Error("decode notifiers", "space", sp.Slug, "error", err)
+		return out
+	}
+	for _, d := range defs {
+		n, err := a.notifiers.Build(d.Type, d.Settings)
+		if err != nil {
+			slog.Error("build notifier", "space", sp.Slug, "error", err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// notify fans ev out to every notifier of sp in the background. Each backend
+// gets its own goroutine and timeout so a slow SMTP server cannot delay the
+// Telegram message. Messages are public posts on several backends, so they
+// leave out the name when the space hides them.
+func (a *App) notify(sp *database.Space, ev StatusEvent) {
+	ev = publicStatusEvent(sp, ev)
+	msg := notification.Event{
+		Slug:      sp.Slug,
+		Space:     sp.Name,
+		Open:      ev.Open,
+		Reason:    ev.Reason,
+		By:        ev.By,
+		Timestamp: ev.Timestamp,
+	}
+	a.deliver(sp, msg)
+}
+
+// deliver sends msg through every notifier of sp, each in its own
+// goroutine.
+func (a *App) deliver(sp *database.Space, msg notification.Event) {
+	for _, n := range a.notifiersFor(sp) {
+		go func(n notification.Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, msg); err != nil {
+				slog.WarnContext(ctx, "notification failed", "space", sp.Slug, "notifier", n.Type(), "error", err)
+				a.metrics.notifyFailures.WithLabelValues(sp.Slug, n.Type()).Inc()
+			}
+		}(n)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifiersFor_TelegramColumnsPlusConfiguredBackends(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	pescara := mustSpace(t, app, "pescara")
+	pescara.Notifiers = `[{"type":"discord","settings":{"webhook_url":"https://discord.example/api/webhooks/1/x"}},{"type":"bogus","settings":{}}]`
+
+	var types []string
+	for _, n := range app.notifiersFor(pescara) {
+		types = append(types, n.Type())
+	}
+	// chat_id 1001 from the fixture YAML, then discord; the unknown backend
+	// is skipped rather than breaking the others.
+	if len(types) != 2 || types[0] != "telegram" || types[1] != "discord" {
+		t.Errorf("pescara notifiers: %v", types)
+	}
+
+	// aquila has telegram chat_id 0 and no notifiers list.
+	if got := app.notifiersFor(mustSpace(t, app, "aquila")); len(got) != 0 {
+		t.Errorf("aquila should have no notifiers, got %d", len(got))
+	}
+}
+
+func TestNewApp_RejectsInvalidNotifierSettings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := baseCfg(t, dir)
+	cfg.SpacesConfigPath = writeYAML(t, dir, `spaces:
+  - slug: pescara
+    name: Pescara
+    lat: 42.45
+    lon: 14.22
+    api_key: pescara-key-1234567890
+    notifiers:
+      - type: matrix
+        homeserver: https://matrix.example
+`)
+	if _, err := NewApp(cfg); err == nil {
+		t.Fatal("expected boot failure on incomplete matrix settings")
+	}
+}
+
+func TestNotify_HideNames(t *testing.T) {
+	messages := make(chan string, 2)
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		messages <- body["content"]
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer discord.Close()
+
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	aquila := mustSpace(t, app, "aquila")
+	aquila.Notifiers = `[{"type":"discord","settings":{"webhook_url":"` + discord.URL + `"}}]`
+	ev := StatusEvent{Space: "aquila", Open: true, By: "Mario", Timestamp: time.Now().UTC()}
+
+	next := func() string {
+		t.Helper()
+		select {
+		case m := <-messages:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+			return ""
+		}
+	}
+	app.notify(aquila, ev)
+	if m := next(); !strings.Contains(m, "Mario") {
+		t.Errorf("name missing without hide_names: %q", m)
+	}
+	aquila.HideNames = true
+	app.notify(aquila, ev)
+	if m := next(); strings.Contains(m, "Mario") {
+		t.Errorf("hide_names leaked the name: %q", m)
+	}
+}
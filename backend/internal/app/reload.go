@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce coalesces the burst of events editors and ConfigMap
+// updates produce for a single save (truncate, write, chmod, rename).
+const reloadDebounce = 500 * time.Millisecond
+
+// ReloadSpaces re-reads spaces.yaml, upserts the result and swaps the lookup
+// map and default space in one step. On any error the running config is
+// kept and the error returned for the caller to log.
+func (a *App) ReloadSpaces() error {
+	a.spacesWriteMu.Lock()
+	defer a.spacesWriteMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	spaces, ds, err := a.syncSpaces(ctx)
+	if err != nil {
+		return err
+	}
+	a.spaces.Replace(spaces, ds.Slug)
+	slog.Info("spaces config reloaded", "spaces", len(spaces), "default", ds.Slug)
+	return nil
+}
+
+// watchSpacesConfig reloads spaces whenever SpacesConfigPath changes, until
+// ctx is cancelled. It watches the parent directory rather than the file:
+// editors that save via rename and Kubernetes ConfigMap symlink swaps both
+// replace the inode, which would silently end a watch on the file itself.
+func (a *App) watchSpacesConfig(ctx context.Context) {
+	path := a.config.SpacesConfigPath
+	if path == "" {
+		return
+	}
+	target := filepath.Clean(path)
+	dir := filepath.Dir(target)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("spaces config watcher disabled", "error", err)
+		return
+	}
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		slog.Warn("spaces config watcher disabled", "dir", dir, "error", err)
+		return
+	}
+
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if !affectsSpacesConfig(ev, target) {
+				continue
+			}
+			timer.Reset(reloadDebounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("spaces config watcher", "error", err)
+		case <-timer.C:
+			if err := a.ReloadSpaces(); err != nil {
+				slog.Error("spaces config reload failed, keeping previous config", "error", err)
+			}
+		}
+	}
+}
+
+// affectsSpacesConfig reports whether ev may have changed the file at
+// target. Besides the file itself, ConfigMap mounts update through a
+// "..data" symlink swap that never touches the visible file name.
+func affectsSpacesConfig(ev fsnotify.Event, target string) bool {
+	if ev.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(ev.Name)
+	return name == target || filepath.Base(name) == "..data"
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gorm.io/gorm"
+)
+
+// editSpacesYAML rewrites the test spaces.yaml replacing old with new.
+func editSpacesYAML(t *testing.T, app *App, old, new string) {
+	t.Helper()
+	path := app.config.SpacesConfigPath
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), old) {
+		t.Fatalf("spaces.yaml does not contain %q", old)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(raw), old, new, 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadSpaces_AppliesChanges(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	before, _ := app.spaces.Lookup("pescara")
+
+	editSpacesYAML(t, app, "message: Pescara welcomes you", "message: Chiusi per ferie")
+	editSpacesYAML(t, app, "thread_id: 11", "thread_id: 42")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	sp, _ := app.spaces.Lookup("pescara")
+	if sp.Message != "Chiusi per ferie" || sp.TelegramThread != 42 {
+		t.Errorf("reload not applied: %+v", sp)
+	}
+	if sp.ID != before.ID {
+		t.Errorf("space id changed across reload: %d -> %d", before.ID, sp.ID)
+	}
+	if before.Message != "Pescara welcomes you" {
+		t.Error("previously cached space was mutated in place")
+	}
+	if app.spaces.Default() != sp {
+		t.Error("default space not swapped")
+	}
+
+	stored, err := app.repo.GetSpaceBySlug(context.Background(), "pescara")
+	if err != nil || stored.Message != "Chiusi per ferie" {
+		t.Errorf("reload not persisted: %v %+v", err, stored)
+	}
+}
+
+func TestReloadSpaces_KeepsAdminEdits(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	w := doAdmin(router, "POST", "/admin/spaces/aquila/rotate-key", adminToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body.String())
+	}
+	var rotated AdminSpace
+	_ = json.Unmarshal(w.Body.Bytes(), &rotated)
+	if w := doAdmin(router, "PATCH", "/admin/spaces/aquila", adminToken, map[string]any{"message": "Chiusi per ferie"}); w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+
+	editSpacesYAML(t, app, "address: Via Test 1", "address: Via Test 2")
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, body); w.Code != http.StatusUnauthorized {
+		t.Errorf("old key accepted after reload: %d", w.Code)
+	}
+	if w := doReq(router, "POST", "/s/aquila/toggle", rotated.APIKey, body); w.Code != http.StatusOK {
+		t.Errorf("rotated key rejected after reload: %d", w.Code)
+	}
+	sp := mustSpace(t, app, "aquila")
+	if sp.Message != "Chiusi per ferie" || sp.Address != "Via Test 2" {
+		t.Errorf("after reload: message %q, address %q", sp.Message, sp.Address)
+	}
+}
+
+func TestReloadSpaces_DropsSpacesRemovedFromFile(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	if w := doAdmin(router, "POST", "/admin/spaces", adminToken, map[string]any{
+		"slug": "teramo", "name": "Metro Olografix Teramo", "lat": 42.66, "lon": 13.7,
+	}); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	raw, err := os.ReadFile(app.config.SpacesConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pescaraOnly := string(raw[:strings.Index(string(raw), "  - slug: aquila")])
+	if err := os.WriteFile(app.config.SpacesConfigPath, []byte(pescaraOnly), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.ReloadSpaces(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if w := doReq(router, "GET", "/s/aquila/spaceapi.json", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("space removed from the file still served: %d", w.Code)
+	}
+	if _, err := app.repo.GetSpaceBySlug(context.Background(), "aquila"); err == nil {
+		t.Error("space removed from the file still in the DB")
+	}
+	if w := doReq(router, "GET", "/s/teramo/spaceapi.json", "", nil); w.Code != http.StatusOK {
+		t.Errorf("space created through the admin API dropped: %d", w.Code)
+	}
+}
+
+func TestReloadSpaces_FailureRollsBackTheWholeFile(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	// pescara changes and aquila goes away, but deleting aquila fails
+	// after pescara was already synced.
+	editSpacesYAML(t, app, "message: Pescara welcomes you", "message: half applied")
+	raw, err := os.ReadFile(app.config.SpacesConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pescaraOnly := string(raw[:strings.Index(string(raw), "  - slug: aquila")])
+	if err := os.WriteFile(app.config.SpacesConfigPath, []byte(pescaraOnly), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = app.repo.Db.Callback().Delete().Before("gorm:delete").Register("test:fail_delete", func(db *gorm.DB) {
+		if db.Statement.Table == "spaces" {
+			db.AddError(errors.New("disk full"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.ReloadSpaces(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	stored, err := app.repo.GetSpaceBySlug(context.Background(), "pescara")
+	if err != nil || stored.Message != "Pescara welcomes you" {
+		t.Errorf("pescara in the DB after the failed reload: %+v, %v", stored, err)
+	}
+	if _, err := app.repo.GetSpaceBySlug(context.Background(), "aquila"); err != nil {
+		t.Errorf("aquila in the DB after the failed reload: %v", err)
+	}
+	if w := doReq(router, "GET", "/s/aquila/spaceapi.json", "", nil); w.Code != http.StatusOK {
+		t.Errorf("aquila no longer served: %d", w.Code)
+	}
+}
+
+func TestReloadSpaces_InvalidConfigKeepsPrevious(t *testing.T) {
+	for name, edit := range map[string][2]string{
+		"validation":     {"lat: 42.454657", "lat: 420"},
+		"bad yaml":       {"spaces:", "spaces: ["},
+		"notifier setup": {"    telegram:\n      chat_id: 1001", "    notifiers:\n      - type: matrix\n    telegram:\n      chat_id: 1001"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			app, cleanup := setupTestApp(t)
+			defer cleanup()
+			editSpacesYAML(t, app, "message: Pescara welcomes you", "message: should not apply")
+			editSpacesYAML(t, app, edit[0], edit[1])
+
+			if err := app.ReloadSpaces(); err == nil {
+				t.Fatal("expected reload error")
+			}
+			sp, _ := app.spaces.Lookup("pescara")
+			if sp.Message != "Pescara welcomes you" {
+				t.Errorf("cache changed despite failed reload: %q", sp.Message)
+			}
+			stored, _ := app.repo.GetSpaceBySlug(context.Background(), "pescara")
+			if stored.Message != "Pescara welcomes you" {
+				t.Errorf("DB changed despite failed reload: %q", stored.Message)
+			}
+		})
+	}
+}
+
+func TestWatchSpacesConfig_ReloadsOnWrite(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.watchSpacesConfig(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Give the watcher a moment to register before the first write.
+	time.Sleep(100 * time.Millisecond)
+	editSpacesYAML(t, app, "message: Pescara welcomes you", "message: ricaricato")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if sp, _ := app.spaces.Lookup("pescara"); sp.Message == "ricaricato" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("watcher did not reload spaces.yaml")
+}
+
+func TestAffectsSpacesConfig(t *testing.T) {
+	target := filepath.Join("/etc", "sede", "spaces.yaml")
+	for _, c := range []struct {
+		ev   fsnotify.Event
+		want bool
+	}{
+		{fsnotify.Event{Name: target, Op: fsnotify.Write}, true},
+		{fsnotify.Event{Name: target, Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: target, Op: fsnotify.Chmod}, false},
+		{fsnotify.Event{Name: "/etc/sede/..data", Op: fsnotify.Create}, true},
+		{fsnotify.Event{Name: "/etc/sede/other.yaml", Op: fsnotify.Write}, false},
+	} {
+		if got := affectsSpacesConfig(c.ev, target); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.ev, got, c.want)
+		}
+	}
+}
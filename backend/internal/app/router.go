@@ -3,12 +3,15 @@ package app
 import (
 	"errors"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
 	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/logging"
+	"github.com/metro-olografix/sede/ui"
 	"gorm.io/gorm"
 )
 
@@ -22,9 +25,9 @@ func (a *App) setupRouter() *gin.Engine {
 	r := gin.New()
 
 	corsConfig := cors.Config{
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "X-API-KEY", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "X-API-KEY", "Authorization", "Last-Event-ID", logging.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", logging.RequestIDHeader, "X-Truncated"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
@@ -36,76 +39,119 @@ func (a *App) setupRouter() *gin.Engine {
 	}
 
 	r.Use(
-		gin.Recovery(),
+		a.requestIDMiddleware(),
+		a.recoveryMiddleware(),
+		a.accessLogMiddleware(),
+		a.metricsMiddleware(),
 		a.secureMiddleware(),
 		a.rateLimitMiddleware(),
 		cors.New(corsConfig),
 	)
 
-	if a.config.Debug {
-		r.Use(gin.Logger())
-	}
-
 	// Legacy bare routes — resolve to the default space so existing clients
 	// (ESP32 button, MCP server, deployed integrations) keep working.
 	r.GET("/status", a.resolveDefaultSpace(), a.getStatus)
 	r.GET("/stats", a.resolveDefaultSpace(), a.getStats)
 	r.GET("/spaceapi.json", a.resolveDefaultSpace(), a.getSpaceAPI)
-	r.POST("/toggle", a.resolveDefaultSpace(), a.authMiddleware(), a.toggleStatus)
+	r.POST("/toggle", a.resolveDefaultSpace(), a.authMiddleware(database.ScopeStatusWrite), a.toggleStatus)
 
 	sg := r.Group("/s/:slug", a.resolveSpaceFromPath())
 	{
 		sg.GET("/status", a.getStatus)
 		sg.GET("/stats", a.getStats)
 		sg.GET("/spaceapi.json", a.getSpaceAPI)
-		sg.POST("/toggle", a.authMiddleware(), a.toggleStatus)
+		sg.GET("/events", a.streamEvents)
+		sg.POST("/toggle", a.authMiddleware(database.ScopeStatusWrite), a.toggleStatus)
+		sg.POST("/sensors", a.authMiddleware(database.ScopeSensorsWrite), a.pushSensors)
+		sg.POST("/heartbeat", a.authMiddleware(scopeHeartbeat), a.heartbeat)
+		sg.GET("/sensors/history", a.getSensorHistory)
+		sg.GET("/sessions", a.getSessions)
+		sg.GET("/calendar.ics", a.getCalendar)
+		sg.GET("/history.csv", a.authMiddleware(database.ScopeStatsRead), a.getHistoryCSV)
 	}
 
-	if a.config.Debug {
-		r.StaticFS("/ui", http.Dir("./ui"))
-		uiHandler := http.StripPrefix("/ui", http.FileServer(http.Dir("./ui")))
-		r.GET("/s/:slug/ui/*filepath", a.resolveSpaceFromPath(), func(c *gin.Context) {
-			c.Request.URL.Path = "/ui" + c.Param("filepath")
-			uiHandler.ServeHTTP(c.Writer, c.Request)
-		})
+	r.GET("/metrics", a.bearerAuthMiddleware("metrics", a.config.MetricsToken), a.getMetrics)
+
+	ag := r.Group("/admin", a.adminAuthMiddleware())
+	{
+		ag.GET("/overview", a.adminOverview)
+		ag.GET("/spaces", a.adminListSpaces)
+		ag.POST("/spaces", a.adminCreateSpace)
+		ag.GET("/spaces/:slug", a.adminGetSpace)
+		ag.PATCH("/spaces/:slug", a.adminUpdateSpace)
+		ag.DELETE("/spaces/:slug", a.adminDeleteSpace)
+		ag.POST("/spaces/:slug/rotate-key", a.adminRotateKey)
+		ag.POST("/spaces/:slug/status", a.adminSetStatus)
+		ag.GET("/spaces/:slug/access-log", a.adminAccessLog)
 	}
 
+	uiFS := a.uiFileSystem()
+	r.StaticFS("/ui", uiFS)
+	uiHandler := http.StripPrefix("/ui", http.FileServer(uiFS))
+	r.GET("/s/:slug/ui/*filepath", a.resolveSpaceFromPath(), func(c *gin.Context) {
+		c.Request.URL.Path = "/ui" + c.Param("filepath")
+		uiHandler.ServeHTTP(c.Writer, c.Request)
+	})
+
 	return r
 }
 
+// uiFileSystem serves the pages embedded in the binary. In debug mode a ./ui
+// directory takes precedence, so the dev compose setup can edit them
+// without rebuilding.
+func (a *App) uiFileSystem() http.FileSystem {
+	if a.config.Debug {
+		if info, err := os.Stat("./ui"); err == nil && info.IsDir() {
+			return http.Dir("./ui")
+		}
+	}
+	return http.FS(ui.FS)
+}
+
 func (a *App) resolveDefaultSpace() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if a.defaultSpace == nil {
+		ds := a.spaces.Default()
+		if ds == nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "default space not configured"})
 			return
 		}
-		c.Set(spaceContextKey, a.defaultSpace)
+		c.Set(spaceContextKey, ds)
 		c.Next()
 	}
 }
 
-// resolveSpaceFromPath resolves :slug via the in-memory hot map; the DB is a
-// fallback only for rows that arrive after boot (future admin API). A missing
-// slug is a flat 404 — we don't distinguish typo vs. truly-absent so the
-// endpoint can't be used to enumerate configured spaces.
+// resolveSpaceFromPath resolves :slug via the space registry; the DB is a
+// fallback only for rows that arrive after boot (e.g. created by another
+// instance sharing the DB), and misses are remembered briefly so unknown
+// slugs don't each cost a query. A missing slug is a flat 404 — we don't
+// distinguish typo vs. truly-absent so the endpoint can't be used to
+// enumerate configured spaces.
 func (a *App) resolveSpaceFromPath() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		slug := c.Param("slug")
-		if sp, ok := a.spaces[slug]; ok {
+		if sp, ok := a.spaces.Lookup(slug); ok {
 			c.Set(spaceContextKey, sp)
 			c.Next()
 			return
 		}
+		if a.spaces.KnownMissing(slug) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "space not found"})
+			return
+		}
+		gen := a.spaces.Generation()
 		sp, err := a.repo.GetSpaceBySlug(c.Request.Context(), slug)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
+				a.spaces.MarkMissing(slug)
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "space not found"})
 				return
 			}
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "space lookup failed"})
 			return
 		}
-		a.spaces[sp.Slug] = sp
+		// If an admin write or reload raced the query, serve this request
+		// with what was read but leave the registry to the writer.
+		a.spaces.StoreIfCurrent(sp, gen)
 		c.Set(spaceContextKey, sp)
 		c.Next()
 	}
@@ -143,6 +189,7 @@ func (a *App) rateLimitMiddleware() gin.HandlerFunc {
 		}
 
 		if limiterCtx.Reached {
+			a.metrics.rateLimited.Inc()
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
 			return
 		}
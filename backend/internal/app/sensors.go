@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/spaceapi"
+)
+
+const (
+	maxReadingsPerPush    = 100
+	defaultHistoryWindow  = 24 * time.Hour
+	defaultHistoryLimit   = 1000
+	maxSensorHistoryLimit = 10000
+)
+
+// sensorKind describes how a SpaceAPI sensor key is stored and rendered.
+type sensorKind struct {
+	defaultUnit string
+	// unitless kinds carry no unit in SpaceAPI; integer ones must hold whole
+	// numbers; boolean ones (door_locked) are stored as 0/1.
+	unitless bool
+	integer  bool
+	boolean  bool
+}
+
+// sensorKinds lists the scalar SpaceAPI v15 sensors a device can push.
+// Structured ones (wind, radiation, network_*) are only available as static
+// entries in spaces.yaml.
+var sensorKinds = map[string]sensorKind{
+	"temperature":        {defaultUnit: "°C"},
+	"humidity":           {defaultUnit: "%"},
+	"carbondioxide":      {defaultUnit: "ppm"},
+	"barometer":          {defaultUnit: "hPa"},
+	"beverage_supply":    {defaultUnit: "btl"},
+	"power_consumption":  {defaultUnit: "W"},
+	"power_generation":   {defaultUnit: "W"},
+	"account_balance":    {},
+	"total_member_count": {unitless: true, integer: true},
+	"people_now_present": {unitless: true, integer: true},
+	"door_locked":        {unitless: true, boolean: true},
+}
+
+// SensorReadingInput is one reading in a POST /s/{slug}/sensors body. Value
+// is a number, or a boolean for door_locked. Unit defaults per kind.
+type SensorReadingInput struct {
+	Kind     string `json:"kind"`
+	Value    any    `json:"value"`
+	Unit     string `json:"unit,omitempty"`
+	Location string `json:"location,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+type PushSensorsRequest struct {
+	Readings []SensorReadingInput `json:"readings"`
+}
+
+// SensorReadingView is one row of the history endpoint.
+type SensorReadingView struct {
+	Kind      string    `json:"kind"`
+	Location  string    `json:"location,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Unit      string    `json:"unit,omitempty"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// pushSensors stores a batch of readings from the space's device. The batch
+// is rejected as a whole if any reading is malformed or would make the
+// published SpaceAPI document invalid (e.g. an unknown unit).
+func (a *App) pushSensors(c *gin.Context) {
+	sp := spaceFrom(c)
+
+	var req PushSensorsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if len(req.Readings) == 0 || len(req.Readings) > maxReadingsPerPush {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("readings must hold 1 to %d entries", maxReadingsPerPush)})
+		return
+	}
+
+	now := time.Now().UTC()
+	readings := make([]database.SensorReading, 0, len(req.Readings))
+	for i, in := range req.Readings {
+		r, err := sensorReadingFromInput(in)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("readings[%d]: %v", i, err)})
+			return
+		}
+		r.SpaceID = sp.ID
+		r.Timestamp = now
+		readings = append(readings, r)
+	}
+	if err := spaceapi.Validate(newSpaceAPIResponse(sp, nil, readings)); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	if err := a.repo.CreateSensorReadings(ctx, readings); handleDatabaseError(c, err) {
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"stored": len(readings)})
+}
+
+// getSensorHistory returns readings for charts, oldest first. Query
+// parameters: kind (optional), since and until (RFC 3339, default the last
+// 24 hours) and limit (default 1000, max 10000). Over the limit it returns
+// the newest readings and sets X-Truncated.
+func (a *App) getSensorHistory(c *gin.Context) {
+	sp := spaceFrom(c)
+
+	until := time.Now().UTC()
+	if v := c.Query("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "until must be an RFC 3339 timestamp"})
+			return
+		}
+		until = t.UTC()
+	}
+	since := until.Add(-defaultHistoryWindow)
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		since = t.UTC()
+	}
+	if !since.Before(until) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "since must be before until"})
+		return
+	}
+	kind := c.Query("kind")
+	if _, ok := sensorKinds[kind]; kind != "" && !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown sensor kind"})
+		return
+	}
+	limit := defaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSensorHistoryLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSensorHistoryLimit)})
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	rows, truncated, err := a.repo.ListSensorReadings(ctx, sp.ID, kind, since, until, limit)
+	if handleDatabaseError(c, err) {
+		return
+	}
+	if truncated {
+		c.Header("X-Truncated", "true")
+	}
+	out := make([]SensorReadingView, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, SensorReadingView{
+			Kind:      r.Kind,
+			Location:  r.Location,
+			Name:      r.Name,
+			Unit:      r.Unit,
+			Value:     r.Value,
+			Timestamp: r.Timestamp,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func sensorReadingFromInput(in SensorReadingInput) (database.SensorReading, error) {
+	kind, ok := sensorKinds[in.Kind]
+	if !ok {
+		return database.SensorReading{}, fmt.Errorf("unknown sensor kind %q", in.Kind)
+	}
+
+	var value float64
+	switch v := in.Value.(type) {
+	case float64:
+		if kind.boolean && v != 0 && v != 1 {
+			return database.SensorReading{}, fmt.Errorf("%s value must be true/false or 0/1", in.Kind)
+		}
+		value = v
+	case bool:
+		if !kind.boolean {
+			return database.SensorReading{}, fmt.Errorf("%s value must be a number", in.Kind)
+		}
+		if v {
+			value = 1
+		}
+	default:
+		return database.SensorReading{}, fmt.Errorf("%s value is required", in.Kind)
+	}
+	if kind.integer && value != math.Trunc(value) {
+		return database.SensorReading{}, fmt.Errorf("%s value must be a whole number", in.Kind)
+	}
+
+	unit := in.Unit
+	if kind.unitless {
+		unit = ""
+	} else if unit == "" {
+		unit = kind.defaultUnit
+	}
+	return database.SensorReading{
+		Kind:     in.Kind,
+		Location: in.Location,
+		Name:     in.Name,
+		Unit:     unit,
+		Value:    value,
+	}, nil
+}
+
+// spaceAPISensor renders a stored reading as a SpaceAPI sensor entry.
+func spaceAPISensor(r database.SensorReading) map[string]any {
+	kind := sensorKinds[r.Kind]
+	entry := map[string]any{"lastchange": r.Timestamp.Unix()}
+	switch {
+	case kind.boolean:
+		entry["value"] = r.Value != 0
+	case kind.integer:
+		entry["value"] = int64(r.Value)
+	default:
+		entry["value"] = r.Value
+	}
+	if r.Unit != "" {
+		entry["unit"] = r.Unit
+	}
+	if r.Location != "" {
+		entry["location"] = r.Location
+	}
+	if r.Name != "" {
+		entry["name"] = r.Name
+	}
+	return entry
+}
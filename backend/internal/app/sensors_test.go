@@ -0,0 +1,190 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/spaceapi"
+)
+
+func pushBody(t *testing.T, readings ...SensorReadingInput) []byte {
+	t.Helper()
+	body, err := json.Marshal(PushSensorsRequest{Readings: readings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestPushSensors_StoresReadings(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	body := pushBody(t,
+		SensorReadingInput{Kind: "temperature", Value: 21.5, Location: "sala"},
+		SensorReadingInput{Kind: "people_now_present", Value: 3},
+		SensorReadingInput{Kind: "door_locked", Value: true, Location: "ingresso"},
+	)
+	w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("push: %d %s", w.Code, w.Body.String())
+	}
+
+	var rows []database.SensorReading
+	if err := app.repo.Db.Order("id asc").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("want 3 rows, got %+v", rows)
+	}
+	pescara := mustSpace(t, app, "pescara")
+	if rows[0].SpaceID != pescara.ID || rows[0].Unit != "°C" || rows[0].Timestamp.IsZero() {
+		t.Errorf("temperature row: %+v", rows[0])
+	}
+	if rows[2].Value != 1 {
+		t.Errorf("door_locked should be stored as 1, got %v", rows[2].Value)
+	}
+}
+
+func TestPushSensors_RequiresSpaceKey(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	body := pushBody(t, SensorReadingInput{Kind: "people_now_present", Value: 1})
+	for _, key := range []string{"", aquilaKey} {
+		if w := doReq(router, "POST", "/s/pescara/sensors", key, body); w.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: want 401, got %d", key, w.Code)
+		}
+	}
+}
+
+func TestPushSensors_RejectsInvalidReadings(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	for name, in := range map[string]SensorReadingInput{
+		"unknown kind":      {Kind: "wind", Value: 3, Location: "tetto"},
+		"missing value":     {Kind: "temperature", Location: "sala"},
+		"string value":      {Kind: "temperature", Value: "21", Location: "sala"},
+		"bad unit":          {Kind: "temperature", Value: 21, Unit: "C", Location: "sala"},
+		"missing location":  {Kind: "temperature", Value: 21},
+		"fractional people": {Kind: "people_now_present", Value: 1.5},
+		"negative people":   {Kind: "people_now_present", Value: -1},
+		"door not boolean":  {Kind: "door_locked", Value: 2, Location: "ingresso"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, pushBody(t, in))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("want 400, got %d %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, pushBody(t)); w.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: want 400, got %d", w.Code)
+	}
+	var n int64
+	app.repo.Db.Model(&database.SensorReading{}).Count(&n)
+	if n != 0 {
+		t.Errorf("rejected batches must not be stored, found %d rows", n)
+	}
+}
+
+func TestGetSpaceAPI_PublishesLatestReadings(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	for _, v := range []float64{19, 22.5} {
+		body := pushBody(t, SensorReadingInput{Kind: "temperature", Value: v, Location: "sala"})
+		if w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, body); w.Code != http.StatusCreated {
+			t.Fatalf("push: %d %s", w.Code, w.Body.String())
+		}
+	}
+	body := pushBody(t, SensorReadingInput{Kind: "people_now_present", Value: 4})
+	if w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, body); w.Code != http.StatusCreated {
+		t.Fatalf("push: %d %s", w.Code, w.Body.String())
+	}
+
+	w := doReq(router, "GET", "/s/pescara/spaceapi.json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d", w.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := spaceapi.Validate(doc); err != nil {
+		t.Fatalf("served document is not valid v15: %v", err)
+	}
+
+	sensors, _ := doc["sensors"].(map[string]any)
+	temps, _ := sensors["temperature"].([]any)
+	if len(temps) != 1 {
+		t.Fatalf("want one temperature series, got %v", sensors["temperature"])
+	}
+	temp := temps[0].(map[string]any)
+	if temp["value"] != 22.5 || temp["unit"] != "°C" || temp["location"] != "sala" || temp["lastchange"] == nil {
+		t.Errorf("temperature: %v", temp)
+	}
+	if !strings.Contains(w.Body.String(), `"people_now_present":[{"lastchange":`) {
+		t.Errorf("people_now_present missing: %s", w.Body.String())
+	}
+
+	// Readings are per space.
+	w = doReq(router, "GET", "/s/aquila/spaceapi.json", "", nil)
+	if strings.Contains(w.Body.String(), "sensors") {
+		t.Errorf("aquila should have no sensors: %s", w.Body.String())
+	}
+}
+
+func TestGetSensorHistory(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	body := pushBody(t,
+		SensorReadingInput{Kind: "temperature", Value: 20, Location: "sala"},
+		SensorReadingInput{Kind: "humidity", Value: 55, Location: "sala"},
+	)
+	if w := doReq(router, "POST", "/s/pescara/sensors", pescaraKey, body); w.Code != http.StatusCreated {
+		t.Fatalf("push: %d %s", w.Code, w.Body.String())
+	}
+
+	w := doReq(router, "GET", "/s/pescara/sensors/history?kind=humidity", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d %s", w.Code, w.Body.String())
+	}
+	var got []SensorReadingView
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Kind != "humidity" || got[0].Value != 55 || got[0].Unit != "%" {
+		t.Errorf("history: %+v", got)
+	}
+
+	if w.Header().Get("X-Truncated") != "" {
+		t.Error("complete history marked truncated")
+	}
+	w = doReq(router, "GET", "/s/pescara/sensors/history?limit=1", "", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 1 || w.Header().Get("X-Truncated") != "true" {
+		t.Errorf("limited history: %+v, X-Truncated %q", got, w.Header().Get("X-Truncated"))
+	}
+
+	w = doReq(router, "GET", "/s/pescara/sensors/history?since=2000-01-01T00:00:00Z&until=2000-01-02T00:00:00Z", "", nil)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("out-of-range window: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, q := range []string{"since=yesterday", "limit=0", "limit=10001", "kind=wind", "since=2030-01-01T00:00:00Z"} {
+		if w := doReq(router, "GET", "/s/pescara/sensors/history?"+q, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d", q, w.Code)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+const (
+	defaultSessionsWindow = 7 * 24 * time.Hour
+	maxSessionsWindow     = 366 * 24 * time.Hour
+	defaultSessionsLimit  = 100
+	maxSessionsLimit      = 1000
+)
+
+// SessionView is one open session as returned by GET /s/{slug}/sessions.
+// Times are in the space's timezone. End is null and Duration counts up to
+// now while the space is still open. OpenedVia and ClosedVia are the
+// source of the opening and closing change; names are left out for spaces
+// with hide_names.
+type SessionView struct {
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	OpenedBy        string     `json:"opened_by,omitempty"`
+	OpenedVia       string     `json:"opened_via,omitempty"`
+	ClosedBy        string     `json:"closed_by,omitempty"`
+	ClosedVia       string     `json:"closed_via,omitempty"`
+	CloseReason     string     `json:"close_reason,omitempty"`
+}
+
+type SessionsPage struct {
+	Sessions []SessionView `json:"sessions"`
+	Total    int           `json:"total"`
+	Offset   int           `json:"offset"`
+	Limit    int           `json:"limit"`
+}
+
+// getSessions lists the open sessions overlapping [from, to) for attendance
+// reports. from and to are RFC 3339 timestamps or YYYY-MM-DD dates in the
+// space's timezone (default: the last 7 days); offset and limit page
+// through the result. format=csv, or Accept: text/csv, returns CSV with the
+// total in X-Total-Count.
+func (a *App) getSessions(c *gin.Context) {
+	sp := spaceFrom(c)
+	loc := statsWindow(sp).Location
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		t, err := parseSessionTime(v, loc)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp or a YYYY-MM-DD date"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultSessionsWindow)
+	if v := c.Query("from"); v != "" {
+		t, err := parseSessionTime(v, loc)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp or a YYYY-MM-DD date"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) || to.Sub(from) > maxSessionsWindow {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "from must be before to, at most 366 days apart"})
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultSessionsLimit, 1, maxSessionsLimit)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), contextTimeout)
+	defer cancel()
+
+	sessions, err := a.repo.ListSessions(ctx, sp.ID, from.UTC(), to.UTC())
+	if handleDatabaseError(c, err) {
+		return
+	}
+	hideSessionNames(sp, sessions)
+
+	page := SessionsPage{Sessions: []SessionView{}, Total: len(sessions), Offset: offset, Limit: limit}
+	now := time.Now()
+	for i := offset; i < len(sessions) && i < offset+limit; i++ {
+		page.Sessions = append(page.Sessions, newSessionView(sessions[i], loc, now))
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	if c.Query("format") == "csv" || (c.Query("format") == "" && c.NegotiateFormat(gin.MIMEJSON, "text/csv") == "text/csv") {
+		writeSessionsCSV(c, sp, page.Sessions)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func newSessionView(s database.Session, loc *time.Location, now time.Time) SessionView {
+	v := SessionView{
+		Start:       s.Start.In(loc),
+		OpenedBy:    s.OpenedBy,
+		OpenedVia:   s.OpenedVia,
+		ClosedBy:    s.ClosedBy,
+		ClosedVia:   s.ClosedVia,
+		CloseReason: s.CloseReason,
+	}
+	end := now
+	if s.End != nil {
+		e := s.End.In(loc)
+		v.End = &e
+		end = e
+	}
+	v.DurationSeconds = int64(end.Sub(s.Start).Seconds())
+	return v
+}
+
+func writeSessionsCSV(c *gin.Context, sp *database.Space, sessions []SessionView) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-sessions.csv"`, sp.Slug))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"start", "end", "duration_seconds", "opened_by", "closed_by", "close_reason", "opened_via", "closed_via"})
+	for _, s := range sessions {
+		end := ""
+		if s.End != nil {
+			end = s.End.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			s.Start.Format(time.RFC3339),
+			end,
+			strconv.FormatInt(s.DurationSeconds, 10),
+			csvSafe(s.OpenedBy),
+			csvSafe(s.ClosedBy),
+			csvSafe(s.CloseReason),
+			s.OpenedVia,
+			s.ClosedVia,
+		})
+	}
+	w.Flush()
+}
+
+// hideSessionNames drops who opened and closed each session when sp keeps
+// names off the public endpoints.
+func hideSessionNames(sp *database.Space, sessions []database.Session) {
+	if !sp.HideNames {
+		return
+	}
+	for i := range sessions {
+		sessions[i].OpenedBy, sessions[i].ClosedBy = "", ""
+	}
+}
+
+// csvSafe stops spreadsheet apps from evaluating names or reasons that start
+// like a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseSessionTime accepts an RFC 3339 timestamp or a date, taken as local
+// midnight in loc.
+func parseSessionTime(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, loc)
+}
+
+// queryInt reads an integer query parameter within [lo, hi], aborting with
+// 400 when it is malformed.
+func queryInt(c *gin.Context, name string, def, lo, hi int) (int, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < lo || n > hi {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be between %d and %d", name, lo, hi)})
+		return 0, false
+	}
+	return n, true
+}
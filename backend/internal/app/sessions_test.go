@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+// seedSessions creates three closed sessions for pescara on 6-8 May 2024,
+// 18:00-20:00 UTC, the first one opened by a card.
+func seedSessions(t *testing.T, app *App) {
+	t.Helper()
+	id := mustSpace(t, app, "pescara").ID
+	for d := 6; d <= 8; d++ {
+		open := database.SedeStatus{SpaceID: id, IsOpen: true, Timestamp: time.Date(2024, 5, d, 18, 0, 0, 0, time.UTC)}
+		if d == 6 {
+			open.ActorName = "=Mario"
+			open.Source, open.ClientIP, open.CardHash = database.SourceButton, "10.0.0.7", "9f86d081"
+		}
+		closed := database.SedeStatus{SpaceID: id, IsOpen: false, Reason: "gelatino", Timestamp: time.Date(2024, 5, d, 20, 0, 0, 0, time.UTC)}
+		for _, s := range []*database.SedeStatus{&open, &closed} {
+			if err := app.repo.CreateStatus(context.Background(), s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestGetSessions_JSONPaging(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	seedSessions(t, app)
+	router := app.setupRouter()
+
+	w := doReq(router, "GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31&limit=2", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code %d %s", w.Code, w.Body.String())
+	}
+	var page SessionsPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Sessions) != 2 || w.Header().Get("X-Total-Count") != "3" {
+		t.Fatalf("page: %+v", page)
+	}
+	s := page.Sessions[0]
+	// 18:00 UTC is 20:00 in Rome (CEST).
+	if s.Start.Format(time.RFC3339) != "2024-05-06T20:00:00+02:00" || s.End == nil || s.DurationSeconds != 7200 {
+		t.Errorf("session: %+v", s)
+	}
+	if s.OpenedBy != "=Mario" || s.CloseReason != "gelatino" {
+		t.Errorf("session actors: %+v", s)
+	}
+
+	w = doReq(router, "GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31&limit=2&offset=2", "", nil)
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Sessions) != 1 || page.Sessions[0].Start.Day() != 8 {
+		t.Errorf("second page: %+v", page)
+	}
+
+	// aquila has no history.
+	w = doReq(router, "GET", "/s/aquila/sessions?from=2024-05-01&to=2024-05-31", "", nil)
+	if !strings.Contains(w.Body.String(), `"sessions":[]`) {
+		t.Errorf("aquila: %s", w.Body.String())
+	}
+}
+
+func TestGetSessions_CSV(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	seedSessions(t, app)
+	router := app.setupRouter()
+
+	check := func(w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("code %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+		}
+		records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 4 || records[0][0] != "start" {
+			t.Fatalf("records: %v", records)
+		}
+		if records[1][2] != "7200" || records[1][5] != "gelatino" {
+			t.Errorf("row: %v", records[1])
+		}
+		if records[1][3] != "'=Mario" {
+			t.Errorf("formula-like names must be escaped, got %q", records[1][3])
+		}
+	}
+
+	check(doReq(router, "GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31&format=csv", "", nil))
+
+	req, _ := http.NewRequest("GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	check(w)
+}
+
+func TestGetSessions_HideNames(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	seedSessions(t, app)
+	router := app.setupRouter()
+	pescara := mustSpace(t, app, "pescara")
+
+	if err := app.repo.CreateStatus(context.Background(), &database.SedeStatus{
+		SpaceID: pescara.ID, IsOpen: true, ActorName: "Luigi", Source: database.SourceButton,
+		Timestamp: time.Date(2024, 5, 9, 18, 0, 0, 0, time.UTC),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var page SessionsPage
+	w := doReq(router, "GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31", "", nil)
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Sessions) != 4 || page.Sessions[3].OpenedBy != "Luigi" || page.Sessions[3].OpenedVia != database.SourceButton {
+		t.Fatalf("sessions: %+v", page.Sessions)
+	}
+
+	pescara.HideNames = true
+	w = doReq(router, "GET", "/s/pescara/sessions?from=2024-05-01&to=2024-05-31", "", nil)
+	if strings.Contains(w.Body.String(), "Mario") || strings.Contains(w.Body.String(), "Luigi") {
+		t.Errorf("names leaked: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"opened_via":"button"`) {
+		t.Errorf("source should stay visible: %s", w.Body.String())
+	}
+	w = doReq(router, "GET", "/s/pescara/calendar.ics", "", nil)
+	if strings.Contains(w.Body.String(), "Luigi") {
+		t.Errorf("calendar leaked a name: %s", w.Body.String())
+	}
+}
+
+func TestGetSessions_RejectsBadQuery(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	for _, q := range []string{
+		"from=last-week",
+		"from=2024-05-10&to=2024-05-01",
+		"from=2020-01-01&to=2024-01-01",
+		"limit=0",
+		"limit=1001",
+		"offset=-1",
+	} {
+		if w := doReq(router, "GET", "/s/pescara/sessions?"+q, "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d", q, w.Code)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+const (
+	// negativeCacheTTL bounds how long an unknown slug is answered from
+	// memory. Short enough that a space created by another instance sharing
+	// the DB shows up quickly.
+	negativeCacheTTL = 30 * time.Second
+	// negativeCacheSize caps the number of remembered misses so scanning
+	// random slugs cannot grow memory without bound.
+	negativeCacheSize = 1024
+)
+
+// spaceSnapshot is an immutable view of the registry. Readers load it with a
+// single atomic read and never lock; writers build a new one with gen
+// incremented.
+type spaceSnapshot struct {
+	bySlug      map[string]*database.Space
+	defaultSlug string
+	gen         uint64
+}
+
+// SpaceRegistry is the in-memory slug -> space lookup used on every request.
+// Reads are lock-free against a copy-on-write snapshot; writes (admin API,
+// config reloads, lazy DB fills) copy the map under a mutex and publish the
+// copy atomically. Cached *database.Space values are never mutated in
+// place, so a request holding one keeps a consistent view.
+//
+// A lazy DB fill reads Generation before its query and caches the result
+// with StoreIfCurrent, so a row read just before an admin delete or update
+// cannot overwrite the newer state once the query returns.
+//
+// The registry also remembers slugs recently found absent from the DB, so
+// floods of requests for an unknown space don't each cost a query.
+type SpaceRegistry struct {
+	snap atomic.Pointer[spaceSnapshot]
+	mu   sync.Mutex // serialises writers of snap
+
+	missMu sync.Mutex
+	misses map[string]time.Time // slug -> expiry
+	now    func() time.Time
+}
+
+func NewSpaceRegistry() *SpaceRegistry {
+	r := &SpaceRegistry{
+		misses: make(map[string]time.Time),
+		now:    time.Now,
+	}
+	r.snap.Store(&spaceSnapshot{bySlug: map[string]*database.Space{}})
+	return r
+}
+
+// Lookup returns the cached space for slug.
+func (r *SpaceRegistry) Lookup(slug string) (*database.Space, bool) {
+	sp, ok := r.snap.Load().bySlug[slug]
+	return sp, ok
+}
+
+// Default returns the space the bare legacy routes resolve to, or nil before
+// the first Replace.
+func (r *SpaceRegistry) Default() *database.Space {
+	s := r.snap.Load()
+	return s.bySlug[s.defaultSlug]
+}
+
+// Generation identifies the current contents; any write changes it.
+func (r *SpaceRegistry) Generation() uint64 {
+	return r.snap.Load().gen
+}
+
+// Len returns the number of cached spaces.
+func (r *SpaceRegistry) Len() int {
+	return len(r.snap.Load().bySlug)
+}
+
+// All returns the cached spaces sorted by slug.
+func (r *SpaceRegistry) All() []*database.Space {
+	bySlug := r.snap.Load().bySlug
+	out := make([]*database.Space, 0, len(bySlug))
+	for _, sp := range bySlug {
+		out = append(out, sp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slug < out[j].Slug })
+	return out
+}
+
+// Replace swaps in a whole new set of spaces at once, as done at boot and on
+// config reload. defaultSlug must be a key of spaces. Remembered misses are
+// dropped since any of them may now exist.
+func (r *SpaceRegistry) Replace(spaces map[string]*database.Space, defaultSlug string) {
+	bySlug := make(map[string]*database.Space, len(spaces))
+	for slug, sp := range spaces {
+		bySlug[slug] = sp
+	}
+
+	r.mu.Lock()
+	r.snap.Store(&spaceSnapshot{bySlug: bySlug, defaultSlug: defaultSlug, gen: r.snap.Load().gen + 1})
+	r.mu.Unlock()
+
+	r.missMu.Lock()
+	clear(r.misses)
+	r.missMu.Unlock()
+}
+
+// Store caches sp under its slug, replacing any previous entry, and forgets
+// a remembered miss for it.
+func (r *SpaceRegistry) Store(sp *database.Space) {
+	r.mu.Lock()
+	r.store(sp)
+	r.mu.Unlock()
+
+	r.missMu.Lock()
+	delete(r.misses, sp.Slug)
+	r.missMu.Unlock()
+}
+
+// StoreIfCurrent is Store for a space read from the DB while the registry
+// was at generation gen. It stores nothing and returns false if any write
+// happened since, as sp may predate it.
+func (r *SpaceRegistry) StoreIfCurrent(sp *database.Space, gen uint64) bool {
+	r.mu.Lock()
+	if r.snap.Load().gen != gen {
+		r.mu.Unlock()
+		return false
+	}
+	r.store(sp)
+	r.mu.Unlock()
+
+	r.missMu.Lock()
+	delete(r.misses, sp.Slug)
+	r.missMu.Unlock()
+	return true
+}
+
+// store publishes a snapshot with sp added; r.mu must be held.
+func (r *SpaceRegistry) store(sp *database.Space) {
+	cur := r.snap.Load()
+	next := make(map[string]*database.Space, len(cur.bySlug)+1)
+	for slug, v := range cur.bySlug {
+		next[slug] = v
+	}
+	next[sp.Slug] = sp
+	r.snap.Store(&spaceSnapshot{bySlug: next, defaultSlug: cur.defaultSlug, gen: cur.gen + 1})
+}
+
+// Invalidate drops slug from the cache so the next request re-reads it from
+// the DB. It counts as a write even if slug wasn't cached, so a lazy fill
+// already in flight for it is discarded.
+func (r *SpaceRegistry) Invalidate(slug string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur := r.snap.Load()
+	next := cur.bySlug
+	if _, ok := cur.bySlug[slug]; ok {
+		next = make(map[string]*database.Space, len(cur.bySlug))
+		for s, v := range cur.bySlug {
+			if s != slug {
+				next[s] = v
+			}
+		}
+	}
+	r.snap.Store(&spaceSnapshot{bySlug: next, defaultSlug: cur.defaultSlug, gen: cur.gen + 1})
+}
+
+// KnownMissing reports whether slug was recently looked up in the DB and not
+// found.
+func (r *SpaceRegistry) KnownMissing(slug string) bool {
+	r.missMu.Lock()
+	defer r.missMu.Unlock()
+	exp, ok := r.misses[slug]
+	if !ok {
+		return false
+	}
+	if r.now().After(exp) {
+		delete(r.misses, slug)
+		return false
+	}
+	return true
+}
+
+// MarkMissing remembers that slug does not exist for negativeCacheTTL.
+func (r *SpaceRegistry) MarkMissing(slug string) {
+	r.missMu.Lock()
+	defer r.missMu.Unlock()
+	now := r.now()
+	if len(r.misses) >= negativeCacheSize {
+		for s, exp := range r.misses {
+			if now.After(exp) {
+				delete(r.misses, s)
+			}
+		}
+		// Still full of live entries: someone is scanning. Start over
+		// rather than track an unbounded set.
+		if len(r.misses) >= negativeCacheSize {
+			clear(r.misses)
+		}
+	}
+	r.misses[slug] = now.Add(negativeCacheTTL)
+}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+	"gorm.io/gorm"
+)
+
+func TestSpaceRegistry_StoreInvalidateReplace(t *testing.T) {
+	r := NewSpaceRegistry()
+	if r.Default() != nil {
+		t.Fatal("empty registry should have no default")
+	}
+
+	pescara := &database.Space{ID: 1, Slug: "pescara"}
+	aquila := &database.Space{ID: 2, Slug: "aquila"}
+	r.Replace(map[string]*database.Space{"pescara": pescara, "aquila": aquila}, "pescara")
+	if r.Default() != pescara || r.Len() != 2 {
+		t.Fatalf("after Replace: default=%v len=%d", r.Default(), r.Len())
+	}
+	if all := r.All(); len(all) != 2 || all[0] != aquila || all[1] != pescara {
+		t.Errorf("All not sorted by slug: %v", all)
+	}
+
+	updated := &database.Space{ID: 1, Slug: "pescara", Message: "new"}
+	r.Store(updated)
+	if got, _ := r.Lookup("pescara"); got != updated {
+		t.Error("Store did not replace entry")
+	}
+	if r.Default() != updated {
+		t.Error("default should follow the stored entry")
+	}
+
+	r.Invalidate("aquila")
+	if _, ok := r.Lookup("aquila"); ok {
+		t.Error("Invalidate left entry in place")
+	}
+	r.Invalidate("never-there")
+	if r.Len() != 1 {
+		t.Errorf("len = %d", r.Len())
+	}
+}
+
+func TestSpaceRegistry_StoreIfCurrent(t *testing.T) {
+	r := NewSpaceRegistry()
+	r.Replace(map[string]*database.Space{"pescara": {ID: 1, Slug: "pescara"}}, "pescara")
+
+	gen := r.Generation()
+	chieti := &database.Space{ID: 3, Slug: "chieti"}
+	if !r.StoreIfCurrent(chieti, gen) {
+		t.Fatal("fill without concurrent writes was dropped")
+	}
+	if got, _ := r.Lookup("chieti"); got != chieti {
+		t.Error("fill not stored")
+	}
+
+	// A delete lands while another fill's query is running.
+	gen = r.Generation()
+	r.Invalidate("teramo")
+	if r.StoreIfCurrent(&database.Space{ID: 4, Slug: "teramo"}, gen) {
+		t.Error("fill stored after an invalidation")
+	}
+	if _, ok := r.Lookup("teramo"); ok {
+		t.Error("deleted space cached")
+	}
+
+	// An update lands in the same window.
+	gen = r.Generation()
+	updated := &database.Space{ID: 3, Slug: "chieti", Message: "new"}
+	r.Store(updated)
+	if r.StoreIfCurrent(chieti, gen) {
+		t.Error("stale fill stored after an update")
+	}
+	if got, _ := r.Lookup("chieti"); got != updated {
+		t.Error("update overwritten by a stale fill")
+	}
+}
+
+func TestSpaceRegistry_NegativeCache(t *testing.T) {
+	r := NewSpaceRegistry()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+
+	r.MarkMissing("ghost")
+	if !r.KnownMissing("ghost") {
+		t.Fatal("miss not remembered")
+	}
+	clock = clock.Add(negativeCacheTTL + time.Second)
+	if r.KnownMissing("ghost") {
+		t.Error("miss should expire after the TTL")
+	}
+
+	r.MarkMissing("chieti")
+	r.Store(&database.Space{ID: 3, Slug: "chieti"})
+	if r.KnownMissing("chieti") {
+		t.Error("Store must clear a remembered miss")
+	}
+
+	r.MarkMissing("teramo")
+	r.Replace(map[string]*database.Space{}, "")
+	if r.KnownMissing("teramo") {
+		t.Error("Replace must clear remembered misses")
+	}
+
+	for i := 0; i < negativeCacheSize*2; i++ {
+		r.MarkMissing(fmt.Sprintf("scan-%d", i))
+	}
+	r.missMu.Lock()
+	n := len(r.misses)
+	r.missMu.Unlock()
+	if n > negativeCacheSize {
+		t.Errorf("negative cache grew to %d entries", n)
+	}
+}
+
+func TestResolveSpace_RemembersUnknownSlug(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	if w := doReq(router, "GET", "/s/ghost/status", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown slug: %d", w.Code)
+	}
+	if !app.spaces.KnownMissing("ghost") {
+		t.Fatal("miss not cached")
+	}
+
+	// A space that appears in the DB behind our back stays hidden until the
+	// miss expires or the registry is told about it.
+	sp, err := app.repo.CreateSpace(t.Context(), database.Space{Slug: "ghost", Name: "Ghost", APIKeyHash: []byte("h")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := doReq(router, "GET", "/s/ghost/status", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected cached 404, got %d", w.Code)
+	}
+	app.spaces.Store(sp)
+	if w := doReq(router, "GET", "/s/ghost/status", "", nil); w.Code == http.StatusNotFound {
+		t.Error("stored space still 404")
+	}
+}
+
+// TestResolveSpace_ConcurrentRequests hammers the space lookup from many
+// goroutines while writers churn the registry. Run with -race.
+func TestResolveSpace_ConcurrentRequests(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	// Every request comes from the same client IP; lift the per-IP limit so
+	// the test exercises lookups rather than 429s.
+	app.rateLimiter = limiter.New(memory.NewStore(), limiter.Rate{Period: time.Minute, Limit: 1 << 20})
+	router := app.setupRouter()
+	createTestStatusFor(t, app, mustSpace(t, app, "pescara").ID, true, time.Now().UTC())
+	createTestStatusFor(t, app, mustSpace(t, app, "aquila").ID, false, time.Now().UTC())
+
+	const workers, perWorker = 16, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				slug, want := "pescara", true
+				switch (i + j) % 3 {
+				case 1:
+					slug, want = "aquila", false
+				case 2:
+					slug = fmt.Sprintf("missing-%d", j%7)
+				}
+				w := doReq(router, "GET", "/s/"+slug+"/status", "", nil)
+				if slug[0] == 'm' {
+					if w.Code != http.StatusNotFound {
+						errs <- fmt.Errorf("%s: %d", slug, w.Code)
+					}
+					continue
+				}
+				var open bool
+				if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &open) != nil || open != want {
+					errs <- fmt.Errorf("%s: %d %s", slug, w.Code, w.Body.String())
+				}
+			}
+		}(i)
+	}
+
+	// Writers: lazy fills, invalidations and full swaps racing the readers.
+	pescara := mustSpace(t, app, "pescara")
+	aquila := mustSpace(t, app, "aquila")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < perWorker; j++ {
+			app.spaces.Invalidate("aquila")
+			app.spaces.Store(aquila)
+			app.spaces.Replace(map[string]*database.Space{"pescara": pescara, "aquila": aquila}, "pescara")
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestResolveSpace_LazyLoadRacesDelete holds a request's DB fill between
+// its query and caching the result while the admin API deletes the space;
+// the deleted space must not end up cached. Run with -race.
+func TestResolveSpace_LazyLoadRacesDelete(t *testing.T) {
+	app, router, cleanup := setupAdminRouter(t)
+	defer cleanup()
+
+	if w := doAdmin(router, "POST", "/admin/spaces", adminToken, map[string]any{"slug": "chieti", "name": "Chieti"}); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	// As if another instance had created it: only the DB knows it.
+	app.spaces.Invalidate("chieti")
+
+	read, release := make(chan struct{}), make(chan struct{})
+	var pausing atomic.Bool
+	pausing.Store(true)
+	err := app.repo.Db.Callback().Query().After("gorm:query").Register("test:pause_fill", func(db *gorm.DB) {
+		if db.Statement.Table == "spaces" && pausing.CompareAndSwap(true, false) {
+			close(read)
+			<-release
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- doReq(router, "GET", "/s/chieti/spaceapi.json", "", nil).Code
+	}()
+	<-read
+	if w := doAdmin(router, "DELETE", "/admin/spaces/chieti", adminToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("request that read the space before the delete: %d", code)
+	}
+
+	if _, ok := app.spaces.Lookup("chieti"); ok {
+		t.Error("deleted space cached by the fill")
+	}
+	if w := doReq(router, "GET", "/s/chieti/spaceapi.json", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("after delete: %d", w.Code)
+	}
+}
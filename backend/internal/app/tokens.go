@@ -0,0 +1,66 @@
+package app
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/metro-olografix/sede/internal/database"
+	"gorm.io/gorm"
+)
+
+// adminAuthMiddleware guards the admin API. It accepts ADMIN_TOKEN,
+// compared like in bearerAuthMiddleware, or an API token with the admin
+// scope. With neither configured the API answers 404, as if it wasn't
+// mounted.
+func (a *App) adminAuthMiddleware() gin.HandlerFunc {
+	want := sha256.Sum256([]byte(a.config.AdminToken))
+	return func(c *gin.Context) {
+		presented, ok := bearerToken(c)
+		if ok && a.config.AdminToken != "" {
+			got := sha256.Sum256([]byte(presented))
+			if subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+				c.Next()
+				return
+			}
+		}
+		if ok && strings.HasPrefix(presented, database.APITokenPrefix) {
+			tok, err := a.repo.AuthenticateAPIToken(c.Request.Context(), presented, time.Now().UTC())
+			switch {
+			case err == nil && !tok.Allows(database.ScopeAdmin, 0):
+				logSecurityEvent(c, c.Param("slug"), fmt.Sprintf("token %q not allowed on the admin API", tok.Name))
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token not allowed"})
+				return
+			case err == nil:
+				c.Next()
+				return
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				handleDatabaseError(c, err)
+				return
+			}
+		}
+		if a.config.AdminToken == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if ok {
+			logSecurityEvent(c, c.Param("slug"), "invalid admin token attempt")
+		}
+		a.rejectAuth(c, "admin")
+	}
+}
+
+// apiCredential returns the credential of a request to a space's protected
+// routes: the legacy X-API-KEY header or, failing that, a bearer token.
+func apiCredential(c *gin.Context) string {
+	if key := c.GetHeader("X-API-KEY"); key != "" {
+		return key
+	}
+	key, _ := bearerToken(c)
+	return key
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+// createTestToken stores a token with scopes, tied to slug unless it is
+// empty, and returns it in clear.
+func createTestToken(t *testing.T, app *App, name, scopes, slug string) (*database.APIToken, string) {
+	t.Helper()
+	token, err := database.NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := database.APIToken{Name: name, TokenHash: database.APITokenHash(token), Scopes: scopes}
+	if slug != "" {
+		id := mustSpace(t, app, slug).ID
+		tok.SpaceID = &id
+	}
+	if err := app.repo.CreateAPIToken(context.Background(), &tok); err != nil {
+		t.Fatal(err)
+	}
+	return &tok, token
+}
+
+func doBearer(router http.Handler, method, path, token string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPITokens_Scopes(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	_, writer := createTestToken(t, app, "bot", "status:write", "pescara")
+	_, reader := createTestToken(t, app, "grafana", "stats:read", "")
+	expired, expiredToken := createTestToken(t, app, "old", "status:write", "")
+	past := time.Now().UTC().Add(-time.Hour)
+	if err := app.repo.Db.Model(expired).Update("expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, method, path, token string
+		body                      []byte
+		want                      int
+	}{
+		{"bearer toggles", "POST", "/s/pescara/toggle", writer, []byte(`{}`), http.StatusOK},
+		{"other space", "POST", "/s/aquila/toggle", writer, []byte(`{}`), http.StatusForbidden},
+		{"missing scope", "GET", "/s/pescara/history.csv", writer, nil, http.StatusForbidden},
+		{"stats reader, any space", "GET", "/s/aquila/history.csv", reader, nil, http.StatusOK},
+		{"stats reader can't toggle", "POST", "/s/aquila/toggle", reader, []byte(`{}`), http.StatusForbidden},
+		{"tokens don't send heartbeats", "POST", "/s/pescara/heartbeat", writer, nil, http.StatusForbidden},
+		{"expired", "POST", "/s/aquila/toggle", expiredToken, []byte(`{}`), http.StatusUnauthorized},
+		{"space key as bearer", "GET", "/s/pescara/history.csv", pescaraKey, nil, http.StatusOK},
+	} {
+		if w := doBearer(router, tc.method, tc.path, tc.token, tc.body); w.Code != tc.want {
+			t.Errorf("%s: want %d, got %d %s", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	// X-API-KEY takes tokens too.
+	if w := doReq(router, "GET", "/s/pescara/history.csv", reader, nil); w.Code != http.StatusOK {
+		t.Errorf("token in X-API-KEY: %d", w.Code)
+	}
+}
+
+func TestAPITokens_Admin(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	admin, adminTok := createTestToken(t, app, "ops", "admin", "")
+	_, scopedTok := createTestToken(t, app, "pescara-ops", "admin", "pescara")
+	_, writer := createTestToken(t, app, "bot", "status:write", "")
+
+	if w := doAdmin(router, "GET", "/admin/spaces", adminTok, nil); w.Code != http.StatusOK {
+		t.Errorf("admin token without ADMIN_TOKEN: %d %s", w.Code, w.Body.String())
+	}
+	if w := doAdmin(router, "GET", "/admin/spaces", writer, nil); w.Code != http.StatusForbidden {
+		t.Errorf("token without the admin scope: %d", w.Code)
+	}
+	if w := doAdmin(router, "GET", "/admin/spaces", scopedTok, nil); w.Code != http.StatusForbidden {
+		t.Errorf("admin scope tied to a space: %d", w.Code)
+	}
+	if w := doAdmin(router, "GET", "/admin/spaces", "sede_unknown", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown token without ADMIN_TOKEN: %d", w.Code)
+	}
+
+	if err := app.repo.RevokeAPIToken(context.Background(), admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	app.config.AdminToken = adminToken
+	router = app.setupRouter()
+	if w := doAdmin(router, "GET", "/admin/spaces", adminTok, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked admin token: %d", w.Code)
+	}
+	if w := doAdmin(router, "GET", "/admin/spaces", adminToken, nil); w.Code != http.StatusOK {
+		t.Errorf("ADMIN_TOKEN: %d", w.Code)
+	}
+}
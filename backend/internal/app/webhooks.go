@@ -0,0 +1,54 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"github.com/metro-olografix/sede/internal/webhook"
+)
+
+const webhookEventStatusChanged = "status.changed"
+
+// webhookPayload is the JSON body POSTed to every webhook of the space. It is
+// the SSE StatusEvent plus the event name, so receivers can share a decoder.
+type webhookPayload struct {
+	Event string `json:"event"`
+	StatusEvent
+}
+
+// webhookDeliveries builds the outbox rows announcing a status change to
+// every configured webhook of sp, for the repository to write in the same
+// transaction as the status itself; nil if sp has no webhooks. Payloads go
+// to third parties, so they leave out the name when the space hides them.
+func webhookDeliveries(sp *database.Space) database.WebhookDeliveries {
+	if sp.Webhooks == "" {
+		return nil
+	}
+	return func(s *database.SedeStatus) ([]database.WebhookDelivery, error) {
+		var targets []webhook.Target
+		if err := json.Unmarshal([]byte(sp.Webhooks), &targets); err != nil {
+			return nil, fmt.Errorf("decode webhooks of %s: %w", sp.Slug, err)
+		}
+		if len(targets) == 0 {
+			return nil, nil
+		}
+		ev := publicStatusEvent(sp, newStatusEvent(sp, *s))
+		payload, err := json.Marshal(webhookPayload{Event: webhookEventStatusChanged, StatusEvent: ev})
+		if err != nil {
+			return nil, fmt.Errorf("encode webhook payload: %w", err)
+		}
+
+		deliveries := make([]database.WebhookDelivery, 0, len(targets))
+		for _, t := range targets {
+			deliveries = append(deliveries, database.WebhookDelivery{
+				SpaceID:       sp.ID,
+				URL:           t.URL,
+				Event:         webhookEventStatusChanged,
+				Payload:       string(payload),
+				NextAttemptAt: s.Timestamp,
+			})
+		}
+		return deliveries, nil
+	}
+}
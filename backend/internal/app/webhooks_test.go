@@ -0,0 +1,102 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func TestToggleStatus_EnqueuesWebhookDeliveries(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	pescara := mustSpace(t, app, "pescara")
+	pescara.Webhooks = `[{"url":"https://a.example/hook","secret":"x"},{"url":"https://b.example/hook","secret":"y"}]`
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, body); w.Code != http.StatusOK {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+	}
+	// aquila has no webhooks configured.
+	if w := doReq(router, "POST", "/s/aquila/toggle", aquilaKey, body); w.Code != http.StatusOK {
+		t.Fatalf("toggle: %d %s", w.Code, w.Body.String())
+	}
+
+	var deliveries []database.WebhookDelivery
+	if err := app.repo.Db.Order("id asc").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("want 2 deliveries, got %d", len(deliveries))
+	}
+	for i, url := range []string{"https://a.example/hook", "https://b.example/hook"} {
+		d := deliveries[i]
+		if d.URL != url || d.SpaceID != pescara.ID || d.Event != webhookEventStatusChanged {
+			t.Errorf("delivery %d: %+v", i, d)
+		}
+		var p webhookPayload
+		if err := json.Unmarshal([]byte(d.Payload), &p); err != nil {
+			t.Fatalf("payload: %v", err)
+		}
+		if p.Event != webhookEventStatusChanged || p.Space != "pescara" || !p.Open || p.ID == 0 {
+			t.Errorf("payload %d: %+v", i, p)
+		}
+	}
+}
+
+func TestWebhookDeliveries_HideNames(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+
+	pescara := mustSpace(t, app, "pescara")
+	pescara.Webhooks = `[{"url":"https://a.example/hook","secret":"x"}]`
+	status := database.SedeStatus{ID: 1, SpaceID: pescara.ID, IsOpen: true, ActorName: "Mario", Source: database.SourceButton, Timestamp: time.Now().UTC()}
+
+	shownRows, err := webhookDeliveries(pescara)(&status)
+	if err != nil || len(shownRows) != 1 {
+		t.Fatalf("deliveries: %v %v", shownRows, err)
+	}
+	pescara.HideNames = true
+	hiddenRows, err := webhookDeliveries(pescara)(&status)
+	if err != nil || len(hiddenRows) != 1 {
+		t.Fatalf("deliveries: %v %v", hiddenRows, err)
+	}
+
+	var shown, hidden webhookPayload
+	_ = json.Unmarshal([]byte(shownRows[0].Payload), &shown)
+	_ = json.Unmarshal([]byte(hiddenRows[0].Payload), &hidden)
+	if shown.By != "Mario" {
+		t.Errorf("name missing without hide_names: %+v", shown)
+	}
+	if hidden.By != "" || hidden.Source != database.SourceButton {
+		t.Errorf("hide_names payload: %+v", hidden)
+	}
+}
+
+// TestToggleStatus_WebhookOutboxFailureRollsBack checks that a status change
+// is never stored without its webhook deliveries.
+func TestToggleStatus_WebhookOutboxFailureRollsBack(t *testing.T) {
+	app, cleanup := setupTestApp(t)
+	defer cleanup()
+	router := app.setupRouter()
+
+	pescara := mustSpace(t, app, "pescara")
+	pescara.Webhooks = `[{"url":"https://a.example/hook","secret":"x"}]`
+	if err := app.repo.Db.Migrator().DropTable(&database.WebhookDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(ToggleStatusRequest{})
+	if w := doReq(router, "POST", "/s/pescara/toggle", pescaraKey, body); w.Code != http.StatusInternalServerError {
+		t.Fatalf("toggle with a broken outbox: %d %s", w.Code, w.Body.String())
+	}
+	var n int64
+	app.repo.Db.Model(&database.SedeStatus{}).Where("space_id = ?", pescara.ID).Count(&n)
+	if n != 0 {
+		t.Errorf("%d status rows stored without their webhooks", n)
+	}
+}
@@ -0,0 +1,66 @@
+// Package cards resolves the RFID card presented at a space's button to the
+// display name of its holder. Each space picks a backend in spaces.yaml
+// (the Metro Olografix manager API, a local members file, or none), built
+// through a Registry like the notification backends.
+package cards
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/metro-olografix/sede/internal/registry"
+)
+
+// Card is what the device reads: the card UID and the hash that proves
+// the card wasn't just cloned by UID. Space is the slug of the space where
+// it was presented, for backends that scope cards to spaces.
+type Card struct {
+	ID    string
+	Hash  string
+	Space string
+}
+
+// NormalizeID strips the separators some readers put in UIDs and
+// lowercases the rest, so "04-A2-1B" and "04a21b" name the same card.
+func NormalizeID(id string) string {
+	id = strings.ReplaceAll(id, "-", "")
+	id = strings.ReplaceAll(id, ":", "")
+	return strings.ToLower(id)
+}
+
+// ErrUnknownCard reports a card the backend doesn't recognise, as opposed
+// to a backend that couldn't be asked.
+var ErrUnknownCard = errors.New("unknown card")
+
+// Resolver looks up the holder of a card. It returns ErrUnknownCard for
+// cards it doesn't know and other errors when the lookup itself failed.
+type Resolver interface {
+	Resolve(ctx context.Context, card Card) (string, error)
+	Type() string
+}
+
+// Local is implemented by resolvers that answer from data on this instance.
+// They are cheap to ask, so their lookups are not cached unless cache_ttl
+// says otherwise, and a revoked card stops working at once.
+type Local interface {
+	Resolver
+	Local()
+}
+
+// What a toggle does when a card can't be resolved.
+const (
+	// OnErrorReject fails the toggle.
+	OnErrorReject = "reject"
+	// OnErrorAnonymous records the toggle without a name.
+	OnErrorAnonymous = "anonymous"
+)
+
+// Settings is the configuration of a space's card_resolver block.
+type Settings = registry.Settings
+
+// none is the resolver of spaces that don't identify card holders.
+type none struct{}
+
+func (none) Resolve(context.Context, Card) (string, error) { return "", nil }
+func (none) Type() string                                  { return "none" }
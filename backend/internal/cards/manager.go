@@ -0,0 +1,79 @@
+package cards
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultManagerURL is the Metro Olografix manager's card lookup endpoint.
+const DefaultManagerURL = "https://manager.olografix.org/api/card/name"
+
+// maxNameBytes caps how much of the manager's answer is read.
+const maxNameBytes = 1 << 10
+
+// manager asks the association's member manager for the card holder's
+// name: a POST of {"cardId", "hash"} authenticated with X-API-TOKEN,
+// answered with the full name as a JSON string.
+type manager struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func newManagerFactory(client *http.Client) Factory {
+	return func(s Settings) (Resolver, error) {
+		token, err := s.Required("token")
+		if err != nil {
+			return nil, err
+		}
+		url := s["url"]
+		if url == "" {
+			url = DefaultManagerURL
+		}
+		return &manager{client: client, url: url, token: token}, nil
+	}
+}
+
+func (m *manager) Type() string { return "manager" }
+
+func (m *manager) Resolve(ctx context.Context, card Card) (string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"cardId": strings.ReplaceAll(card.ID, "-", ""),
+		"hash":   card.Hash,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-TOKEN", m.token)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrUnknownCard
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("card manager returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxNameBytes))
+	if err != nil {
+		return "", err
+	}
+
+	// Only the first name is shown in notifications.
+	name := strings.Split(strings.TrimSpace(string(body)), " ")[0]
+	return strings.ReplaceAll(name, "\"", ""), nil
+}
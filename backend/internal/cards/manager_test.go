@@ -0,0 +1,60 @@
+package cards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestManager_ResolvesFirstName(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-TOKEN") != "tok" {
+			t.Errorf("token %q", r.Header.Get("X-API-TOKEN"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`"Mario Rossi"`))
+	}))
+	defer srv.Close()
+
+	l, err := NewRegistry(srv.Client()).Build("manager", Settings{"url": srv.URL, "token": "tok"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	name, err := l.Resolve(context.Background(), Card{ID: "04-A2-1B", Hash: "h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Mario" {
+		t.Errorf("name = %q, want Mario", name)
+	}
+	if got["cardId"] != "04A21B" || got["hash"] != "h" {
+		t.Errorf("payload %+v", got)
+	}
+}
+
+func TestManager_Errors(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	l, _ := NewRegistry(srv.Client()).Build("manager", Settings{"url": srv.URL, "token": "tok", "cache_ttl": "0"})
+
+	if _, err := l.Resolve(context.Background(), Card{ID: "x"}); !errors.Is(err, ErrUnknownCard) {
+		t.Errorf("404: err = %v, want ErrUnknownCard", err)
+	}
+	status = http.StatusInternalServerError
+	if _, err := l.Resolve(context.Background(), Card{ID: "x"}); err == nil || errors.Is(err, ErrUnknownCard) {
+		t.Errorf("500: err = %v, want a lookup failure", err)
+	}
+}
+
+func TestManager_RequiresToken(t *testing.T) {
+	if _, err := NewRegistry(http.DefaultClient).Build("manager", Settings{}); err == nil {
+		t.Error("expected missing token to fail the build")
+	}
+}
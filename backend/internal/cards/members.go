@@ -0,0 +1,102 @@
+package cards
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// membersFile resolves cards from a local YAML file, for spaces without
+// access to the manager:
+//
+//	members:
+//	  - card_id: 04-A2-1B-7C
+//	    hash: 9f86d081...   # optional; checked when present
+//	    name: Mario
+//
+// The file is read when the resolver is built and re-read whenever its
+// modification time changes, so members can be added without a reload.
+type membersFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	byID    map[string]memberEntry
+}
+
+type memberEntry struct {
+	CardID string `yaml:"card_id"`
+	Hash   string `yaml:"hash"`
+	Name   string `yaml:"name"`
+}
+
+func newMembersFactory() Factory {
+	return func(s Settings) (Resolver, error) {
+		path, err := s.Required("file")
+		if err != nil {
+			return nil, err
+		}
+		m := &membersFile{path: path}
+		if err := m.reload(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+func (m *membersFile) Type() string { return "members" }
+func (m *membersFile) Local()       {}
+
+func (m *membersFile) Resolve(ctx context.Context, card Card) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.reload(); err != nil {
+		return "", err
+	}
+	e, ok := m.byID[NormalizeID(card.ID)]
+	if !ok || (e.Hash != "" && subtle.ConstantTimeCompare([]byte(e.Hash), []byte(card.Hash)) != 1) {
+		return "", ErrUnknownCard
+	}
+	return e.Name, nil
+}
+
+// reload re-reads the file if it changed since the last read. Callers hold
+// m.mu, except the factory, which owns m exclusively.
+func (m *membersFile) reload() error {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return fmt.Errorf("members file: %w", err)
+	}
+	if m.byID != nil && info.ModTime().Equal(m.modTime) {
+		return nil
+	}
+
+	raw, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("members file: %w", err)
+	}
+	var file struct {
+		Members []memberEntry `yaml:"members"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("members file %s: %w", m.path, err)
+	}
+	byID := make(map[string]memberEntry, len(file.Members))
+	for i, e := range file.Members {
+		if e.CardID == "" || e.Name == "" {
+			return fmt.Errorf("members file %s: members[%d]: card_id and name are required", m.path, i)
+		}
+		id := NormalizeID(e.CardID)
+		if _, dup := byID[id]; dup {
+			return fmt.Errorf("members file %s: duplicate card_id %q", m.path, e.CardID)
+		}
+		byID[id] = e
+	}
+	m.byID, m.modTime = byID, info.ModTime()
+	return nil
+}
@@ -0,0 +1,72 @@
+package cards
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeMembers(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMembersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "members.yaml")
+	writeMembers(t, path, `members:
+  - card_id: 04-A2-1B
+    name: Mario
+  - card_id: 0599
+    hash: secret
+    name: Luigi
+`)
+	l, err := NewRegistry(nil).Build("members", Settings{"file": path})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ctx := context.Background()
+
+	if name, err := l.Resolve(ctx, Card{ID: "04a21b", Hash: "anything"}); err != nil || name != "Mario" {
+		t.Errorf("Mario: %q, %v", name, err)
+	}
+	if name, err := l.Resolve(ctx, Card{ID: "0599", Hash: "secret"}); err != nil || name != "Luigi" {
+		t.Errorf("Luigi: %q, %v", name, err)
+	}
+	if _, err := l.Resolve(ctx, Card{ID: "0599", Hash: "wrong"}); !errors.Is(err, ErrUnknownCard) {
+		t.Errorf("wrong hash: err = %v", err)
+	}
+	if _, err := l.Resolve(ctx, Card{ID: "ffff"}); !errors.Is(err, ErrUnknownCard) {
+		t.Errorf("unknown card: err = %v", err)
+	}
+
+	// Edits are picked up without rebuilding the resolver.
+	writeMembers(t, path, "members:\n  - card_id: ffff\n    name: Peach\n")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if name, err := l.Resolve(ctx, Card{ID: "ffff"}); err != nil || name != "Peach" {
+		t.Errorf("after edit: %q, %v", name, err)
+	}
+}
+
+func TestMembersFile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"missing name": "members:\n  - card_id: 01\n",
+		"duplicate":    "members:\n  - {card_id: 01, name: a}\n  - {card_id: '0-1', name: b}\n",
+		"not yaml":     "members: [",
+	} {
+		path := filepath.Join(dir, "members.yaml")
+		writeMembers(t, path, body)
+		if _, err := NewRegistry(nil).Build("members", Settings{"file": path}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewRegistry(nil).Build("members", Settings{"file": filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
@@ -0,0 +1,125 @@
+package cards
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/registry"
+)
+
+// Defaults for the settings every backend accepts.
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultCacheTTL = 10 * time.Minute
+)
+
+// maxCacheEntries bounds the cache of one space; expired entries are
+// dropped when it is reached.
+const maxCacheEntries = 1024
+
+// Factory builds a Resolver from its settings.
+type Factory = registry.Factory[Resolver]
+
+// Registry maps backend type names to factories, and builds Lookups with
+// the settings every backend accepts.
+type Registry struct {
+	*registry.Registry[Resolver]
+}
+
+// NewRegistry returns a registry with every built-in backend registered.
+func NewRegistry(client *http.Client) *Registry {
+	r := &Registry{registry.New[Resolver]("card resolver")}
+	r.Register("manager", newManagerFactory(client))
+	r.Register("members", newMembersFactory())
+	r.Register("none", func(Settings) (Resolver, error) { return none{}, nil })
+	return r
+}
+
+// Build instantiates a resolver of type typ and wraps it with the settings
+// common to every backend: timeout, cache_ttl (0 disables caching; Local
+// resolvers default to 0) and on_error (reject or anonymous).
+func (r *Registry) Build(typ string, s Settings) (*Lookup, error) {
+	resolver, err := r.Registry.Build(typ, s)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lookup{resolver: resolver, OnError: s["on_error"], cache: make(map[Card]cachedName)}
+	switch l.OnError {
+	case "":
+		l.OnError = OnErrorReject
+	case OnErrorReject, OnErrorAnonymous:
+	default:
+		return nil, r.Wrap(typ, fmt.Errorf("on_error must be %q or %q", OnErrorReject, OnErrorAnonymous))
+	}
+	if l.timeout, err = s.Duration("timeout", DefaultTimeout); err != nil {
+		return nil, r.Wrap(typ, err)
+	}
+	ttl := DefaultCacheTTL
+	if _, ok := resolver.(Local); ok {
+		ttl = 0
+	}
+	if l.ttl, err = s.Duration("cache_ttl", ttl); err != nil {
+		return nil, r.Wrap(typ, err)
+	}
+	return l, nil
+}
+
+// Lookup is a space's configured resolver: a backend bounded by a timeout,
+// with successful lookups cached so a slow or flapping manager costs one
+// request per card per TTL. OnError says what a toggle should do when
+// Resolve fails.
+type Lookup struct {
+	resolver Resolver
+	timeout  time.Duration
+	ttl      time.Duration
+	OnError  string
+
+	mu    sync.Mutex
+	cache map[Card]cachedName
+}
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+func (l *Lookup) Type() string { return l.resolver.Type() }
+
+func (l *Lookup) Resolve(ctx context.Context, card Card) (string, error) {
+	key := Card{ID: NormalizeID(card.ID), Hash: card.Hash, Space: card.Space}
+	now := time.Now()
+	if l.ttl > 0 {
+		l.mu.Lock()
+		c, ok := l.cache[key]
+		l.mu.Unlock()
+		if ok && now.Before(c.expires) {
+			return c.name, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	name, err := l.resolver.Resolve(ctx, card)
+	if err != nil || l.ttl == 0 {
+		return name, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.cache) >= maxCacheEntries {
+		for k, c := range l.cache {
+			if !now.Before(c.expires) {
+				delete(l.cache, k)
+			}
+		}
+		if len(l.cache) >= maxCacheEntries {
+			l.cache = make(map[Card]cachedName)
+		}
+	}
+	l.cache[key] = cachedName{name: name, expires: now.Add(l.ttl)}
+	return name, nil
+}
@@ -0,0 +1,123 @@
+package cards
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stub counts lookups and answers with name, or err when set.
+type stub struct {
+	calls int
+	name  string
+	err   error
+	delay time.Duration
+}
+
+func (s *stub) Type() string { return "stub" }
+
+func (s *stub) Resolve(ctx context.Context, _ Card) (string, error) {
+	s.calls++
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return s.name, s.err
+}
+
+// localStub is a stub answering from local data.
+type localStub struct{ *stub }
+
+func (localStub) Local() {}
+
+func registryWith(s *stub) *Registry {
+	r := NewRegistry(nil)
+	r.Register("stub", func(Settings) (Resolver, error) { return s, nil })
+	return r
+}
+
+func TestLookup_CachesSuccesses(t *testing.T) {
+	s := &stub{name: "Mario"}
+	l, err := registryWith(s).Build("stub", Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"04-a2", "04A2", "04a2"} {
+		if name, err := l.Resolve(ctx, Card{ID: id, Hash: "h"}); err != nil || name != "Mario" {
+			t.Fatalf("%q, %v", name, err)
+		}
+	}
+	if s.calls != 1 {
+		t.Errorf("backend called %d times, want 1", s.calls)
+	}
+	l.Resolve(ctx, Card{ID: "04a2", Hash: "other"})
+	if s.calls != 2 {
+		t.Errorf("a different hash must not hit the cache")
+	}
+
+	s.err = errors.New("down")
+	l.Resolve(ctx, Card{ID: "beef"})
+	l.Resolve(ctx, Card{ID: "beef"})
+	if s.calls != 4 {
+		t.Errorf("failures must not be cached: %d calls", s.calls)
+	}
+}
+
+func TestLookup_LocalResolversUncachedByDefault(t *testing.T) {
+	s := &stub{name: "Mario"}
+	r := NewRegistry(nil)
+	r.Register("local", func(Settings) (Resolver, error) { return localStub{s}, nil })
+	ctx := context.Background()
+
+	l, _ := r.Build("local", Settings{})
+	l.Resolve(ctx, Card{ID: "1"})
+	l.Resolve(ctx, Card{ID: "1"})
+	if s.calls != 2 {
+		t.Errorf("local lookups cached: %d calls", s.calls)
+	}
+
+	l, _ = r.Build("local", Settings{"cache_ttl": "1m"})
+	l.Resolve(ctx, Card{ID: "1"})
+	l.Resolve(ctx, Card{ID: "1"})
+	if s.calls != 3 {
+		t.Errorf("explicit cache_ttl ignored: %d calls", s.calls)
+	}
+}
+
+func TestLookup_Timeout(t *testing.T) {
+	s := &stub{name: "slow", delay: time.Second}
+	l, _ := registryWith(s).Build("stub", Settings{"timeout": "10ms"})
+	start := time.Now()
+	if _, err := l.Resolve(context.Background(), Card{ID: "1"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("timeout not applied")
+	}
+}
+
+func TestRegistry_Build(t *testing.T) {
+	r := NewRegistry(nil)
+	l, err := r.Build("none", Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.OnError != OnErrorReject {
+		t.Errorf("default on_error = %q", l.OnError)
+	}
+	if name, err := l.Resolve(context.Background(), Card{ID: "1"}); name != "" || err != nil {
+		t.Errorf("none resolved %q, %v", name, err)
+	}
+
+	for _, s := range []Settings{{"on_error": "ignore"}, {"timeout": "soon"}, {"cache_ttl": "-1s"}} {
+		if _, err := r.Build("none", s); err == nil {
+			t.Errorf("%v: expected an error", s)
+		}
+	}
+	if _, err := r.Build("ldap", Settings{}); err == nil {
+		t.Error("unknown type: expected an error")
+	}
+}
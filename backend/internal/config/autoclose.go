@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AutoClosePolicy closes a space that nobody remembered to close. At is a
+// wall-clock time ("03:00") in the space's timezone; After is the longest a
+// space may stay open ("12h"). When both are set the earlier deadline wins.
+type AutoClosePolicy struct {
+	At    string `yaml:"at" json:"at,omitempty"`
+	After string `yaml:"after" json:"after,omitempty"`
+}
+
+// Validate checks that at least one rule is set and that both parse.
+func (p AutoClosePolicy) Validate() error {
+	if p.At == "" && p.After == "" {
+		return errors.New("at or after is required")
+	}
+	if p.At != "" {
+		if _, err := time.Parse("15:04", p.At); err != nil {
+			return fmt.Errorf("at %q must be HH:MM", p.At)
+		}
+	}
+	if p.After != "" {
+		d, err := time.ParseDuration(p.After)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("after %q must be a positive duration such as 12h", p.After)
+		}
+	}
+	return nil
+}
+
+// Deadline returns when a space opened at opened must be closed. The At rule
+// fires at the first matching local time strictly after opened, so a space
+// opened at 02:59 with at "03:00" closes a minute later; across a DST gap the
+// time is normalised forward as time.Date does.
+func (p AutoClosePolicy) Deadline(opened time.Time, loc *time.Location) (time.Time, error) {
+	if err := p.Validate(); err != nil {
+		return time.Time{}, err
+	}
+
+	var deadline time.Time
+	if p.After != "" {
+		d, _ := time.ParseDuration(p.After)
+		deadline = opened.Add(d)
+	}
+	if p.At != "" {
+		at, _ := time.Parse("15:04", p.At)
+		y, m, d := opened.In(loc).Date()
+		next := time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, loc)
+		if !next.After(opened) {
+			next = time.Date(y, m, d+1, at.Hour(), at.Minute(), 0, 0, loc)
+		}
+		if deadline.IsZero() || next.Before(deadline) {
+			deadline = next
+		}
+	}
+	return deadline, nil
+}
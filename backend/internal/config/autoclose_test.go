@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoClosePolicy_Deadline(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.ParseInLocation("2006-01-02 15:04", s, rome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	cases := []struct {
+		name   string
+		policy AutoClosePolicy
+		opened time.Time
+		want   time.Time
+	}{
+		{"at, opened in the evening", AutoClosePolicy{At: "03:00"}, at("2024-05-01 21:00"), at("2024-05-02 03:00")},
+		{"at, opened after midnight", AutoClosePolicy{At: "03:00"}, at("2024-05-02 01:00"), at("2024-05-02 03:00")},
+		{"at, opened exactly at the time", AutoClosePolicy{At: "03:00"}, at("2024-05-02 03:00"), at("2024-05-03 03:00")},
+		{"after", AutoClosePolicy{After: "12h"}, at("2024-05-01 21:00"), at("2024-05-02 09:00")},
+		{"earlier rule wins", AutoClosePolicy{At: "03:00", After: "2h"}, at("2024-05-01 21:00"), at("2024-05-01 23:00")},
+		// 31 March 2024: clocks jump from 02:00 to 03:00 in Rome.
+		{"at, across spring forward", AutoClosePolicy{At: "04:00"}, at("2024-03-30 21:00"), at("2024-03-31 04:00")},
+		{"after, across spring forward", AutoClosePolicy{After: "8h"}, at("2024-03-30 21:00"), at("2024-03-31 06:00")},
+		// 27 October 2024: clocks fall back from 03:00 to 02:00.
+		{"after, across fall back", AutoClosePolicy{After: "8h"}, at("2024-10-26 21:00"), at("2024-10-27 04:00")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := c.policy.Deadline(c.opened, rome)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(c.want) {
+				t.Errorf("Deadline = %s, want %s", got.In(rome), c.want)
+			}
+		})
+	}
+}
+
+func TestAutoClosePolicy_DeadlineRejectsInvalid(t *testing.T) {
+	if _, err := (AutoClosePolicy{At: "25:00"}).Deadline(time.Now(), time.UTC); err == nil {
+		t.Error("expected error for an invalid time")
+	}
+}
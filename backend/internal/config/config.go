@@ -5,6 +5,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/logging"
 )
 
 type Config struct {
@@ -16,6 +19,11 @@ type Config struct {
 	HashAPIKey        bool
 	DatabasePath      string
 
+	// DatabaseURL selects the storage backend: postgres:// (or
+	// postgresql://) for PostgreSQL, sqlite://<path> for a SQLite file.
+	// Empty falls back to the SQLite file at DatabasePath.
+	DatabaseURL string
+
 	// SpacesConfigPath points to the YAML file that defines all spaces served
 	// by this instance. Empty / missing file triggers the legacy-upgrade path
 	// (single space synthesised from APIKey + TelegramToken + TelegramChatId).
@@ -24,6 +32,39 @@ type Config struct {
 	// /toggle, /stats, /spaceapi.json, /ui) resolve to.
 	DefaultSpaceSlug string
 
+	// AdminToken is the bearer credential for the /admin API. It is
+	// deliberately separate from the per-space API keys; when empty only API
+	// tokens with the admin scope can reach the admin API.
+	AdminToken string
+
+	// MetricsToken, when set, is the bearer credential required to scrape
+	// /metrics. Empty leaves the endpoint public.
+	MetricsToken string
+
+	// PublicURL is the externally visible base URL of this instance (e.g.
+	// https://sede.olografix.org), used for absolute links such as the
+	// SpaceAPI calendar feed. Empty leaves those links out.
+	PublicURL string
+
+	// BackupInterval, when non-zero, enables scheduled in-process backups
+	// of the SQLite database: every interval a gzip-compressed snapshot is
+	// written to BackupDir, keeping the newest BackupRetention of them.
+	BackupInterval  time.Duration
+	BackupDir       string
+	BackupRetention int
+
+	// DeviceOfflineAfter is how long a device may go without a heartbeat
+	// before it is reported offline; zero disables the check.
+	DeviceOfflineAfter time.Duration
+
+	// ManagerAPIToken authenticates card lookups against the Metro
+	// Olografix manager for spaces that don't configure a card_resolver.
+	ManagerAPIToken string
+
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	// Defaults to debug with Debug set, info otherwise.
+	LogLevel string
+
 	// Legacy single-space Telegram target. Used only for the one-time upgrade
 	// path: when SpacesConfigPath is missing, these seed the default space.
 	TelegramToken        string
@@ -40,21 +81,86 @@ func ValidateAndSetDefaults(cfg Config) Config {
 		panic("API key must be at least 16 characters in production")
 	}
 
+	if cfg.AdminToken != "" && len(cfg.AdminToken) < 16 && !cfg.Debug {
+		panic("admin token must be at least 16 characters in production")
+	}
+
+	if cfg.MetricsToken != "" && len(cfg.MetricsToken) < 16 && !cfg.Debug {
+		panic("metrics token must be at least 16 characters in production")
+	}
+
 	cfg.AllowedOrigins = parseAndValidateOrigins(cfg.AllowedOriginsStr)
 
-	if cfg.DatabasePath == "" {
-		cfg.DatabasePath = "database/sede.db"
+	cfg, err := DatabaseDefaults(cfg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	if cfg.BackupInterval != 0 {
+		if driver, _, _ := cfg.Database(); driver != DriverSQLite {
+			panic("scheduled backups are only supported with SQLite")
+		}
+		if cfg.BackupInterval < time.Minute {
+			panic(fmt.Sprintf("backup interval must be at least 1m: %s", cfg.BackupInterval))
+		}
+		if cfg.BackupDir == "" {
+			cfg.BackupDir = "database/backups"
+		}
+		if cfg.BackupRetention < 0 {
+			panic(fmt.Sprintf("invalid backup retention: %d", cfg.BackupRetention))
+		}
+		if cfg.BackupRetention == 0 {
+			cfg.BackupRetention = 7
+		}
+	}
+
+	if cfg.DeviceOfflineAfter != 0 && cfg.DeviceOfflineAfter < time.Minute {
+		panic(fmt.Sprintf("device offline threshold must be at least 1m: %s", cfg.DeviceOfflineAfter))
 	}
 
 	if cfg.SpacesConfigPath == "" {
 		cfg.SpacesConfigPath = "config/spaces.yaml"
 	}
 
+	if cfg.PublicURL != "" {
+		u, err := url.Parse(cfg.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			panic(fmt.Sprintf("invalid public URL: %s", cfg.PublicURL))
+		}
+		cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	}
+
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+		if cfg.Debug {
+			cfg.LogLevel = "debug"
+		}
+	}
+	if _, err := logging.ParseLevel(cfg.LogLevel); err != nil {
+		panic(err.Error())
+	}
+
+	return cfg
+}
+
+// DatabaseDefaults fills in and checks only the settings needed to open and
+// migrate the database, for commands that don't run the server.
+func DatabaseDefaults(cfg Config) (Config, error) {
+	if cfg.DatabasePath == "" {
+		cfg.DatabasePath = "database/sede.db"
+	}
+
+	if cfg.DatabaseURL != "" {
+		if _, _, err := cfg.Database(); err != nil {
+			return cfg, err
+		}
+	}
+
 	if cfg.DefaultSpaceSlug == "" {
 		cfg.DefaultSpaceSlug = "pescara"
 	}
 
-	return cfg
+	return cfg, nil
 }
 
 func parseAndValidateOrigins(origins string) []string {
@@ -71,3 +177,26 @@ func parseAndValidateOrigins(origins string) []string {
 	}
 	return validOrigins
 }
+
+// Database driver names returned by Config.Database.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Database returns the storage driver and its DSN: the DatabaseURL when
+// set, otherwise the SQLite file at DatabasePath.
+func (c Config) Database() (driver, dsn string, err error) {
+	if c.DatabaseURL == "" {
+		return DriverSQLite, c.DatabasePath, nil
+	}
+	scheme, rest, ok := strings.Cut(c.DatabaseURL, "://")
+	switch {
+	case !ok:
+	case scheme == "postgres" || scheme == "postgresql":
+		return DriverPostgres, c.DatabaseURL, nil
+	case scheme == "sqlite" && rest != "":
+		return DriverSQLite, rest, nil
+	}
+	return "", "", fmt.Errorf("invalid database URL: want postgres://... or sqlite://<path>")
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestValidateAndSetDefaults(t *testing.T) {
@@ -21,6 +22,8 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				DatabasePath:      "custom/path.db",
 				SpacesConfigPath:  "custom/spaces.yaml",
 				DefaultSpaceSlug:  "aquila",
+				PublicURL:         "https://sede.example.org/",
+				LogLevel:          "warn",
 			},
 			shouldPanic: false,
 			expected: Config{
@@ -32,6 +35,8 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				DatabasePath:      "custom/path.db",
 				SpacesConfigPath:  "custom/spaces.yaml",
 				DefaultSpaceSlug:  "aquila",
+				PublicURL:         "https://sede.example.org",
+				LogLevel:          "warn",
 			},
 		},
 		{
@@ -50,6 +55,7 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				DatabasePath:     "database/sede.db",
 				SpacesConfigPath: "config/spaces.yaml",
 				DefaultSpaceSlug: "pescara",
+				LogLevel:         "info",
 			},
 		},
 		{
@@ -68,8 +74,55 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				DatabasePath:     "database/sede.db",
 				SpacesConfigPath: "config/spaces.yaml",
 				DefaultSpaceSlug: "pescara",
+				LogLevel:         "debug",
 			},
 		},
+		{
+			name: "invalid public URL should panic",
+			config: Config{
+				Port:      "8080",
+				APIKey:    "supersecretapikey123",
+				PublicURL: "sede.olografix.org",
+			},
+			shouldPanic: true,
+		},
+		{
+			name: "invalid log level should panic",
+			config: Config{
+				Port:     "8080",
+				APIKey:   "supersecretapikey123",
+				LogLevel: "verbose",
+			},
+			shouldPanic: true,
+		},
+		{
+			name: "too frequent backups should panic",
+			config: Config{
+				Port:           "8080",
+				APIKey:         "supersecretapikey123",
+				BackupInterval: time.Second,
+			},
+			shouldPanic: true,
+		},
+		{
+			name: "too short device offline threshold should panic",
+			config: Config{
+				Port:               "8080",
+				APIKey:             "supersecretapikey123",
+				DeviceOfflineAfter: 10 * time.Second,
+			},
+			shouldPanic: true,
+		},
+		{
+			name: "scheduled backups on postgres should panic",
+			config: Config{
+				Port:           "8080",
+				APIKey:         "supersecretapikey123",
+				DatabaseURL:    "postgres://db/sede",
+				BackupInterval: time.Hour,
+			},
+			shouldPanic: true,
+		},
 		{
 			name: "invalid port should panic",
 			config: Config{
@@ -110,6 +163,12 @@ func TestValidateAndSetDefaults(t *testing.T) {
 				if result.Debug != tt.expected.Debug {
 					t.Errorf("Expected Debug %v, got %v", tt.expected.Debug, result.Debug)
 				}
+				if result.LogLevel != tt.expected.LogLevel {
+					t.Errorf("Expected LogLevel %s, got %s", tt.expected.LogLevel, result.LogLevel)
+				}
+				if result.PublicURL != tt.expected.PublicURL {
+					t.Errorf("Expected PublicURL %s, got %s", tt.expected.PublicURL, result.PublicURL)
+				}
 				if result.DatabasePath != tt.expected.DatabasePath {
 					t.Errorf("Expected DatabasePath %s, got %s", tt.expected.DatabasePath, result.DatabasePath)
 				}
@@ -183,3 +242,61 @@ func TestParseAndValidateOrigins(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     Config
+		wantDriver string
+		wantDSN    string
+		wantErr    bool
+	}{
+		{"default sqlite file", Config{DatabasePath: "database/sede.db"}, DriverSQLite, "database/sede.db", false},
+		{"sqlite url", Config{DatabaseURL: "sqlite:///var/lib/sede/sede.db"}, DriverSQLite, "/var/lib/sede/sede.db", false},
+		{"postgres url", Config{DatabaseURL: "postgres://sede:pw@db:5432/sede?sslmode=disable"}, DriverPostgres, "postgres://sede:pw@db:5432/sede?sslmode=disable", false},
+		{"postgresql scheme", Config{DatabaseURL: "postgresql://db/sede"}, DriverPostgres, "postgresql://db/sede", false},
+		{"unknown scheme", Config{DatabaseURL: "mysql://db/sede"}, "", "", true},
+		{"no scheme", Config{DatabaseURL: "host=db dbname=sede"}, "", "", true},
+		{"empty sqlite path", Config{DatabaseURL: "sqlite://"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver, dsn, err := tt.config.Database()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if driver != tt.wantDriver || dsn != tt.wantDSN {
+				t.Errorf("got (%q, %q), want (%q, %q)", driver, dsn, tt.wantDriver, tt.wantDSN)
+			}
+		})
+	}
+}
+
+func TestDatabaseDefaults(t *testing.T) {
+	// Settings unrelated to the database, like a short API key, must not
+	// stop `sede migrate`.
+	cfg, err := DatabaseDefaults(Config{APIKey: "short"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DatabasePath != "database/sede.db" || cfg.DefaultSpaceSlug != "pescara" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+
+	if _, err := DatabaseDefaults(Config{DatabaseURL: "mysql://db/sede"}); err == nil {
+		t.Error("expected invalid database URL to be rejected")
+	}
+}
+
+func TestValidateAndSetDefaults_Backup(t *testing.T) {
+	cfg := ValidateAndSetDefaults(Config{Port: "8080", APIKey: "supersecretapikey123", BackupInterval: time.Hour})
+	if cfg.BackupDir != "database/backups" || cfg.BackupRetention != 7 {
+		t.Errorf("backup defaults not applied: dir %q, retention %d", cfg.BackupDir, cfg.BackupRetention)
+	}
+
+	cfg = ValidateAndSetDefaults(Config{Port: "8080", APIKey: "supersecretapikey123"})
+	if cfg.BackupDir != "" {
+		t.Errorf("backup dir set with backups disabled: %q", cfg.BackupDir)
+	}
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -27,6 +29,70 @@ type SpaceDef struct {
 	TelegramThread int
 	Projects       []string
 	Links          []SpaceLink
+	Webhooks       []SpaceWebhook
+	Notifiers      []NotifierDef
+	AutoClose      *AutoClosePolicy
+	StatsHours     *StatsHours
+	Calendar       *CalendarSettings
+	CardResolver   *CardResolverDef
+	// RequireCard allows opening only with a card that CardResolver
+	// resolves to a member; closing stays open to anyone.
+	RequireCard bool
+	// HideNames keeps member names off the public endpoints (events,
+	// sessions, calendar); the admin API still shows them.
+	HideNames bool
+
+	// Optional SpaceAPI v15 metadata, passed through to spaceapi.json.
+	Icon            *SpaceIcon
+	Contact         SpaceContact
+	Feeds           map[string]SpaceFeed
+	Sensors         map[string]any
+	MembershipPlans []MembershipPlan
+	Areas           []SpaceArea
+	SpaceFed        *SpaceFed
+}
+
+// SpaceIcon holds the state.icon URLs shown by SpaceAPI clients.
+type SpaceIcon struct {
+	Open   string `yaml:"open" json:"open"`
+	Closed string `yaml:"closed" json:"closed"`
+}
+
+// SpaceContact lists the SpaceAPI contact channels beyond the email address,
+// which SpaceDef keeps as ContactEmail.
+type SpaceContact struct {
+	Matrix    string `yaml:"matrix" json:"matrix,omitempty"`
+	Mastodon  string `yaml:"mastodon" json:"mastodon,omitempty"`
+	IRC       string `yaml:"irc" json:"irc,omitempty"`
+	Phone     string `yaml:"phone" json:"phone,omitempty"`
+	IssueMail string `yaml:"issue_mail" json:"issue_mail,omitempty"`
+}
+
+// SpaceFeed is one entry of the SpaceAPI feeds object (blog, wiki, calendar,
+// flickr).
+type SpaceFeed struct {
+	Type string `yaml:"type" json:"type,omitempty"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+type MembershipPlan struct {
+	Name            string  `yaml:"name" json:"name"`
+	Value           float64 `yaml:"value" json:"value"`
+	Currency        string  `yaml:"currency" json:"currency"`
+	BillingInterval string  `yaml:"billing_interval" json:"billing_interval"`
+	Description     string  `yaml:"description" json:"description,omitempty"`
+}
+
+// SpaceArea is published as location.areas.
+type SpaceArea struct {
+	Name         string  `yaml:"name" json:"name,omitempty"`
+	Description  string  `yaml:"description" json:"description,omitempty"`
+	SquareMeters float64 `yaml:"square_meters" json:"square_meters"`
+}
+
+type SpaceFed struct {
+	SpaceNet  bool `yaml:"spacenet" json:"spacenet"`
+	SpaceSAML bool `yaml:"spacesaml" json:"spacesaml"`
 }
 
 type SpaceLink struct {
@@ -35,29 +101,87 @@ type SpaceLink struct {
 	URL         string `yaml:"url" json:"url"`
 }
 
+// SpaceWebhook is an outgoing HTTP endpoint notified on every status change
+// of its space. Secret keys the HMAC-SHA256 signature sent with each request.
+type SpaceWebhook struct {
+	URL    string `yaml:"url" json:"url"`
+	Secret string `yaml:"secret" json:"secret"`
+}
+
+// StatsHours is the local hour range, both ends included, shown by /stats
+// and the heatmap. Unset means 9 to 21.
+type StatsHours struct {
+	From int `yaml:"from" json:"from"`
+	To   int `yaml:"to" json:"to"`
+}
+
+// CalendarSettings tunes the calendar.ics feed. LikelyOpenThreshold, when
+// set, adds tentative "likely open" events for the coming week in every hour
+// whose /stats probability reaches it.
+type CalendarSettings struct {
+	LikelyOpenThreshold float64 `yaml:"likely_open_threshold" json:"likely_open_threshold"`
+}
+
+// NotifierDef is one entry of a space's notifiers list: a backend type
+// (telegram, matrix, discord, mastodon, smtp) and its flat settings. The
+// backend validates its own settings when it is built.
+type NotifierDef struct {
+	Type     string            `json:"type"`
+	Settings map[string]string `json:"settings"`
+}
+
+// CardResolverDef selects how the space turns the card presented at its
+// button into a name: a backend type (manager, local, members, none) and
+// its flat settings. Unset means the Metro Olografix manager when a manager
+// API token is configured, the local members registry otherwise.
+type CardResolverDef struct {
+	Type     string            `json:"type"`
+	Settings map[string]string `json:"settings"`
+}
+
 type spacesFile struct {
 	Spaces []spaceEntry `yaml:"spaces"`
 }
 
 type spaceEntry struct {
-	Slug     string        `yaml:"slug"`
-	Name     string        `yaml:"name"`
-	Address  string        `yaml:"address"`
-	Lat      float64       `yaml:"lat"`
-	Lon      float64       `yaml:"lon"`
-	Timezone string        `yaml:"timezone"`
-	LogoURL  string        `yaml:"logo_url"`
-	URL      string        `yaml:"url"`
-	Contact  contactEntry  `yaml:"contact"`
-	Message  string        `yaml:"message"`
-	APIKey   string        `yaml:"api_key"`
-	Telegram telegramEntry `yaml:"telegram"`
-	Projects []string      `yaml:"projects"`
-	Links    []SpaceLink   `yaml:"links"`
+	Slug     string         `yaml:"slug"`
+	Name     string         `yaml:"name"`
+	Address  string         `yaml:"address"`
+	Lat      float64        `yaml:"lat"`
+	Lon      float64        `yaml:"lon"`
+	Timezone string         `yaml:"timezone"`
+	LogoURL  string         `yaml:"logo_url"`
+	URL      string         `yaml:"url"`
+	Contact  contactEntry   `yaml:"contact"`
+	Message  string         `yaml:"message"`
+	Icon     *SpaceIcon     `yaml:"icon"`
+	APIKey   string         `yaml:"api_key"`
+	Telegram telegramEntry  `yaml:"telegram"`
+	Projects []string       `yaml:"projects"`
+	Links    []SpaceLink    `yaml:"links"`
+	Webhooks []SpaceWebhook `yaml:"webhooks"`
+	// Notifiers is decoded as flat string maps so each backend can declare
+	// its own keys; "type" selects the backend.
+	Notifiers  []map[string]string `yaml:"notifiers"`
+	AutoClose  *AutoClosePolicy    `yaml:"auto_close"`
+	StatsHours *StatsHours         `yaml:"stats_hours"`
+	Calendar   *CalendarSettings   `yaml:"calendar"`
+	// CardResolver is flat like a notifiers entry; "type" selects the
+	// backend.
+	CardResolver map[string]string `yaml:"card_resolver"`
+	RequireCard  bool              `yaml:"require_card"`
+	HideNames    bool              `yaml:"hide_names"`
+
+	Feeds           map[string]SpaceFeed `yaml:"feeds"`
+	Sensors         map[string]any       `yaml:"sensors"`
+	MembershipPlans []MembershipPlan     `yaml:"membership_plans"`
+	Areas           []SpaceArea          `yaml:"areas"`
+	SpaceFed        *SpaceFed            `yaml:"spacefed"`
 }
 
 type contactEntry struct {
-	Email string `yaml:"email"`
+	Email        string `yaml:"email"`
+	SpaceContact `yaml:",inline"`
 }
 
 type telegramEntry struct {
@@ -88,6 +212,43 @@ func LoadSpaces(path string) ([]SpaceDef, error) {
 		if err != nil {
 			return nil, fmt.Errorf("space[%d] (%q) api_key: %w", i, e.Slug, err)
 		}
+		webhooks := make([]SpaceWebhook, 0, len(e.Webhooks))
+		for j, w := range e.Webhooks {
+			secret, err := resolveEnvRef(w.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("space[%d] (%q) webhooks[%d] secret: %w", i, e.Slug, j, err)
+			}
+			webhooks = append(webhooks, SpaceWebhook{URL: w.URL, Secret: secret})
+		}
+		notifiers := make([]NotifierDef, 0, len(e.Notifiers))
+		for j, n := range e.Notifiers {
+			def := NotifierDef{Type: n["type"], Settings: make(map[string]string, len(n))}
+			for k, v := range n {
+				if k == "type" {
+					continue
+				}
+				resolved, err := resolveEnvRef(v)
+				if err != nil {
+					return nil, fmt.Errorf("space[%d] (%q) notifiers[%d] %s: %w", i, e.Slug, j, k, err)
+				}
+				def.Settings[k] = resolved
+			}
+			notifiers = append(notifiers, def)
+		}
+		var cardResolver *CardResolverDef
+		if e.CardResolver != nil {
+			cardResolver = &CardResolverDef{Type: e.CardResolver["type"], Settings: make(map[string]string, len(e.CardResolver))}
+			for k, v := range e.CardResolver {
+				if k == "type" {
+					continue
+				}
+				resolved, err := resolveEnvRef(v)
+				if err != nil {
+					return nil, fmt.Errorf("space[%d] (%q) card_resolver %s: %w", i, e.Slug, k, err)
+				}
+				cardResolver.Settings[k] = resolved
+			}
+		}
 		defs = append(defs, SpaceDef{
 			Slug:           e.Slug,
 			Name:           e.Name,
@@ -104,6 +265,22 @@ func LoadSpaces(path string) ([]SpaceDef, error) {
 			TelegramThread: e.Telegram.ThreadID,
 			Projects:       e.Projects,
 			Links:          e.Links,
+			Webhooks:       webhooks,
+			Notifiers:      notifiers,
+			AutoClose:      e.AutoClose,
+			StatsHours:     e.StatsHours,
+			Calendar:       e.Calendar,
+			CardResolver:   cardResolver,
+			RequireCard:    e.RequireCard,
+			HideNames:      e.HideNames,
+
+			Icon:            e.Icon,
+			Contact:         e.Contact.SpaceContact,
+			Feeds:           e.Feeds,
+			Sensors:         e.Sensors,
+			MembershipPlans: e.MembershipPlans,
+			Areas:           e.Areas,
+			SpaceFed:        e.SpaceFed,
 		})
 	}
 
@@ -113,7 +290,9 @@ func LoadSpaces(path string) ([]SpaceDef, error) {
 	return defs, nil
 }
 
-// ValidateSpaces enforces required fields, unique slugs, and sane lat/lon.
+// ValidateSpaces enforces required fields, unique slugs, sane lat/lon,
+// well-formed webhook targets, a type on every notifier and card resolver, a usable
+// auto_close policy, a sane stats hour range and calendar threshold.
 func ValidateSpaces(defs []SpaceDef) error {
 	if len(defs) == 0 {
 		return errors.New("no spaces defined")
@@ -135,6 +314,37 @@ func ValidateSpaces(defs []SpaceDef) error {
 		if d.Lon < -180 || d.Lon > 180 {
 			return fmt.Errorf("space[%d] (%q): lon %f out of range [-180, 180]", i, d.Slug, d.Lon)
 		}
+		for j, w := range d.Webhooks {
+			u, err := url.Parse(w.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("space[%d] (%q): webhooks[%d]: url %q must be an absolute http(s) URL", i, d.Slug, j, w.URL)
+			}
+			if w.Secret == "" {
+				return fmt.Errorf("space[%d] (%q): webhooks[%d]: secret is required", i, d.Slug, j)
+			}
+		}
+		for j, n := range d.Notifiers {
+			if n.Type == "" {
+				return fmt.Errorf("space[%d] (%q): notifiers[%d]: type is required", i, d.Slug, j)
+			}
+		}
+		if d.CardResolver != nil && d.CardResolver.Type == "" {
+			return fmt.Errorf("space[%d] (%q): card_resolver: type is required", i, d.Slug)
+		}
+		if d.AutoClose != nil {
+			if err := d.AutoClose.Validate(); err != nil {
+				return fmt.Errorf("space[%d] (%q): auto_close: %w", i, d.Slug, err)
+			}
+		}
+		if h := d.StatsHours; h != nil && (h.From < 0 || h.To > 23 || h.From > h.To) {
+			return fmt.Errorf("space[%d] (%q): stats_hours %d-%d must satisfy 0 <= from <= to <= 23", i, d.Slug, h.From, h.To)
+		}
+		if cal := d.Calendar; cal != nil && (cal.LikelyOpenThreshold < 0 || cal.LikelyOpenThreshold > 1) {
+			return fmt.Errorf("space[%d] (%q): calendar.likely_open_threshold %v must be between 0 and 1", i, d.Slug, cal.LikelyOpenThreshold)
+		}
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("space[%d] (%q): timezone: %w", i, d.Slug, err)
+		}
 		if _, dup := seen[d.Slug]; dup {
 			return fmt.Errorf("duplicate slug %q", d.Slug)
 		}
@@ -212,6 +212,238 @@ func TestLoadSpaces_InvalidLatLon(t *testing.T) {
 	}
 }
 
+func TestLoadSpaces_Webhooks(t *testing.T) {
+	t.Setenv("HOOK_SECRET", "s3cret-from-env")
+	defs, err := LoadSpaces(writeYAML(t, `
+spaces:
+  - slug: x
+    name: X
+    lat: 0
+    lon: 0
+    api_key: kkkkkkkkkkkkkkkk
+    webhooks:
+      - url: https://hooks.example/sede
+        secret: $HOOK_SECRET
+      - url: http://homeassistant.local:8123/api/webhook/sede
+        secret: literal
+`))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	w := defs[0].Webhooks
+	if len(w) != 2 || w[0].URL != "https://hooks.example/sede" || w[0].Secret != "s3cret-from-env" || w[1].Secret != "literal" {
+		t.Errorf("webhooks: %+v", w)
+	}
+}
+
+func TestLoadSpaces_SpaceAPIMetadata(t *testing.T) {
+	defs, err := LoadSpaces(writeYAML(t, `
+spaces:
+  - slug: x
+    name: X
+    lat: 0
+    lon: 0
+    api_key: kkkkkkkkkkkkkkkk
+    icon:
+      open: https://x.example/open.png
+      closed: https://x.example/closed.png
+    contact:
+      email: info@x.example
+      matrix: "#sede:x.example"
+      mastodon: "@sede@x.example"
+      irc: ircs://irc.libera.chat/#sede
+      phone: "+39 085 000000"
+      issue_mail: issues@x.example
+    feeds:
+      calendar:
+        type: ical
+        url: https://x.example/calendar.ics
+    sensors:
+      total_member_count:
+        - value: 120
+    membership_plans:
+      - name: Socio ordinario
+        value: 50
+        currency: EUR
+        billing_interval: yearly
+    areas:
+      - name: Sala principale
+        square_meters: 80
+    spacefed:
+      spacenet: false
+      spacesaml: false
+`))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	d := defs[0]
+	if d.Icon == nil || d.Icon.Closed != "https://x.example/closed.png" {
+		t.Errorf("icon: %+v", d.Icon)
+	}
+	if d.ContactEmail != "info@x.example" || d.Contact.Matrix != "#sede:x.example" || d.Contact.IssueMail != "issues@x.example" || d.Contact.Phone == "" || d.Contact.IRC == "" || d.Contact.Mastodon == "" {
+		t.Errorf("contact: %q %+v", d.ContactEmail, d.Contact)
+	}
+	if d.Feeds["calendar"].URL != "https://x.example/calendar.ics" {
+		t.Errorf("feeds: %+v", d.Feeds)
+	}
+	if _, ok := d.Sensors["total_member_count"]; !ok {
+		t.Errorf("sensors: %+v", d.Sensors)
+	}
+	if len(d.MembershipPlans) != 1 || d.MembershipPlans[0].BillingInterval != "yearly" || d.MembershipPlans[0].Value != 50 {
+		t.Errorf("membership_plans: %+v", d.MembershipPlans)
+	}
+	if len(d.Areas) != 1 || d.Areas[0].SquareMeters != 80 {
+		t.Errorf("areas: %+v", d.Areas)
+	}
+	if d.SpaceFed == nil {
+		t.Error("spacefed not parsed")
+	}
+}
+
+func TestLoadSpaces_InvalidWebhooks(t *testing.T) {
+	cases := []struct {
+		name, hook, want string
+	}{
+		{"relative url", "{url: /hook, secret: s}", "absolute http(s) URL"},
+		{"bad scheme", "{url: 'ftp://x/hook', secret: s}", "absolute http(s) URL"},
+		{"missing secret", "{url: 'https://x/hook'}", "secret is required"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			yaml := "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    webhooks: [" + c.hook + "]\n"
+			_, err := LoadSpaces(writeYAML(t, yaml))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("expected %q, got: %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadSpaces_Notifiers(t *testing.T) {
+	t.Setenv("MATRIX_TOKEN", "syt_secret")
+	defs, err := LoadSpaces(writeYAML(t, `
+spaces:
+  - slug: x
+    name: X
+    lat: 0
+    lon: 0
+    api_key: kkkkkkkkkkkkkkkk
+    notifiers:
+      - type: matrix
+        homeserver: https://matrix.example
+        room_id: "!room:matrix.example"
+        access_token: $MATRIX_TOKEN
+      - type: telegram
+        chat_id: -100123
+        thread_id: 7
+`))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	n := defs[0].Notifiers
+	if len(n) != 2 {
+		t.Fatalf("want 2 notifiers, got %+v", n)
+	}
+	if n[0].Type != "matrix" || n[0].Settings["access_token"] != "syt_secret" || n[0].Settings["room_id"] != "!room:matrix.example" {
+		t.Errorf("matrix notifier: %+v", n[0])
+	}
+	if _, leaked := n[0].Settings["type"]; leaked {
+		t.Error("type should not be duplicated into settings")
+	}
+	// Numeric YAML scalars arrive as strings for the backend to parse.
+	if n[1].Type != "telegram" || n[1].Settings["chat_id"] != "-100123" || n[1].Settings["thread_id"] != "7" {
+		t.Errorf("telegram notifier: %+v", n[1])
+	}
+}
+
+func TestLoadSpaces_NotifierWithoutType(t *testing.T) {
+	_, err := LoadSpaces(writeYAML(t, "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    notifiers: [{webhook_url: 'https://x'}]\n"))
+	if err == nil || !strings.Contains(err.Error(), "type is required") {
+		t.Fatalf("expected missing type error, got: %v", err)
+	}
+}
+
+func TestLoadSpaces_CardResolver(t *testing.T) {
+	t.Setenv("MANAGER_TOKEN", "mgr_secret")
+	defs, err := LoadSpaces(writeYAML(t, "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    require_card: true\n    hide_names: true\n    card_resolver: {type: manager, token: $MANAGER_TOKEN, on_error: anonymous}\n  - slug: y\n    name: Y\n    api_key: kkkkkkkkkkkkkkkk\n"))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	r := defs[0].CardResolver
+	if r == nil || r.Type != "manager" || r.Settings["token"] != "mgr_secret" || r.Settings["on_error"] != "anonymous" {
+		t.Errorf("card_resolver: %+v", r)
+	}
+	if _, leaked := r.Settings["type"]; leaked {
+		t.Error("type should not be duplicated into settings")
+	}
+	if defs[1].CardResolver != nil {
+		t.Errorf("unset card_resolver: %+v", defs[1].CardResolver)
+	}
+	if !defs[0].RequireCard || defs[1].RequireCard || !defs[0].HideNames || defs[1].HideNames {
+		t.Errorf("require_card/hide_names: %+v, %+v", defs[0], defs[1])
+	}
+
+	_, err = LoadSpaces(writeYAML(t, "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    card_resolver: {file: members.yaml}\n"))
+	if err == nil || !strings.Contains(err.Error(), "card_resolver: type is required") {
+		t.Fatalf("expected missing type error, got: %v", err)
+	}
+}
+
+func TestLoadSpaces_AutoClose(t *testing.T) {
+	defs, err := LoadSpaces(writeYAML(t, "spaces:\n  - slug: x\n    name: X\n    timezone: Europe/Rome\n    api_key: kkkkkkkkkkkkkkkk\n    auto_close: {at: '03:00', after: 12h}\n"))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	if p := defs[0].AutoClose; p == nil || p.At != "03:00" || p.After != "12h" {
+		t.Errorf("auto_close: %+v", p)
+	}
+
+	cases := []struct {
+		name, policy, want string
+	}{
+		{"empty", "{}", "at or after is required"},
+		{"bad time", "{at: '3am'}", "must be HH:MM"},
+		{"bad duration", "{after: forever}", "positive duration"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			yaml := "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    auto_close: " + c.policy + "\n"
+			_, err := LoadSpaces(writeYAML(t, yaml))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("expected %q, got: %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadSpaces_StatsHoursAndTimezone(t *testing.T) {
+	defs, err := LoadSpaces(writeYAML(t, "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    stats_hours: {from: 0, to: 23}\n"))
+	if err != nil {
+		t.Fatalf("LoadSpaces: %v", err)
+	}
+	if h := defs[0].StatsHours; h == nil || h.From != 0 || h.To != 23 {
+		t.Errorf("stats_hours: %+v", h)
+	}
+
+	cases := []struct {
+		name, extra, want string
+	}{
+		{"hours reversed", "stats_hours: {from: 21, to: 9}", "stats_hours"},
+		{"hour out of range", "stats_hours: {from: 9, to: 24}", "stats_hours"},
+		{"unknown timezone", "timezone: Mars/Olympus", "timezone"},
+		{"calendar threshold", "calendar: {likely_open_threshold: 1.5}", "likely_open_threshold"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			yaml := "spaces:\n  - slug: x\n    name: X\n    api_key: kkkkkkkkkkkkkkkk\n    " + c.extra + "\n"
+			_, err := LoadSpaces(writeYAML(t, yaml))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("expected %q, got: %v", c.want, err)
+			}
+		})
+	}
+}
+
 func TestLoadSpaces_EmptyFileRejected(t *testing.T) {
 	_, err := LoadSpaces(writeYAML(t, "spaces: []\n"))
 	if err == nil || !strings.Contains(err.Error(), "no spaces") {
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// AccessDecision is the audit record of one attempt to change a space's
+// status: the state asked for (Open), whether it was allowed and why.
+// CardHash is the SHA-256 of the normalised UID of the card presented, if
+// any, as on status rows, and ActorName the member it resolved to.
+type AccessDecision struct {
+	ID        uint      `gorm:"primarykey"`
+	SpaceID   uint      `gorm:"not null;index:idx_access_space_ts,priority:1"`
+	Timestamp time.Time `gorm:"not null;index:idx_access_space_ts,priority:2"`
+	Open      bool      `gorm:"not null"`
+	Allowed   bool      `gorm:"not null"`
+	Reason    string    `gorm:"not null"`
+	CardHash  string    `gorm:"not null;default:''"`
+	ActorName string    `gorm:"not null;default:''"`
+	ClientIP  string    `gorm:"not null;default:''"`
+}
+
+// CreateAccessDecision appends d to the access log.
+func (r *Repository) CreateAccessDecision(ctx context.Context, d *AccessDecision) error {
+	return r.Db.WithContext(ctx).Create(d).Error
+}
+
+// ListAccessDecisions returns the limit most recent decisions for spaceID,
+// newest first.
+func (r *Repository) ListAccessDecisions(ctx context.Context, spaceID uint, limit int) ([]AccessDecision, error) {
+	var decisions []AccessDecision
+	err := r.Db.WithContext(ctx).
+		Where("space_id = ?", spaceID).
+		Order("timestamp desc").
+		Order("id desc").
+		Limit(limit).
+		Find(&decisions).Error
+	return decisions, err
+}
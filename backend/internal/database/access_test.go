@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestListAccessDecisions_ScopedNewestFirst(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	a := seedSpace(t, repo, "spaceA")
+	b := seedSpace(t, repo, "spaceB")
+	base := time.Now().UTC()
+	for _, d := range []AccessDecision{
+		{SpaceID: a, Timestamp: base.Add(-2 * time.Minute), Open: true, Allowed: false, Reason: "no_card"},
+		{SpaceID: b, Timestamp: base.Add(-time.Minute), Open: true, Allowed: true, Reason: "member"},
+		{SpaceID: a, Timestamp: base, Open: true, Allowed: true, Reason: "member", CardHash: "4f2a", ActorName: "Mario"},
+	} {
+		if err := repo.CreateAccessDecision(ctx, &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.ListAccessDecisions(ctx, a, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Allowed || got[0].ActorName != "Mario" || got[1].Allowed || got[1].Reason != "no_card" {
+		t.Errorf("decisions: %+v", got)
+	}
+	if got, _ := repo.ListAccessDecisions(ctx, a, 1); len(got) != 1 {
+		t.Errorf("limit not applied: %d", len(got))
+	}
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrBackupUnsupported is returned for backups of non-SQLite databases,
+// which have their own tooling (pg_dump).
+var ErrBackupUnsupported = errors.New("backup and restore are only supported for SQLite; use pg_dump for PostgreSQL")
+
+// Backup writes a consistent snapshot of the live SQLite database to path,
+// gzip-compressed if compress is set. The snapshot is taken with VACUUM
+// INTO, which runs inside a read transaction and so doesn't block writers,
+// and is integrity-checked before being moved into place: path is only
+// written once the backup is known to be good.
+func (r *Repository) Backup(ctx context.Context, path string, compress bool) error {
+	if r.Dialect() != "sqlite" {
+		return ErrBackupUnsupported
+	}
+
+	snapshot, err := tempPath(filepath.Dir(path), ".sede-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshot)
+
+	if err := r.Db.WithContext(ctx).Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if err := checkSQLiteFile(ctx, snapshot); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	if !compress {
+		return os.Rename(snapshot, path)
+	}
+
+	compressed, err := tempPath(filepath.Dir(path), ".sede-backup-*.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(compressed)
+	if err := gzipFile(snapshot, compressed); err != nil {
+		return err
+	}
+	return os.Rename(compressed, path)
+}
+
+// preRestoreTimeLayout stamps the name the replaced database is kept under,
+// so every restore keeps its own copy.
+const preRestoreTimeLayout = "20060102T150405Z"
+
+// Restore replaces the SQLite database at dbPath with the backup at src,
+// which may be gzip-compressed. The backup is unpacked and checked next to
+// dbPath first, so a corrupt or too-new backup leaves the database
+// untouched. The replaced database is kept as
+// dbPath + ".pre-restore-<UTC time>", whose path is returned ("" if there
+// was none); Restore refuses rather than overwrite an earlier copy.
+// The server must not be running.
+func Restore(ctx context.Context, src, dbPath string) (string, error) {
+	staged, err := tempPath(filepath.Dir(dbPath), ".sede-restore-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(staged)
+
+	if err := unpackBackup(src, staged); err != nil {
+		return "", err
+	}
+	if err := checkSQLiteFile(ctx, staged); err != nil {
+		return "", fmt.Errorf("backup %s: %w", src, err)
+	}
+
+	var kept string
+	if _, err := os.Stat(dbPath); err == nil {
+		kept = dbPath + ".pre-restore-" + time.Now().UTC().Format(preRestoreTimeLayout)
+		if _, err := os.Lstat(kept); err == nil {
+			return "", fmt.Errorf("%s already exists", kept)
+		}
+		if err := os.Rename(dbPath, kept); err != nil {
+			return "", err
+		}
+	}
+	// A WAL left behind by the old database would be replayed onto the
+	// restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return kept, err
+		}
+	}
+	return kept, os.Rename(staged, dbPath)
+}
+
+// checkSQLiteFile runs SQLite's integrity check on the database at path and
+// makes sure its schema isn't newer than this release can migrate.
+func checkSQLiteFile(ctx context.Context, path string) error {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var result []string
+	if err := db.WithContext(ctx).Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(result) != 1 || result[0] != "ok" {
+		return fmt.Errorf("integrity check failed: %v", result)
+	}
+
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		var newest int
+		if err := db.WithContext(ctx).Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&newest).Error; err != nil {
+			return err
+		}
+		if newest > LatestSchemaVersion() {
+			return fmt.Errorf("schema version %d is newer than this release (%d)", newest, LatestSchemaVersion())
+		}
+	}
+	return nil
+}
+
+// unpackBackup copies src to dst, decompressing it if it starts with the
+// gzip magic number.
+func unpackBackup(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	br := bufio.NewReader(in)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return writeFile(dst, r)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, in)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	// Unblock the writer if writeFile gives up early.
+	defer pr.Close()
+	return writeFile(dst, pr)
+}
+
+// writeFile writes r to path and syncs it, so a rename afterwards never
+// exposes a partially written file.
+func writeFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// tempPath reserves an unused file name in dir; the file itself is removed
+// because VACUUM INTO refuses to overwrite.
+func tempPath(dir, pattern string) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), os.Remove(f.Name())
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "gzip"
+		}
+		t.Run(name, func(t *testing.T) {
+			repo := openSQLite(t)
+			ctx := context.Background()
+			if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 0); err != nil {
+				t.Fatal(err)
+			}
+			id := seedSpace(t, repo, "pescara")
+			if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: id, IsOpen: true, Timestamp: time.Now().UTC()}); err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			backup := filepath.Join(dir, "sede.db.bak")
+			if err := repo.Backup(ctx, backup, compress); err != nil {
+				t.Fatal(err)
+			}
+			head := make([]byte, 2)
+			f, _ := os.Open(backup)
+			f.Read(head)
+			f.Close()
+			if gzipped := head[0] == 0x1f && head[1] == 0x8b; gzipped != compress {
+				t.Errorf("gzipped = %v, want %v", gzipped, compress)
+			}
+
+			// Restore over an existing, different database.
+			dbPath := filepath.Join(dir, "restored.db")
+			os.WriteFile(dbPath, []byte("old"), 0o600)
+			kept, err := Restore(ctx, backup, dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(kept, dbPath+".pre-restore-") {
+				t.Errorf("kept as %q", kept)
+			}
+			if old, _ := os.ReadFile(kept); string(old) != "old" {
+				t.Errorf("previous database not kept: %q", old)
+			}
+
+			restored, err := New(config.Config{DatabasePath: dbPath})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if sqlDB, err := restored.Db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			}()
+			if _, err := restored.GetLatestStatus(ctx, id); err != nil {
+				t.Errorf("status missing after restore: %v", err)
+			}
+		})
+	}
+}
+
+func TestRestore_RejectsCorruptBackup(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "garbage.db")
+	os.WriteFile(backup, []byte("this is not a database"), 0o600)
+	dbPath := filepath.Join(dir, "sede.db")
+	os.WriteFile(dbPath, []byte("current"), 0o600)
+
+	if _, err := Restore(context.Background(), backup, dbPath); err == nil {
+		t.Fatal("expected corrupt backup to be rejected")
+	}
+	if cur, _ := os.ReadFile(dbPath); string(cur) != "current" {
+		t.Errorf("database replaced by a rejected backup: %q", cur)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".sede-restore-*")); len(leftovers) != 0 {
+		t.Errorf("staging files left behind: %v", leftovers)
+	}
+}
+
+func TestRestore_NeverOverwritesAnEarlierCopy(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "sede.db.bak")
+	if err := repo.Backup(ctx, backup, false); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(dir, "sede.db")
+	os.WriteFile(dbPath, []byte("current"), 0o600)
+
+	// Occupy every name the next few seconds could produce.
+	now := time.Now().UTC()
+	for i := range 3 {
+		name := dbPath + ".pre-restore-" + now.Add(time.Duration(i)*time.Second).Format(preRestoreTimeLayout)
+		os.WriteFile(name, []byte("earlier"), 0o600)
+	}
+
+	if _, err := Restore(ctx, backup, dbPath); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("err = %v, want a refusal", err)
+	}
+	if cur, _ := os.ReadFile(dbPath); string(cur) != "current" {
+		t.Errorf("database replaced: %q", cur)
+	}
+	copies, _ := filepath.Glob(dbPath + ".pre-restore-*")
+	for _, c := range copies {
+		if b, _ := os.ReadFile(c); string(b) != "earlier" {
+			t.Errorf("%s overwritten: %q", c, b)
+		}
+	}
+}
+
+func TestRestore_RejectsNewerSchema(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	repo.Db.Create(&schemaMigration{Version: LatestSchemaVersion() + 1, Name: "future", AppliedAt: time.Now().UTC()})
+
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "future.db")
+	if err := repo.Backup(ctx, backup, false); err == nil {
+		t.Fatal("expected backup of a newer schema to fail its check")
+	}
+	if _, err := os.Stat(backup); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed backup left %s behind", backup)
+	}
+}
+
+func TestBackup_RequiresSQLite(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	if repo.Dialect() == "sqlite" {
+		t.Skip("needs TEST_DATABASE_URL")
+	}
+	err := repo.Backup(context.Background(), filepath.Join(t.TempDir(), "x.db"), false)
+	if !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("err = %v, want ErrBackupUnsupported", err)
+	}
+}
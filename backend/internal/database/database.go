@@ -1,13 +1,18 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"reflect"
 	"time"
 
 	"github.com/metro-olografix/sede/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -26,7 +31,18 @@ type Repository struct {
 // Space is one physical association location served by this instance.
 // The API key is stored as a bcrypt hash; per-space Telegram chat and thread
 // IDs route notifications without a global bot configuration. Projects and
-// Links hold JSON-encoded arrays used by the per-space SpaceAPI response.
+// Links hold JSON-encoded arrays used by the per-space SpaceAPI response;
+// Webhooks holds the JSON-encoded outgoing webhook targets (URL + signing
+// secret) read by the delivery worker, and Notifiers the JSON-encoded
+// notification backends enabled on top of the Telegram chat/thread.
+// CardResolver holds the JSON-encoded card identity backend, if any;
+// RequireCard restricts opening to cards it resolves to a member, and
+// HideNames keeps who toggled off the public endpoints.
+// Feeds, Sensors, MembershipPlans, Areas and SpaceFed hold the optional
+// SpaceAPI v15 sections as JSON, in the shape they are published.
+//
+// FileState records what spaces.yaml last set for the space (see
+// SyncFileSpace); it is empty for spaces created through the admin API.
 type Space struct {
 	ID             uint   `gorm:"primarykey"`
 	Slug           string `gorm:"uniqueIndex;not null"`
@@ -44,27 +60,72 @@ type Space struct {
 	TelegramThread int
 	Projects       string
 	Links          string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	Webhooks       string
+	Notifiers      string
+	AutoClose      string
+	StatsHours     string
+	Calendar       string
+	CardResolver   string
+	RequireCard    bool
+	HideNames      bool
+
+	IconOpen         string
+	IconClosed       string
+	ContactMatrix    string
+	ContactMastodon  string
+	ContactIRC       string
+	ContactPhone     string
+	ContactIssueMail string
+	Feeds            string
+	Sensors          string
+	MembershipPlans  string
+	Areas            string
+	SpaceFed         string
+
+	FileState string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// SedeStatus is an open/closed event for a specific space. `default:0` on
-// SpaceID exists solely so that adding the column via SQLite ALTER TABLE on
-// an existing single-space DB succeeds; new rows always set SpaceID
-// explicitly, and boot-time backfill rewrites any legacy zeros.
+// SedeStatus is an open/closed event for a specific space. Rows recorded
+// before multi-space support are assigned to the default space by migration
+// 3 (see migrations.go).
 //
 // Reason is an optional tag explaining a non-standard closure (e.g. "gelatino"
 // when the sede is closed because everyone went for ice cream). Empty on
 // normal toggles. Stored as a plain string column to keep the schema simple
 // and the ESP32 client free to send arbitrary reasons over the wire.
+//
+// ActorName is the display name resolved from the card that triggered the
+// change, if any. Persisting it lets event-stream clients that resume via
+// Last-Event-ID see the same "who" as clients that were connected live.
+//
+// The remaining actor fields are for the admin view: CardHash is the
+// SHA-256 of the normalised card UID (so repeated openings by one card can
+// be told apart without storing the UID itself), Source how the change came
+// in (one of the Source* constants; empty for history imported without it) and
+// ClientIP the address of the request, if there was one.
 type SedeStatus struct {
 	ID        uint      `gorm:"primarykey"`
-	SpaceID   uint      `gorm:"not null;default:0;index:idx_space_timestamp,priority:1"`
+	SpaceID   uint      `gorm:"not null;index:idx_space_timestamp,priority:1"`
 	IsOpen    bool      `gorm:"not null"`
 	Reason    string    `gorm:"default:''"`
+	ActorName string    `gorm:"default:''"`
+	CardHash  string    `gorm:"default:''"`
+	Source    string    `gorm:"default:''"`
+	ClientIP  string    `gorm:"default:''"`
 	Timestamp time.Time `gorm:"not null;index:idx_space_timestamp,priority:2"`
 }
 
+// Sources of a status change.
+const (
+	SourceButton    = "button"    // a toggle presenting a card, i.e. the physical button
+	SourceAPI       = "api"       // a toggle without a card
+	SourceAdmin     = "admin"     // the admin API
+	SourceScheduler = "scheduler" // auto_close
+)
+
 type DailyStats struct {
 	Date        string  `json:"date" validate:"required,datetime=2006-01-02"`
 	Probability float64 `json:"probability" validate:"required,min=0,max=1"`
@@ -81,14 +142,34 @@ type WeeklyStatsDetailed struct {
 	Hourly           []HourlyStat `json:"hourly"`
 }
 
+// New opens the configured database and migrates its schema to the latest
+// version.
 func New(cfg config.Config) (*Repository, error) {
+	r, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.MigrateUp(context.Background(), MigrateOptions{DefaultSpaceSlug: cfg.DefaultSpaceSlug}, 0); err != nil {
+		return nil, fmt.Errorf("migrate schema: %w", err)
+	}
+	return r, nil
+}
+
+// Open connects to the configured database without touching its schema;
+// `sede migrate` uses it to inspect and move between versions.
+func Open(cfg config.Config) (*Repository, error) {
 	gormConfig := &gorm.Config{
-		Logger:         createLogger(cfg.Debug),
+		Logger:         newGormLogger(),
 		PrepareStmt:    true,
 		TranslateError: true,
 	}
 
-	db, err := gorm.Open(sqlite.Open(cfg.DatabasePath), gormConfig)
+	dialector, err := openDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, gormConfig)
 	if err != nil {
 		return nil, fmt.Errorf("database connection failed: %w", err)
 	}
@@ -97,11 +178,26 @@ func New(cfg config.Config) (*Repository, error) {
 		return nil, err
 	}
 
-	if err := migrateSchema(db); err != nil {
+	return &Repository{Db: db}, nil
+}
+
+// openDialector picks the GORM driver for the configured database.
+func openDialector(cfg config.Config) (gorm.Dialector, error) {
+	driver, dsn, err := cfg.Database()
+	if err != nil {
 		return nil, err
 	}
+	switch driver {
+	case config.DriverPostgres:
+		return postgres.Open(dsn), nil
+	default:
+		return sqlite.Open(dsn), nil
+	}
+}
 
-	return &Repository{Db: db}, nil
+// Dialect names the SQL dialect in use ("sqlite" or "postgres").
+func (r *Repository) Dialect() string {
+	return r.Db.Dialector.Name()
 }
 
 func (r *Repository) GetLatestStatus(ctx context.Context, spaceID uint) (SedeStatus, error) {
@@ -113,123 +209,135 @@ func (r *Repository) GetLatestStatus(ctx context.Context, spaceID uint) (SedeSta
 	return status, err
 }
 
-func (r *Repository) CreateStatus(ctx context.Context, status SedeStatus) error {
-	return r.Db.WithContext(ctx).Create(&status).Error
+// CreateStatus inserts status and fills in its assigned ID, which doubles as
+// the event ID on the SSE stream.
+func (r *Repository) CreateStatus(ctx context.Context, status *SedeStatus) error {
+	return r.Db.WithContext(ctx).Create(status).Error
 }
 
-func (r *Repository) GetStatistics(ctx context.Context, spaceID uint) ([]DailyStats, int64, error) {
-	var totalChanges int64
-	var dailyStats []DailyStats
+// CreateStatusWithWebhooks is CreateStatus that also writes the webhook
+// deliveries announcing status, in the same transaction: either both are
+// stored or neither is. deliveries may be nil.
+func (r *Repository) CreateStatusWithWebhooks(ctx context.Context, status *SedeStatus, deliveries WebhookDeliveries) error {
+	return r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createStatus(tx, status, deliveries)
+	})
+}
 
+func createStatus(tx *gorm.DB, status *SedeStatus, deliveries WebhookDeliveries) error {
+	if err := tx.Create(status).Error; err != nil {
+		return err
+	}
+	if deliveries == nil {
+		return nil
+	}
+	ds, err := deliveries(status)
+	if err != nil || len(ds) == 0 {
+		return err
+	}
+	return tx.Create(&ds).Error
+}
+
+// statusLockClass is the first key of the PostgreSQL advisory locks taken
+// per space by CreateStatusIfLatest; the space ID is the second.
+const statusLockClass = 0x5ede
+
+// CreateStatusIfLatest inserts status only if the latest status of its
+// space is still the one with ID latestID (0 for none), and reports whether
+// it did. Background jobs use it so a change made meanwhile, by a request
+// or by another replica running the same job, is never overwritten.
+// deliveries are written with status as in CreateStatusWithWebhooks. On
+// PostgreSQL the check and the insert hold a per-space advisory lock;
+// SQLite serialises writers anyway.
+func (r *Repository) CreateStatusIfLatest(ctx context.Context, status *SedeStatus, latestID uint, deliveries WebhookDeliveries) (bool, error) {
+	created := false
 	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&SedeStatus{}).Where("space_id = ?", spaceID).Count(&totalChanges).Error; err != nil {
+		if r.Dialect() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", statusLockClass, int32(status.SpaceID)).Error; err != nil {
+				return err
+			}
+		}
+		var latest SedeStatus
+		err := tx.Where("space_id = ?", status.SpaceID).Order("timestamp desc").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 			return err
 		}
-
-		return tx.Raw(
-			`SELECT strftime(?, timestamp) as date,
-					COUNT(*) * 1.0 / ? as probability
-			 FROM sede_statuses
-			 WHERE space_id = ?
-			   AND timestamp >= date('now', ?)
-			 GROUP BY date
-			 ORDER BY date`,
-			statsDateLayout,
-			analysisDays,
-			spaceID,
-			fmt.Sprintf("-%d days", analysisDays),
-		).Scan(&dailyStats).Error
+		if latest.ID != latestID {
+			return nil
+		}
+		created = true
+		return createStatus(tx, status, deliveries)
 	})
-
-	return dailyStats, totalChanges, err
+	return created && err == nil, err
 }
 
-// GetWeeklyStats fetches daily and hourly probabilities for the given space
-// over the last 90 days, grouped by weekday and (9-21 UTC) hour.
-func (r *Repository) GetWeeklyStats(ctx context.Context, spaceID uint) ([]WeeklyStatsDetailed, error) {
-	var dailyStats []struct {
-		Day              string  `json:"day"`
-		DailyProbability float64 `json:"dailyProbability"`
-	}
-	err := r.Db.WithContext(ctx).Raw(`
-        SELECT
-            CASE strftime('%w', timestamp)
-                WHEN '0' THEN 'Sunday'
-                WHEN '1' THEN 'Monday'
-                WHEN '2' THEN 'Tuesday'
-                WHEN '3' THEN 'Wednesday'
-                WHEN '4' THEN 'Thursday'
-                WHEN '5' THEN 'Friday'
-                ELSE 'Saturday' END as day,
-            AVG(CASE WHEN is_open THEN 1.0 ELSE 0.0 END) as dailyProbability
-        FROM sede_statuses
-        WHERE space_id = ?
-          AND timestamp >= date('now', '-90 days')
-        GROUP BY day
-        ORDER BY strftime('%w', timestamp)
-    `, spaceID).Scan(&dailyStats).Error
-	if err != nil {
+// ListStatusesAfter returns up to limit status rows for spaceID whose ID is
+// greater than afterID, oldest first. Used to replay missed events to SSE
+// clients reconnecting with Last-Event-ID. Rows older than afterID's are
+// left out: ImportStatuses gives past history IDs above the live rows, and
+// those changes are not news to a reconnecting client.
+func (r *Repository) ListStatusesAfter(ctx context.Context, spaceID, afterID uint, limit int) ([]SedeStatus, error) {
+	db := r.Db.WithContext(ctx)
+	q := db.Where("space_id = ? AND id > ?", spaceID, afterID)
+
+	var after SedeStatus
+	err := db.Select("timestamp").Where("space_id = ? AND id = ?", spaceID, afterID).Take(&after).Error
+	switch {
+	case err == nil:
+		q = q.Where("timestamp >= ?", after.Timestamp.UTC())
+	case !errors.Is(err, gorm.ErrRecordNotFound):
 		return nil, err
 	}
 
-	var hourlyStats []struct {
-		Day         string  `json:"day"`
-		Hour        string  `json:"hour"`
-		Probability float64 `json:"probability"`
-	}
-	err = r.Db.WithContext(ctx).Raw(`
-        SELECT
-            CASE strftime('%w', timestamp)
-                WHEN '0' THEN 'Sunday'
-                WHEN '1' THEN 'Monday'
-                WHEN '2' THEN 'Tuesday'
-                WHEN '3' THEN 'Wednesday'
-                WHEN '4' THEN 'Thursday'
-                WHEN '5' THEN 'Friday'
-                ELSE 'Saturday' END as day,
-            strftime('%H', timestamp) as hour,
-            AVG(CASE WHEN is_open THEN 1.0 ELSE 0.0 END) as probability
-        FROM sede_statuses
-        WHERE space_id = ?
-          AND timestamp >= date('now', '-90 days')
-          AND CAST(strftime('%H', timestamp) as integer) BETWEEN 9 AND 21
-        GROUP BY day, hour
-        ORDER BY strftime('%w', timestamp), hour
-    `, spaceID).Scan(&hourlyStats).Error
-	if err != nil {
-		return nil, err
-	}
+	var statuses []SedeStatus
+	err = q.Order("id asc").Limit(limit).Find(&statuses).Error
+	return statuses, err
+}
 
-	weeklyMap := make(map[string]*WeeklyStatsDetailed)
-	for _, ds := range dailyStats {
-		weeklyMap[ds.Day] = &WeeklyStatsDetailed{
-			Day:              ds.Day,
-			DailyProbability: ds.DailyProbability,
-			Hourly:           []HourlyStat{},
-		}
-	}
-	for _, hs := range hourlyStats {
-		if stat, ok := weeklyMap[hs.Day]; ok {
-			stat.Hourly = append(stat.Hourly, HourlyStat{
-				Hour:        hs.Hour,
-				Probability: hs.Probability,
-			})
-		} else {
-			weeklyMap[hs.Day] = &WeeklyStatsDetailed{
-				Day:    hs.Day,
-				Hourly: []HourlyStat{{Hour: hs.Hour, Probability: hs.Probability}},
-			}
+// RecentStatuses returns the limit most recent status rows across every
+// space, newest first, for the admin dashboard.
+func (r *Repository) RecentStatuses(ctx context.Context, limit int) ([]SedeStatus, error) {
+	var statuses []SedeStatus
+	err := r.Db.WithContext(ctx).
+		Order("timestamp desc").
+		Order("id desc").
+		Limit(limit).
+		Find(&statuses).Error
+	return statuses, err
+}
+
+// GetStatistics returns the space's total number of status changes and,
+// for each UTC day of the last analysisDays that had any, its share of
+// them. Days are bucketed in Go rather than with SQL date functions, which
+// differ between SQLite and PostgreSQL.
+func (r *Repository) GetStatistics(ctx context.Context, spaceID uint) ([]DailyStats, int64, error) {
+	var totalChanges int64
+	var timestamps []time.Time
+	since := time.Now().UTC().AddDate(0, 0, -analysisDays).Truncate(24 * time.Hour)
+
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&SedeStatus{}).Where("space_id = ?", spaceID).Count(&totalChanges).Error; err != nil {
+			return err
 		}
+		return tx.Model(&SedeStatus{}).
+			Where("space_id = ? AND timestamp >= ?", spaceID, since).
+			Order("timestamp asc").
+			Pluck("timestamp", &timestamps).Error
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	daysOrder := []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
-	result := []WeeklyStatsDetailed{}
-	for _, day := range daysOrder {
-		if stat, exists := weeklyMap[day]; exists {
-			result = append(result, *stat)
+	var dailyStats []DailyStats
+	for _, ts := range timestamps {
+		date := ts.UTC().Format(statsDateLayout)
+		if n := len(dailyStats); n > 0 && dailyStats[n-1].Date == date {
+			dailyStats[n-1].Probability += 1.0 / analysisDays
+			continue
 		}
+		dailyStats = append(dailyStats, DailyStats{Date: date, Probability: 1.0 / analysisDays})
 	}
-	return result, nil
+	return dailyStats, totalChanges, nil
 }
 
 // GetSpaceBySlug returns the space with the given slug, or
@@ -242,6 +350,16 @@ func (r *Repository) GetSpaceBySlug(ctx context.Context, slug string) (*Space, e
 	return &sp, nil
 }
 
+// GetSpaceByID returns the space with the given ID, or
+// gorm.ErrRecordNotFound if none exists.
+func (r *Repository) GetSpaceByID(ctx context.Context, id uint) (*Space, error) {
+	var sp Space
+	if err := r.Db.WithContext(ctx).First(&sp, id).Error; err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
 // ListSpaces returns every space in the database, ordered by ID.
 func (r *Repository) ListSpaces(ctx context.Context) ([]Space, error) {
 	var spaces []Space
@@ -249,18 +367,30 @@ func (r *Repository) ListSpaces(ctx context.Context) ([]Space, error) {
 	return spaces, err
 }
 
+// fileSpaceFields are the Space fields declared in spaces.yaml, i.e. every
+// mutable one but the API key hash.
+var fileSpaceFields = []string{
+	"Name", "Address", "Lat", "Lon", "Timezone",
+	"LogoURL", "URL", "ContactEmail", "Message",
+	"TelegramChatID", "TelegramThread",
+	"Projects", "Links", "Webhooks", "Notifiers", "AutoClose",
+	"StatsHours", "Calendar", "CardResolver", "RequireCard", "HideNames",
+	"IconOpen", "IconClosed", "ContactMatrix", "ContactMastodon",
+	"ContactIRC", "ContactPhone", "ContactIssueMail",
+	"Feeds", "Sensors", "MembershipPlans", "Areas", "SpaceFed",
+}
+
 // UpsertSpace inserts s if its slug is new, otherwise updates every
 // mutable column on the existing row. Returns the persisted row including
 // its assigned ID so callers can cache it.
 func (r *Repository) UpsertSpace(ctx context.Context, s Space) (*Space, error) {
+	columns := make([]string, 0, len(fileSpaceFields)+2)
+	for _, f := range fileSpaceFields {
+		columns = append(columns, r.Db.NamingStrategy.ColumnName("", f))
+	}
 	err := r.Db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "slug"}},
-		DoUpdates: clause.AssignmentColumns([]string{
-			"name", "address", "lat", "lon", "timezone",
-			"logo_url", "url", "contact_email", "message",
-			"api_key_hash", "telegram_chat_id", "telegram_thread",
-			"projects", "links", "updated_at",
-		}),
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "api_key_hash", "updated_at")),
 	}).Create(&s).Error
 	if err != nil {
 		return nil, err
@@ -270,35 +400,225 @@ func (r *Repository) UpsertSpace(ctx context.Context, s Space) (*Space, error) {
 	return r.GetSpaceBySlug(ctx, s.Slug)
 }
 
-// BackfillDefaultSpaceID rewrites any sede_statuses rows still carrying the
-// migration default (space_id = 0) to point at spaceID. Returns the number
-// of rows updated so the caller can log it.
-func (r *Repository) BackfillDefaultSpaceID(ctx context.Context, spaceID uint) (int64, error) {
-	if spaceID == 0 {
-		return 0, fmt.Errorf("refusing to backfill to space_id = 0")
+// APIKeyHashCost is the bcrypt cost of new space API key hashes. Tests
+// lower it, since at the default cost hashing and checking keys dominates
+// their run time under the race detector.
+var APIKeyHashCost = bcrypt.DefaultCost
+
+// HashAPIKey returns the bcrypt hash stored for a space API key.
+func HashAPIKey(apiKey string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(apiKey), APIKeyHashCost)
+}
+
+// fileState is the JSON stored in Space.FileState: the value spaces.yaml
+// last set for each of fileSpaceFields, and the bcrypt hash of its API key.
+type fileState struct {
+	Fields  map[string]json.RawMessage `json:"fields"`
+	KeyHash []byte                     `json:"key_hash"`
+}
+
+// SyncFileSpace applies s, a space declared in spaces.yaml whose API key is
+// apiKey, and returns the persisted row. A new space is inserted whole; an
+// existing one only gets the columns whose value in the file changed since
+// the previous sync, and a new key hash only when the file's key changed.
+// Edits made in between through the admin API (PATCH, rotate-key) thus
+// survive reloads and restarts until the file itself changes them.
+func (r *Repository) SyncFileSpace(ctx context.Context, s Space, apiKey string) (*Space, error) {
+	var synced Space
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var cur Space
+		err := tx.Where("slug = ?", s.Slug).First(&cur).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var prev fileState
+		if cur.FileState != "" {
+			if err := json.Unmarshal([]byte(cur.FileState), &prev); err != nil {
+				return fmt.Errorf("space %q file state: %w", s.Slug, err)
+			}
+		}
+
+		next := fileState{Fields: make(map[string]json.RawMessage, len(fileSpaceFields)), KeyHash: prev.KeyHash}
+		updates := make(map[string]any)
+		v := reflect.ValueOf(s)
+		for _, f := range fileSpaceFields {
+			val := v.FieldByName(f).Interface()
+			raw, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			next.Fields[f] = raw
+			if old, ok := prev.Fields[f]; !ok || !bytes.Equal(old, raw) {
+				updates[tx.NamingStrategy.ColumnName("", f)] = val
+			}
+		}
+		if prev.KeyHash == nil || bcrypt.CompareHashAndPassword(prev.KeyHash, []byte(apiKey)) != nil {
+			hash, err := HashAPIKey(apiKey)
+			if err != nil {
+				return fmt.Errorf("hash api key for space %q: %w", s.Slug, err)
+			}
+			next.KeyHash = hash
+			updates["api_key_hash"] = hash
+		}
+		state, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+
+		if cur.ID == 0 {
+			s.APIKeyHash, s.FileState = next.KeyHash, string(state)
+			if err := tx.Create(&s).Error; err != nil {
+				return err
+			}
+			synced = s
+			return nil
+		}
+		updates["file_state"] = string(state)
+		if err := tx.Model(&cur).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&synced, cur.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &synced, nil
+}
+
+// CreateSpace inserts s and fails with gorm.ErrDuplicatedKey when its slug
+// is already taken.
+func (r *Repository) CreateSpace(ctx context.Context, s Space) (*Space, error) {
+	if err := r.Db.WithContext(ctx).Create(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateSpaceAPIKeyHash replaces the stored API key hash of the space with
+// the given ID and returns the updated row.
+func (r *Repository) UpdateSpaceAPIKeyHash(ctx context.Context, id uint, hash []byte) (*Space, error) {
+	res := r.Db.WithContext(ctx).Model(&Space{}).Where("id = ?", id).Update("api_key_hash", hash)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.GetSpaceByID(ctx, id)
+}
+
+// DeleteSpace removes the space row with the credentials and card scopes
+// tied to it: its devices, its API tokens and its card_spaces rows. Cards
+// left without any space would open every space, so they are deactivated
+// instead. Its history (statuses, sensor readings, access log) is kept, in
+// line with spaces.yaml removals, so a deleted space can be recreated later
+// without losing data.
+func (r *Repository) DeleteSpace(ctx context.Context, id uint) error {
+	return r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&Space{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("space_id = ?", id).Delete(&Device{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("space_id = ?", id).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+
+		var cardIDs []uint
+		if err := tx.Model(&CardSpace{}).Where("space_id = ?", id).Pluck("card_id", &cardIDs).Error; err != nil {
+			return err
+		}
+		if len(cardIDs) == 0 {
+			return nil
+		}
+		if err := tx.Where("space_id = ?", id).Delete(&CardSpace{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Card{}).
+			Where("id IN ?", cardIDs).
+			Where("NOT EXISTS (SELECT 1 FROM card_spaces WHERE card_spaces.card_id = cards.id)").
+			Update("active", false).Error
+	})
+}
+
+// Transaction runs fn with a Repository bound to a single transaction,
+// committed if fn returns nil and rolled back otherwise. Repository methods
+// that open their own transaction run as savepoints inside it.
+func (r *Repository) Transaction(ctx context.Context, fn func(tx *Repository) error) error {
+	return r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repository{Db: tx})
+	})
+}
+
+// slowQueryThreshold is the duration above which a statement is logged as
+// a warning.
+const slowQueryThreshold = time.Second
+
+// gormLogger routes GORM's logging to slog. It logs with the query's
+// context, so statements run on behalf of an HTTP request carry its
+// request ID. Every statement is logged at debug level; slow ones at warn
+// and failed ones (other than "record not found") at error.
+type gormLogger struct {
+	level logger.LogLevel
+}
+
+func newGormLogger() logger.Interface {
+	return gormLogger{level: logger.Info}
+}
+
+func (l gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return gormLogger{level: level}
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
 	}
-	res := r.Db.WithContext(ctx).
-		Model(&SedeStatus{}).
-		Where("space_id = ?", 0).
-		Update("space_id", spaceID)
-	return res.RowsAffected, res.Error
 }
 
-func createLogger(debug bool) logger.Interface {
-	logLevel := logger.Silent
-	if debug {
-		logLevel = logger.Info
+func (l gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
 	}
+}
 
-	return logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold:             time.Second,
-			LogLevel:                  logLevel,
-			IgnoreRecordNotFoundError: true,
-			Colorful:                  false,
-		},
-	)
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		level = slog.LevelError
+	case elapsed > slowQueryThreshold && l.level >= logger.Warn:
+		level = slog.LevelWarn
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []any{"sql", sql, "rows", rows, "duration_ms", float64(elapsed.Microseconds()) / 1000}
+	msg := "query"
+	switch level {
+	case slog.LevelError:
+		msg = "query failed"
+		attrs = append(attrs, "error", err)
+	case slog.LevelWarn:
+		msg = "slow query"
+	}
+	slog.Log(ctx, level, msg, attrs...)
 }
 
 func configureConnectionPool(db *gorm.DB) error {
@@ -315,7 +635,3 @@ func configureConnectionPool(db *gorm.DB) error {
 	defer cancel()
 	return sqlDB.PingContext(ctx)
 }
-
-func migrateSchema(db *gorm.DB) error {
-	return db.AutoMigrate(&Space{}, &SedeStatus{})
-}
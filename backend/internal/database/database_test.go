@@ -1,17 +1,35 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/logging"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
+func TestMain(m *testing.M) {
+	APIKeyHashCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// setupTestDB opens a fresh repository on a temporary SQLite file or, when
+// TEST_DATABASE_URL points at a PostgreSQL server, on a throwaway schema
+// there, so the whole suite can run against either backend.
 func setupTestDB(t *testing.T) (*Repository, func()) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -20,6 +38,9 @@ func setupTestDB(t *testing.T) (*Repository, func()) {
 		DatabasePath: dbPath,
 		Debug:        false,
 	}
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		cfg.DatabaseURL = postgresTestSchema(t, url)
+	}
 
 	repo, err := New(cfg)
 	if err != nil {
@@ -36,6 +57,32 @@ func setupTestDB(t *testing.T) (*Repository, func()) {
 	return repo, cleanup
 }
 
+// postgresTestSchema creates an empty schema on the server at url, dropped
+// when the test ends, and returns url with its search_path pointing there.
+func postgresTestSchema(t *testing.T, url string) string {
+	t.Helper()
+	admin, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect to TEST_DATABASE_URL: %v", err)
+	}
+	schema := fmt.Sprintf("sede_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return url + sep + "search_path=" + schema
+}
+
 // seedSpace persists a space with the given slug and returns its ID. Tests
 // that insert SedeStatus rows need a space ID so the scoped queries have
 // something to find.
@@ -162,6 +209,114 @@ func TestUpsertSpace_InsertAndUpdate(t *testing.T) {
 	}
 }
 
+func TestSyncFileSpace_KeepsAdminEditsUntilTheFileChanges(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	def := Space{Slug: "pescara", Name: "Pescara", Message: "ciao"}
+	first, err := repo.SyncFileSpace(ctx, def, "file-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FileState == "" || bcrypt.CompareHashAndPassword(first.APIKeyHash, []byte("file-key")) != nil {
+		t.Fatalf("insert: %+v", first)
+	}
+
+	// Admin edits: a PATCH and a key rotation.
+	edited := *first
+	edited.Message, edited.APIKeyHash = "chiusi per ferie", []byte("rotated")
+	if _, err := repo.UpsertSpace(ctx, edited); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := repo.SyncFileSpace(ctx, def, "file-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || again.Message != "chiusi per ferie" || string(again.APIKeyHash) != "rotated" {
+		t.Errorf("unchanged file reverted admin edits: %+v", again)
+	}
+
+	def.Name = "Pescara Centro"
+	changed, err := repo.SyncFileSpace(ctx, def, "new-file-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Name != "Pescara Centro" || changed.Message != "chiusi per ferie" {
+		t.Errorf("file changes not applied column by column: %+v", changed)
+	}
+	if bcrypt.CompareHashAndPassword(changed.APIKeyHash, []byte("new-file-key")) != nil {
+		t.Error("changed file key not applied")
+	}
+}
+
+func TestCreateStatusIfLatest(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	spaceID := seedSpace(t, repo, "pescara")
+	now := time.Now().UTC()
+
+	opened := SedeStatus{SpaceID: spaceID, IsOpen: true, Timestamp: now.Add(-2 * time.Hour)}
+	if ok, err := repo.CreateStatusIfLatest(ctx, &opened, 0, nil); !ok || err != nil {
+		t.Fatalf("first status: %v %v", ok, err)
+	}
+
+	// A toggle lands after the scheduler read the latest status.
+	toggled := SedeStatus{SpaceID: spaceID, IsOpen: false, Timestamp: now.Add(-time.Hour)}
+	if err := repo.CreateStatus(ctx, &toggled); err != nil {
+		t.Fatal(err)
+	}
+	stale := SedeStatus{SpaceID: spaceID, IsOpen: false, Reason: "auto", Timestamp: now}
+	if ok, err := repo.CreateStatusIfLatest(ctx, &stale, opened.ID, nil); ok || err != nil {
+		t.Errorf("insert over a newer status: %v %v", ok, err)
+	}
+
+	closed := SedeStatus{SpaceID: spaceID, IsOpen: false, Reason: "auto", Timestamp: now}
+	if ok, err := repo.CreateStatusIfLatest(ctx, &closed, toggled.ID, nil); !ok || err != nil {
+		t.Errorf("insert after the latest status: %v %v", ok, err)
+	}
+	// A second replica that read the same latest status loses.
+	again := SedeStatus{SpaceID: spaceID, IsOpen: false, Reason: "auto", Timestamp: now}
+	if ok, err := repo.CreateStatusIfLatest(ctx, &again, toggled.ID, nil); ok || err != nil {
+		t.Errorf("duplicate insert: %v %v", ok, err)
+	}
+}
+
+func TestCreateStatusWithWebhooks(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	spaceID := seedSpace(t, repo, "pescara")
+	now := time.Now().UTC()
+
+	deliveries := func(s *SedeStatus) ([]WebhookDelivery, error) {
+		return []WebhookDelivery{{SpaceID: spaceID, URL: "https://a.example/hook", Event: "status.changed",
+			Payload: fmt.Sprint(s.ID), NextAttemptAt: s.Timestamp}}, nil
+	}
+	status := SedeStatus{SpaceID: spaceID, IsOpen: true, Timestamp: now}
+	if err := repo.CreateStatusWithWebhooks(ctx, &status, deliveries); err != nil {
+		t.Fatal(err)
+	}
+	var d WebhookDelivery
+	if err := repo.Db.First(&d).Error; err != nil || d.Payload != fmt.Sprint(status.ID) {
+		t.Errorf("delivery %+v, %v", d, err)
+	}
+
+	boom := errors.New("boom")
+	failed := SedeStatus{SpaceID: spaceID, IsOpen: false, Timestamp: now.Add(time.Minute)}
+	err := repo.CreateStatusWithWebhooks(ctx, &failed, func(*SedeStatus) ([]WebhookDelivery, error) { return nil, boom })
+	if !errors.Is(err, boom) {
+		t.Errorf("err = %v", err)
+	}
+	var n int64
+	repo.Db.Model(&SedeStatus{}).Count(&n)
+	if n != 1 {
+		t.Errorf("%d status rows, want the failed one rolled back", n)
+	}
+}
+
 func TestGetSpaceBySlug(t *testing.T) {
 	repo, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -183,6 +338,112 @@ func TestGetSpaceBySlug(t *testing.T) {
 	}
 }
 
+func TestCreateSpace_DuplicateSlug(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sp, err := repo.CreateSpace(ctx, Space{Slug: "chieti", Name: "Chieti", APIKeyHash: []byte("h")})
+	if err != nil || sp.ID == 0 {
+		t.Fatalf("create: %v %+v", err, sp)
+	}
+	_, err = repo.CreateSpace(ctx, Space{Slug: "chieti", Name: "Again", APIKeyHash: []byte("h")})
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("duplicate slug should be ErrDuplicatedKey, got %v", err)
+	}
+}
+
+func TestUpdateSpaceAPIKeyHashAndDelete(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	id := seedSpace(t, repo, "pescara")
+	updated, err := repo.UpdateSpaceAPIKeyHash(ctx, id, []byte("new-hash"))
+	if err != nil || string(updated.APIKeyHash) != "new-hash" {
+		t.Fatalf("rotate: %v %+v", err, updated)
+	}
+	if _, err := repo.UpdateSpaceAPIKeyHash(ctx, 9999, []byte("x")); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("rotate unknown id: %v", err)
+	}
+
+	if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: id, IsOpen: true, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteSpace(ctx, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := repo.GetSpaceBySlug(ctx, "pescara"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("space still present after delete: %v", err)
+	}
+	if _, err := repo.GetLatestStatus(ctx, id); err != nil {
+		t.Errorf("history should survive space deletion: %v", err)
+	}
+	if err := repo.DeleteSpace(ctx, id); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("second delete: %v", err)
+	}
+}
+
+func TestDeleteSpace_RemovesCredentialsAndCardScopes(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	pescara := seedSpace(t, repo, "pescara")
+	aquila := seedSpace(t, repo, "aquila")
+	for _, id := range []uint{pescara, aquila} {
+		if err := repo.CreateDevice(ctx, &Device{SpaceID: id, Name: "button", KeyHash: DeviceKeyHash(fmt.Sprint("k", id))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scoped := APIToken{Name: "bot", TokenHash: APITokenHash("sede_bot"), Scopes: ScopeStatusWrite, SpaceID: &pescara}
+	global := APIToken{Name: "ops", TokenHash: APITokenHash("sede_ops"), Scopes: ScopeAdmin}
+	for _, tok := range []*APIToken{&scoped, &global} {
+		if err := repo.CreateAPIToken(ctx, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, card := range map[string]NewCard{
+		"only-pescara": {UID: "01", Hash: "h", SpaceIDs: []uint{pescara}},
+		"both":         {UID: "02", Hash: "h", SpaceIDs: []uint{pescara, aquila}},
+		"everywhere":   {UID: "03", Hash: "h"},
+	} {
+		if _, err := repo.CreateMember(ctx, name, card); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.DeleteSpace(ctx, pescara); err != nil {
+		t.Fatal(err)
+	}
+
+	var devices, tokens, scopes int64
+	repo.Db.Model(&Device{}).Where("space_id = ?", pescara).Count(&devices)
+	repo.Db.Model(&APIToken{}).Where("space_id = ?", pescara).Count(&tokens)
+	repo.Db.Model(&CardSpace{}).Where("space_id = ?", pescara).Count(&scopes)
+	if devices != 0 || tokens != 0 || scopes != 0 {
+		t.Errorf("left behind %d devices, %d tokens, %d card scopes", devices, tokens, scopes)
+	}
+	if _, err := repo.AuthenticateAPIToken(ctx, "sede_ops", time.Now()); err != nil {
+		t.Errorf("global token removed: %v", err)
+	}
+	repo.Db.Model(&Device{}).Where("space_id = ?", aquila).Count(&devices)
+	if devices != 1 {
+		t.Errorf("other space's devices: %d", devices)
+	}
+
+	// The card scoped only to pescara must not start opening every space.
+	active := map[string]bool{}
+	var cards []Card
+	repo.Db.Find(&cards)
+	for _, c := range cards {
+		active[c.UID] = c.Active
+	}
+	if want := map[string]bool{"01": false, "02": true, "03": true}; !reflect.DeepEqual(active, want) {
+		t.Errorf("active cards %v, want %v", active, want)
+	}
+}
+
 func TestGetLatestStatus_ScopedPerSpace(t *testing.T) {
 	repo, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -193,7 +454,7 @@ func TestGetLatestStatus_ScopedPerSpace(t *testing.T) {
 
 	base := time.Now().UTC()
 	mustCreate := func(spaceID uint, open bool, offset time.Duration) {
-		if err := repo.CreateStatus(ctx, SedeStatus{SpaceID: spaceID, IsOpen: open, Timestamp: base.Add(offset)}); err != nil {
+		if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: spaceID, IsOpen: open, Timestamp: base.Add(offset)}); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -234,6 +495,33 @@ func TestGetLatestStatus_EmptySpace(t *testing.T) {
 	}
 }
 
+func TestRecentStatuses_AcrossSpacesNewestFirst(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	a := seedSpace(t, repo, "spaceA")
+	b := seedSpace(t, repo, "spaceB")
+	base := time.Now().UTC()
+	for i, s := range []SedeStatus{
+		{SpaceID: a, IsOpen: true, Timestamp: base.Add(-3 * time.Hour)},
+		{SpaceID: b, IsOpen: true, Timestamp: base.Add(-1 * time.Hour)},
+		{SpaceID: a, IsOpen: false, Timestamp: base.Add(-2 * time.Hour)},
+	} {
+		if err := repo.CreateStatus(ctx, &s); err != nil {
+			t.Fatalf("status %d: %v", i, err)
+		}
+	}
+
+	recent, err := repo.RecentStatuses(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].SpaceID != b || recent[1].SpaceID != a || recent[1].IsOpen {
+		t.Errorf("recent: %+v", recent)
+	}
+}
+
 func TestGetWeeklyStats_ScopedPerSpace(t *testing.T) {
 	repo, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -249,12 +537,12 @@ func TestGetWeeklyStats_ScopedPerSpace(t *testing.T) {
 		{SpaceID: a, IsOpen: true, Timestamp: monday10},
 		{SpaceID: a, IsOpen: false, Timestamp: monday10.Add(4 * time.Hour)},
 	} {
-		if err := repo.CreateStatus(ctx, s); err != nil {
+		if err := repo.CreateStatus(ctx, &s); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	statsA, err := repo.GetWeeklyStats(ctx, a)
+	statsA, err := repo.GetWeeklyStats(ctx, a, DefaultStatsWindow(time.UTC))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -262,7 +550,7 @@ func TestGetWeeklyStats_ScopedPerSpace(t *testing.T) {
 		t.Error("expected non-empty stats for spaceA")
 	}
 
-	statsB, err := repo.GetWeeklyStats(ctx, b)
+	statsB, err := repo.GetWeeklyStats(ctx, b, DefaultStatsWindow(time.UTC))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -271,6 +559,146 @@ func TestGetWeeklyStats_ScopedPerSpace(t *testing.T) {
 	}
 }
 
+// hourOf returns the probability reported for day/hour, and whether the slot
+// is present at all.
+func hourOf(stats []WeeklyStatsDetailed, day, hour string) (float64, bool) {
+	for _, d := range stats {
+		if d.Day != day {
+			continue
+		}
+		for _, h := range d.Hourly {
+			if h.Hour == hour {
+				return h.Probability, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestGetWeeklyStats_LocalTimeAcrossDST(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		// Every event below happens at 10:30 Rome time, on either side of
+		// a DST change, so both must land in the "10" slot.
+		events []time.Time
+		end    time.Time
+		want   [][2]string
+	}{
+		{
+			// 31 March 2024: 02:00 CET -> 03:00 CEST.
+			name: "spring forward",
+			events: []time.Time{
+				time.Date(2024, 3, 30, 9, 30, 0, 0, time.UTC), // Saturday, UTC+1
+				time.Date(2024, 3, 31, 8, 30, 0, 0, time.UTC), // Sunday, UTC+2
+			},
+			end:  time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC),
+			want: [][2]string{{"Saturday", "10"}, {"Sunday", "10"}},
+		},
+		{
+			// 27 October 2024: 03:00 CEST -> 02:00 CET.
+			name: "fall back",
+			events: []time.Time{
+				time.Date(2024, 10, 26, 8, 30, 0, 0, time.UTC), // Saturday, UTC+2
+				time.Date(2024, 10, 27, 9, 30, 0, 0, time.UTC), // Sunday, UTC+1
+			},
+			end:  time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC),
+			want: [][2]string{{"Saturday", "10"}, {"Sunday", "10"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			repo, cleanup := setupTestDB(t)
+			defer cleanup()
+			ctx := context.Background()
+			sp := seedSpace(t, repo, "pescara")
+			for _, ts := range c.events {
+				if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: sp, IsOpen: true, Timestamp: ts}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := DefaultStatsWindow(rome)
+			w.End = c.end
+			stats, err := repo.GetWeeklyStats(ctx, sp, w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, slot := range c.want {
+				if p, ok := hourOf(stats, slot[0], slot[1]); !ok || p != 1 {
+					t.Errorf("%s %s:00: got %v (present %v), stats %+v", slot[0], slot[1], p, ok, stats)
+				}
+			}
+		})
+	}
+}
+
+func TestGetWeeklyStats_LocalWeekdayAndHourWindow(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := seedSpace(t, repo, "pescara")
+
+	// Sunday 22:30 UTC is already Monday 00:30 in Rome (CEST); the space
+	// stays open for an hour.
+	opened := time.Date(2024, 6, 2, 22, 30, 0, 0, time.UTC)
+	for _, s := range []SedeStatus{
+		{SpaceID: sp, IsOpen: true, Timestamp: opened},
+		{SpaceID: sp, IsOpen: false, Timestamp: opened.Add(time.Hour)},
+	} {
+		if err := repo.CreateStatus(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	end := time.Date(2024, 6, 3, 22, 0, 0, 0, time.UTC) // Tuesday 00:00 in Rome
+
+	w := DefaultStatsWindow(rome)
+	w.End = end
+	stats, err := repo.GetWeeklyStats(ctx, sp, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Day != "Monday" {
+		t.Fatalf("want Monday only, got %+v", stats)
+	}
+	if h := stats[0].Hourly; len(h) != 13 || h[0].Hour != "09" || h[12].Hour != "21" {
+		t.Errorf("default window should report 09-21, got %+v", h)
+	}
+
+	w = StatsWindow{Location: rome, FromHour: 0, ToHour: 23, End: end}
+	stats, err = repo.GetWeeklyStats(ctx, sp, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := hourOf(stats, "Monday", "00"); !ok || p != 1 {
+		t.Errorf("Monday 00:00 should be fully open, got %v: %+v", p, stats)
+	}
+	if p, _ := hourOf(stats, "Monday", "01"); p != 0.5 {
+		t.Errorf("Monday 01:00 should be half open, got %v", p)
+	}
+
+	// The same rows are outside the 90 days before a much later end, and
+	// the space was closed all along.
+	w.End = end.AddDate(1, 0, 0)
+	stats, err = repo.GetWeeklyStats(ctx, sp, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range stats {
+		if d.DailyProbability != 0 {
+			t.Errorf("%s: want 0, got %v", d.Day, d.DailyProbability)
+		}
+	}
+}
+
 func TestGetStatistics_ScopedPerSpace(t *testing.T) {
 	repo, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -286,7 +714,7 @@ func TestGetStatistics_ScopedPerSpace(t *testing.T) {
 		{SpaceID: a, IsOpen: true, Timestamp: now.Add(-1 * time.Hour)},
 		{SpaceID: b, IsOpen: true, Timestamp: now.Add(-1 * time.Hour)},
 	} {
-		if err := repo.CreateStatus(ctx, s); err != nil {
+		if err := repo.CreateStatus(ctx, &s); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -308,50 +736,36 @@ func TestGetStatistics_ScopedPerSpace(t *testing.T) {
 	}
 }
 
-func TestBackfillDefaultSpaceID(t *testing.T) {
+func TestGetStatistics_BucketsByUTCDay(t *testing.T) {
 	repo, cleanup := setupTestDB(t)
 	defer cleanup()
 	ctx := context.Background()
 
-	defaultID := seedSpace(t, repo, "default")
-
-	// Simulate a legacy DB: rows inserted with SpaceID=0 (the migration
-	// default), predating the multi-space refactor.
-	now := time.Now().UTC()
-	for _, ts := range []time.Duration{-3 * time.Hour, -2 * time.Hour, -1 * time.Hour} {
-		if err := repo.Db.Create(&SedeStatus{SpaceID: 0, IsOpen: true, Timestamp: now.Add(ts)}).Error; err != nil {
+	sp := seedSpace(t, repo, "pescara")
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for _, ts := range []time.Time{
+		today.AddDate(0, 0, -analysisDays-1), // outside the window
+		today.AddDate(0, 0, -2).Add(10 * time.Hour),
+		today.AddDate(0, 0, -2).Add(23 * time.Hour),
+		today.Add(time.Minute),
+	} {
+		if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: sp, IsOpen: true, Timestamp: ts}); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	updated, err := repo.BackfillDefaultSpaceID(ctx, defaultID)
+	daily, total, err := repo.GetStatistics(ctx, sp)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if updated != 3 {
-		t.Errorf("expected 3 rows backfilled, got %d", updated)
+	if total != 4 || len(daily) != 2 {
+		t.Fatalf("total %d, daily %+v", total, daily)
 	}
-
-	var remaining int64
-	repo.Db.Model(&SedeStatus{}).Where("space_id = 0").Count(&remaining)
-	if remaining != 0 {
-		t.Errorf("expected 0 orphan rows, got %d", remaining)
+	if daily[0].Date != today.AddDate(0, 0, -2).Format(statsDateLayout) || daily[0].Probability != 2.0/analysisDays {
+		t.Errorf("first day: %+v", daily[0])
 	}
-
-	var migrated int64
-	repo.Db.Model(&SedeStatus{}).Where("space_id = ?", defaultID).Count(&migrated)
-	if migrated != 3 {
-		t.Errorf("expected 3 rows on default space, got %d", migrated)
-	}
-}
-
-func TestBackfillDefaultSpaceID_RefusesZero(t *testing.T) {
-	repo, cleanup := setupTestDB(t)
-	defer cleanup()
-
-	_, err := repo.BackfillDefaultSpaceID(context.Background(), 0)
-	if err == nil {
-		t.Fatal("expected refusal to backfill into space_id=0")
+	if daily[1].Date != today.Format(statsDateLayout) {
+		t.Errorf("second day: %+v", daily[1])
 	}
 }
 
@@ -390,3 +804,40 @@ func TestDailyStats(t *testing.T) {
 		}
 	})
 }
+
+func TestGormLogger_CarriesRequestID(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(prev)
+
+	ctx := logging.WithRequestID(context.Background(), "req-42")
+	if _, err := repo.GetLatestStatus(ctx, 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("want not found, got %v", err)
+	}
+	if err := repo.Db.WithContext(ctx).Exec("SELECT * FROM no_such_table").Error; err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var levels []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		if rec["request_id"] != "req-42" {
+			t.Errorf("record without request id: %s", line)
+		}
+		levels = append(levels, rec["level"].(string))
+	}
+	if len(levels) != 2 || levels[0] != "DEBUG" || levels[1] != "ERROR" {
+		t.Errorf("levels: %v (not found is not an error)", levels)
+	}
+}
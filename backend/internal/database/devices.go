@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Actions a device can be allowed. Sending heartbeats needs none.
+const (
+	DeviceActionToggle  = "toggle"
+	DeviceActionSensors = "sensors"
+)
+
+// DeviceActions lists every action a device can be allowed, in the order
+// they are stored.
+var DeviceActions = []string{DeviceActionToggle, DeviceActionSensors}
+
+// Device is a client of one space with its own API key: an ESP32 button,
+// a kiosk, a bot. The key is high-entropy and generated by us, so it is
+// stored as a plain SHA-256 (unique, looked up directly) rather than the
+// bcrypt used for the space key. Actions is the comma-separated list of
+// DeviceActions it may perform.
+//
+// A device is monitored once it sends its first heartbeat: LastHeartbeatAt
+// is the latest one, and Offline is set when they stopped and the alert
+// went out, so the alert isn't repeated.
+type Device struct {
+	ID              uint   `gorm:"primarykey"`
+	SpaceID         uint   `gorm:"not null;index"`
+	Name            string `gorm:"not null"`
+	KeyHash         string `gorm:"not null;uniqueIndex"`
+	Actions         string `gorm:"not null;default:''"`
+	Active          bool   `gorm:"not null;default:true"`
+	LastHeartbeatAt *time.Time
+	Offline         bool `gorm:"not null;default:false"`
+	CreatedAt       time.Time
+}
+
+// Allows reports whether d may perform action.
+func (d *Device) Allows(action string) bool {
+	return action != "" && slices.Contains(strings.Split(d.Actions, ","), action)
+}
+
+// NormalizeDeviceActions validates actions and returns them deduplicated,
+// in DeviceActions order, ready for Device.Actions.
+func NormalizeDeviceActions(actions []string) (string, error) {
+	for _, a := range actions {
+		if !slices.Contains(DeviceActions, a) {
+			return "", fmt.Errorf("unknown device action %q (want %s)", a, strings.Join(DeviceActions, ", "))
+		}
+	}
+	var out []string
+	for _, a := range DeviceActions {
+		if slices.Contains(actions, a) {
+			out = append(out, a)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// NewDeviceKey generates a random device key; only its DeviceKeyHash is
+// stored, so the key must be handed to the device right away.
+func NewDeviceKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DeviceKeyHash is the KeyHash stored for a device key.
+func DeviceKeyHash(key string) string {
+	return sha256Hex(key)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDevice adds d, which must carry its KeyHash.
+func (r *Repository) CreateDevice(ctx context.Context, d *Device) error {
+	d.Active = true
+	return r.Db.WithContext(ctx).Create(d).Error
+}
+
+// AuthenticateDevice returns the active device of spaceID whose key is key,
+// or gorm.ErrRecordNotFound.
+func (r *Repository) AuthenticateDevice(ctx context.Context, spaceID uint, key string) (*Device, error) {
+	var d Device
+	err := r.Db.WithContext(ctx).
+		Where("key_hash = ? AND space_id = ? AND active = ?", DeviceKeyHash(key), spaceID, true).
+		First(&d).Error
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDevices returns every device, revoked ones included, by space and
+// creation order.
+func (r *Repository) ListDevices(ctx context.Context) ([]Device, error) {
+	var devices []Device
+	err := r.Db.WithContext(ctx).Order("space_id asc, id asc").Find(&devices).Error
+	return devices, err
+}
+
+// RevokeDevice deactivates one device; the space key and other devices
+// keep working.
+func (r *Repository) RevokeDevice(ctx context.Context, id uint) error {
+	res := r.Db.WithContext(ctx).Model(&Device{}).Where("id = ?", id).Update("active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RecordHeartbeat stores a heartbeat of device id at at and reports
+// whether the device had been marked offline.
+func (r *Repository) RecordHeartbeat(ctx context.Context, id uint, at time.Time) (bool, error) {
+	var wasOffline bool
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Device{}).Where("id = ? AND offline = ?", id, true).Update("offline", false)
+		if res.Error != nil {
+			return res.Error
+		}
+		wasOffline = res.RowsAffected > 0
+		return tx.Model(&Device{}).Where("id = ?", id).Update("last_heartbeat_at", at).Error
+	})
+	return wasOffline, err
+}
+
+// MarkDevicesOffline flags the active devices whose last heartbeat is
+// older than before and returns them. A device is returned once per
+// outage, even with several instances sharing the database.
+func (r *Repository) MarkDevicesOffline(ctx context.Context, before time.Time) ([]Device, error) {
+	db := r.Db.WithContext(ctx)
+	var stale []Device
+	if err := db.Where("active = ? AND offline = ? AND last_heartbeat_at < ?", true, false, before).
+		Order("id asc").
+		Find(&stale).Error; err != nil {
+		return nil, err
+	}
+	var marked []Device
+	for _, d := range stale {
+		// Re-check the heartbeat: one may have landed since the query.
+		res := db.Model(&Device{}).
+			Where("id = ? AND offline = ? AND last_heartbeat_at < ?", d.ID, false, before).
+			Update("offline", true)
+		if res.Error != nil {
+			return marked, res.Error
+		}
+		if res.RowsAffected > 0 {
+			d.Offline = true
+			marked = append(marked, d)
+		}
+	}
+	return marked, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestAuthenticateDevice_ScopedAndRevocable(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	a := seedSpace(t, repo, "spaceA")
+	b := seedSpace(t, repo, "spaceB")
+	button := Device{SpaceID: a, Name: "button", KeyHash: DeviceKeyHash("key-button"), Actions: "toggle"}
+	kiosk := Device{SpaceID: a, Name: "kiosk", KeyHash: DeviceKeyHash("key-kiosk"), Actions: "sensors"}
+	for _, d := range []*Device{&button, &kiosk} {
+		if err := repo.CreateDevice(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := repo.AuthenticateDevice(ctx, a, "key-button")
+	if err != nil || d.ID != button.ID || !d.Allows(DeviceActionToggle) || d.Allows(DeviceActionSensors) {
+		t.Fatalf("button: %+v, %v", d, err)
+	}
+	if _, err := repo.AuthenticateDevice(ctx, b, "key-button"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("key accepted for another space: %v", err)
+	}
+
+	if err := repo.RevokeDevice(ctx, button.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AuthenticateDevice(ctx, a, "key-button"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoked key accepted: %v", err)
+	}
+	if _, err := repo.AuthenticateDevice(ctx, a, "key-kiosk"); err != nil {
+		t.Errorf("revoking one device broke another: %v", err)
+	}
+	if err := repo.RevokeDevice(ctx, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoke unknown: %v", err)
+	}
+}
+
+func TestNormalizeDeviceActions(t *testing.T) {
+	got, err := NormalizeDeviceActions([]string{"sensors", "toggle", "sensors"})
+	if err != nil || got != "toggle,sensors" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := NormalizeDeviceActions([]string{"admin"}); err == nil {
+		t.Error("expected unknown action error")
+	}
+}
+
+func TestMarkDevicesOffline_OncePerOutage(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sp := seedSpace(t, repo, "spaceA")
+	silent := Device{SpaceID: sp, Name: "never-seen", KeyHash: DeviceKeyHash("k1")}
+	button := Device{SpaceID: sp, Name: "button", KeyHash: DeviceKeyHash("k2")}
+	for _, d := range []*Device{&silent, &button} {
+		if err := repo.CreateDevice(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	if _, err := repo.RecordHeartbeat(ctx, button.ID, now.Add(-10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	marked, err := repo.MarkDevicesOffline(ctx, now.Add(-5*time.Minute))
+	if err != nil || len(marked) != 1 || marked[0].ID != button.ID {
+		t.Fatalf("marked %+v, %v", marked, err)
+	}
+	if again, _ := repo.MarkDevicesOffline(ctx, now.Add(-5*time.Minute)); len(again) != 0 {
+		t.Errorf("alerted twice: %+v", again)
+	}
+
+	wasOffline, err := repo.RecordHeartbeat(ctx, button.ID, now)
+	if err != nil || !wasOffline {
+		t.Errorf("heartbeat after outage: %v, %v", wasOffline, err)
+	}
+	if wasOffline, _ := repo.RecordHeartbeat(ctx, button.ID, now); wasOffline {
+		t.Error("second heartbeat reported an outage")
+	}
+}
+
+func TestMarkDevicesOffline_HeartbeatDuringSweep(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sp := seedSpace(t, repo, "spaceA")
+	button := Device{SpaceID: sp, Name: "button", KeyHash: DeviceKeyHash("k")}
+	if err := repo.CreateDevice(ctx, &button); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if _, err := repo.RecordHeartbeat(ctx, button.ID, now.Add(-10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The heartbeat arrives after the sweep found the device stale but
+	// before it flags it.
+	var once sync.Once
+	err := repo.Db.Callback().Query().After("gorm:query").Register("test:heartbeat", func(db *gorm.DB) {
+		if db.Statement.Table == "devices" {
+			once.Do(func() {
+				if _, err := repo.RecordHeartbeat(ctx, button.ID, now); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marked, err := repo.MarkDevicesOffline(ctx, now.Add(-5*time.Minute))
+	if err != nil || len(marked) != 0 {
+		t.Errorf("live device marked offline: %+v, %v", marked, err)
+	}
+	var d Device
+	repo.Db.First(&d, button.ID)
+	if d.Offline {
+		t.Error("device flagged offline after its heartbeat")
+	}
+}
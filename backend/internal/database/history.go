@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const importBatchSize = 500
+
+// EachStatus calls fn with every status row of spaceID, oldest first,
+// without loading the whole history in memory. It stops at the first
+// error fn returns.
+func (r *Repository) EachStatus(ctx context.Context, spaceID uint, fn func(SedeStatus) error) error {
+	db := r.Db.WithContext(ctx)
+	rows, err := db.Model(&SedeStatus{}).
+		Where("space_id = ?", spaceID).
+		Order("timestamp asc, id asc").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s SedeStatus
+		if err := db.ScanRows(rows, &s); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportStatuses inserts statuses under spaceID in one transaction and
+// returns how many were inserted. A status whose timestamp already exists
+// for the space, in the database or earlier in statuses, is skipped, so
+// importing the same file twice is harmless.
+func (r *Repository) ImportStatuses(ctx context.Context, spaceID uint, statuses []SedeStatus) (int, error) {
+	if len(statuses) == 0 {
+		return 0, nil
+	}
+	from, to := statuses[0].Timestamp, statuses[0].Timestamp
+	for _, s := range statuses {
+		if s.Timestamp.Before(from) {
+			from = s.Timestamp
+		}
+		if s.Timestamp.After(to) {
+			to = s.Timestamp
+		}
+	}
+
+	var inserted int
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Compared as instants in Go, over a window padded by a day: on
+		// SQLite the stored text form of a timestamp depends on the zone it
+		// was written in, so the SQL range is only approximate.
+		var existing []time.Time
+		if err := tx.Model(&SedeStatus{}).
+			Where("space_id = ? AND timestamp >= ? AND timestamp <= ?", spaceID, from.UTC().Add(-24*time.Hour), to.UTC().Add(24*time.Hour)).
+			Pluck("timestamp", &existing).Error; err != nil {
+			return err
+		}
+		seen := make(map[int64]bool, len(existing)+len(statuses))
+		for _, ts := range existing {
+			seen[ts.UnixNano()] = true
+		}
+
+		var batch []SedeStatus
+		for _, s := range statuses {
+			if seen[s.Timestamp.UnixNano()] {
+				continue
+			}
+			seen[s.Timestamp.UnixNano()] = true
+			batch = append(batch, SedeStatus{
+				SpaceID:   spaceID,
+				IsOpen:    s.IsOpen,
+				Reason:    s.Reason,
+				ActorName: s.ActorName,
+				Source:    s.Source,
+				ClientIP:  s.ClientIP,
+				CardHash:  s.CardHash,
+				Timestamp: s.Timestamp.UTC(),
+			})
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(batch, importBatchSize).Error; err != nil {
+			return err
+		}
+		inserted = len(batch)
+		return nil
+	})
+	return inserted, err
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEachStatus(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	pescara := seedSpace(t, repo, "pescara")
+	aquila := seedSpace(t, repo, "aquila")
+
+	base := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Duration{2 * time.Hour, 0, time.Hour} {
+		repo.CreateStatus(ctx, &SedeStatus{SpaceID: pescara, IsOpen: i%2 == 0, Timestamp: base.Add(ts)})
+	}
+	repo.CreateStatus(ctx, &SedeStatus{SpaceID: aquila, IsOpen: true, Timestamp: base})
+
+	var got []time.Time
+	err := repo.EachStatus(ctx, pescara, func(s SedeStatus) error {
+		got = append(got, s.Timestamp)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || !got[0].Equal(base) || !got[2].Equal(base.Add(2*time.Hour)) {
+		t.Errorf("got %v, want 3 rows oldest first", got)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.EachStatus(ctx, pescara, func(SedeStatus) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func TestImportStatuses_Dedupes(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	id := seedSpace(t, repo, "pescara")
+
+	base := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	repo.CreateStatus(ctx, &SedeStatus{SpaceID: id, IsOpen: true, Timestamp: base})
+
+	rome, _ := time.LoadLocation("Europe/Rome")
+	in := []SedeStatus{
+		{IsOpen: true, Timestamp: base.In(rome)}, // already stored, other zone
+		{IsOpen: false, Reason: "gelatino", ActorName: "Alice", CardHash: "9f86d081", Source: SourceButton, ClientIP: "10.0.0.7", Timestamp: base.Add(time.Hour)},
+		{IsOpen: false, Timestamp: base.Add(time.Hour)}, // duplicate within the import
+		{IsOpen: true, Timestamp: base.Add(2 * time.Hour)},
+	}
+	n, err := repo.ImportStatuses(ctx, id, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("inserted %d, want 2", n)
+	}
+
+	again, err := repo.ImportStatuses(ctx, id, in)
+	if err != nil || again != 0 {
+		t.Errorf("second import inserted %d, err %v", again, err)
+	}
+
+	var total int64
+	repo.Db.Model(&SedeStatus{}).Where("space_id = ?", id).Count(&total)
+	if total != 3 {
+		t.Errorf("total rows = %d, want 3", total)
+	}
+	var closed SedeStatus
+	repo.Db.Where("space_id = ? AND is_open = ?", id, false).First(&closed)
+	if closed.Reason != "gelatino" || closed.ActorName != "Alice" ||
+		closed.CardHash != "9f86d081" || closed.Source != SourceButton || closed.ClientIP != "10.0.0.7" {
+		t.Errorf("imported row = %+v", closed)
+	}
+}
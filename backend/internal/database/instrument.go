@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const queryStartKey = "sede:query_start"
+
+// ObserveQueries reports the duration of every statement run through GORM,
+// tagged with its operation (create, query, update, delete, row or raw).
+func (r *Repository) ObserveQueries(observe func(op string, d time.Duration)) error {
+	before := func(db *gorm.DB) {
+		db.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(op string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			if v, ok := db.InstanceGet(queryStartKey); ok {
+				observe(op, time.Since(v.(time.Time)))
+			}
+		}
+	}
+
+	cb := r.Db.Callback()
+	for _, p := range []struct {
+		op     string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := p.before("sede:before_"+p.op, before); err != nil {
+			return fmt.Errorf("register %s timer: %w", p.op, err)
+		}
+		if err := p.after("sede:after_"+p.op, after(p.op)); err != nil {
+			return fmt.Errorf("register %s timer: %w", p.op, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObserveQueries(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+	if err := repo.ObserveQueries(func(op string, d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if d < 0 {
+			t.Errorf("%s: negative duration %v", op, d)
+		}
+		seen[op]++
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sp := seedSpace(t, repo, "pescara")
+	if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: sp, IsOpen: true, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLatestStatus(ctx, sp); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.GetStatistics(ctx, sp); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, op := range []string{"create", "query"} {
+		if seen[op] == 0 {
+			t.Errorf("no %s observed: %v", op, seen)
+		}
+	}
+}
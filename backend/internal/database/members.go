@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/cards"
+	"gorm.io/gorm"
+)
+
+// ErrCardNotAuthorized is returned by AuthorizeCard for a card that is
+// unknown, revoked, presented with the wrong hash, held by an inactive
+// member or not allowed in the space. The cases are not told apart, so the
+// answer doesn't reveal which cards exist.
+var ErrCardNotAuthorized = errors.New("card not authorized")
+
+// Member is a person who opens spaces with their RFID cards, for teams that
+// keep their member list on this instance rather than in the manager.
+// Deactivating a member revokes all their cards at once.
+type Member struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"not null"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Cards     []Card
+}
+
+// Card is an RFID card of a member. UID is stored normalised
+// (cards.NormalizeID) and is unique. The hash the reader derives from the
+// card is kept only as its SHA-256, so a copy of the database is not
+// enough to forge a card. A card without Spaces opens every space;
+// otherwise only the listed ones.
+type Card struct {
+	ID         uint   `gorm:"primarykey"`
+	MemberID   uint   `gorm:"not null;index"`
+	UID        string `gorm:"not null;uniqueIndex"`
+	HashSHA256 string `gorm:"not null"`
+	Active     bool   `gorm:"not null;default:true"`
+	CreatedAt  time.Time
+	Spaces     []CardSpace
+}
+
+// CardSpace scopes a card to one space.
+type CardSpace struct {
+	CardID  uint `gorm:"primaryKey;autoIncrement:false"`
+	SpaceID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+// NewCard describes a card to register. SpaceIDs empty means every space.
+type NewCard struct {
+	UID      string
+	Hash     string
+	SpaceIDs []uint
+}
+
+// CreateMember adds an active member holding card.
+func (r *Repository) CreateMember(ctx context.Context, name string, card NewCard) (*Member, error) {
+	m := Member{Name: name, Active: true}
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&m).Error; err != nil {
+			return err
+		}
+		c, err := addCard(tx, m.ID, card)
+		if err != nil {
+			return err
+		}
+		m.Cards = []Card{*c}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// AddCard registers another card for memberID. A revoked card can be
+// registered again, to the same or another member; an active one fails
+// with gorm.ErrDuplicatedKey.
+func (r *Repository) AddCard(ctx context.Context, memberID uint, card NewCard) (*Card, error) {
+	var c *Card
+	err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&Member{}, memberID).Error; err != nil {
+			return err
+		}
+		var err error
+		c, err = addCard(tx, memberID, card)
+		return err
+	})
+	return c, err
+}
+
+func addCard(tx *gorm.DB, memberID uint, card NewCard) (*Card, error) {
+	uid := cards.NormalizeID(card.UID)
+	var old Card
+	err := tx.Where("uid = ?", uid).First(&old).Error
+	switch {
+	case err == nil && old.Active:
+		return nil, gorm.ErrDuplicatedKey
+	case err == nil:
+		if err := tx.Where("card_id = ?", old.ID).Delete(&CardSpace{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(&old).Error; err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	c := Card{MemberID: memberID, UID: uid, HashSHA256: cardHashDigest(card.Hash), Active: true}
+	if err := tx.Create(&c).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range card.SpaceIDs {
+		c.Spaces = append(c.Spaces, CardSpace{CardID: c.ID, SpaceID: id})
+	}
+	if len(c.Spaces) > 0 {
+		if err := tx.Create(&c.Spaces).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// ListMembers returns every member with their cards and card scopes,
+// revoked ones included, in creation order.
+func (r *Repository) ListMembers(ctx context.Context) ([]Member, error) {
+	var members []Member
+	err := r.Db.WithContext(ctx).
+		Preload("Cards", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).
+		Preload("Cards.Spaces").
+		Order("id asc").
+		Find(&members).Error
+	return members, err
+}
+
+// RevokeMember deactivates the member and, with it, all their cards.
+func (r *Repository) RevokeMember(ctx context.Context, id uint) error {
+	res := r.Db.WithContext(ctx).Model(&Member{}).Where("id = ?", id).Update("active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeCard deactivates one card, leaving the member's others working.
+func (r *Repository) RevokeCard(ctx context.Context, uid string) error {
+	res := r.Db.WithContext(ctx).Model(&Card{}).Where("uid = ?", cards.NormalizeID(uid)).Update("active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AuthorizeCard returns the member holding the card if it may open
+// spaceID, and ErrCardNotAuthorized otherwise.
+func (r *Repository) AuthorizeCard(ctx context.Context, spaceID uint, uid, hash string) (*Member, error) {
+	db := r.Db.WithContext(ctx)
+	var c Card
+	err := db.Preload("Spaces").Where("uid = ?", cards.NormalizeID(uid)).First(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCardNotAuthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.Active || subtle.ConstantTimeCompare([]byte(c.HashSHA256), []byte(cardHashDigest(hash))) != 1 {
+		return nil, ErrCardNotAuthorized
+	}
+	if len(c.Spaces) > 0 {
+		allowed := false
+		for _, s := range c.Spaces {
+			allowed = allowed || s.SpaceID == spaceID
+		}
+		if !allowed {
+			return nil, ErrCardNotAuthorized
+		}
+	}
+
+	var m Member
+	if err := db.First(&m, c.MemberID).Error; err != nil {
+		return nil, err
+	}
+	if !m.Active {
+		return nil, ErrCardNotAuthorized
+	}
+	return &m, nil
+}
+
+func cardHashDigest(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:])
+}
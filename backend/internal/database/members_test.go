@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestAuthorizeCard(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	a := seedSpace(t, repo, "spaceA")
+	b := seedSpace(t, repo, "spaceB")
+
+	mario, err := repo.CreateMember(ctx, "Mario Rossi", NewCard{UID: "04-A2-1B-7C", Hash: "h1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mario.Cards[0].UID != "04a21b7c" || mario.Cards[0].HashSHA256 == "h1" {
+		t.Errorf("card not normalised or hash stored in clear: %+v", mario.Cards[0])
+	}
+	anna, err := repo.CreateMember(ctx, "Anna", NewCard{UID: "aa:bb", Hash: "h2", SpaceIDs: []uint{b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name           string
+		space          uint
+		uid, hash      string
+		want           string
+		wantAuthorized bool
+	}{
+		{"unscoped card, any space", a, "04A21B7C", "h1", "Mario Rossi", true},
+		{"unscoped card, other space", b, "04:a2:1b:7c", "h1", "Mario Rossi", true},
+		{"wrong hash", a, "04a21b7c", "h2", "", false},
+		{"unknown card", a, "ffff", "h1", "", false},
+		{"scoped card, its space", b, "AA-BB", "h2", "Anna", true},
+		{"scoped card, other space", a, "aabb", "h2", "", false},
+	} {
+		m, err := repo.AuthorizeCard(ctx, tc.space, tc.uid, tc.hash)
+		if !tc.wantAuthorized {
+			if !errors.Is(err, ErrCardNotAuthorized) {
+				t.Errorf("%s: want ErrCardNotAuthorized, got %v, %v", tc.name, m, err)
+			}
+			continue
+		}
+		if err != nil || m.Name != tc.want {
+			t.Errorf("%s: got %v, %v", tc.name, m, err)
+		}
+	}
+
+	// A second card survives the revocation of the first; revoking the
+	// member stops both.
+	if _, err := repo.AddCard(ctx, anna.ID, NewCard{UID: "cc", Hash: "h3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RevokeCard(ctx, "AA-BB"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AuthorizeCard(ctx, b, "aabb", "h2"); !errors.Is(err, ErrCardNotAuthorized) {
+		t.Errorf("revoked card still authorized: %v", err)
+	}
+	if m, err := repo.AuthorizeCard(ctx, a, "cc", "h3"); err != nil || m.ID != anna.ID {
+		t.Errorf("other card of the member: %v, %v", m, err)
+	}
+	if err := repo.RevokeMember(ctx, anna.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AuthorizeCard(ctx, a, "cc", "h3"); !errors.Is(err, ErrCardNotAuthorized) {
+		t.Errorf("card of a revoked member still authorized: %v", err)
+	}
+	if err := repo.RevokeMember(ctx, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoke unknown member: %v", err)
+	}
+	if err := repo.RevokeCard(ctx, "ffff"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoke unknown card: %v", err)
+	}
+}
+
+func TestAddCard_ReusesOnlyRevokedUIDs(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	a := seedSpace(t, repo, "spaceA")
+
+	mario, err := repo.CreateMember(ctx, "Mario", NewCard{UID: "0102", Hash: "h1", SpaceIDs: []uint{a}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	luigi, err := repo.CreateMember(ctx, "Luigi", NewCard{UID: "0304", Hash: "h2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AddCard(ctx, luigi.ID, NewCard{UID: "01-02", Hash: "h3"}); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("active card reassigned: %v", err)
+	}
+	if _, err := repo.AddCard(ctx, 999, NewCard{UID: "0506", Hash: "h3"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("card added to unknown member: %v", err)
+	}
+
+	if err := repo.RevokeCard(ctx, "0102"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AddCard(ctx, luigi.ID, NewCard{UID: "01-02", Hash: "h3"}); err != nil {
+		t.Fatalf("revoked card not reassigned: %v", err)
+	}
+
+	members, err := repo.ListMembers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].ID != mario.ID || len(members[0].Cards) != 0 {
+		t.Fatalf("mario should have lost the card: %+v", members)
+	}
+	if got := members[1].Cards; len(got) != 2 || got[1].UID != "0102" || len(got[1].Spaces) != 0 {
+		t.Errorf("luigi cards: %+v", got)
+	}
+	if m, err := repo.AuthorizeCard(ctx, a, "0102", "h3"); err != nil || m.ID != luigi.ID {
+		t.Errorf("reassigned card: %v, %v", m, err)
+	}
+}
@@ -0,0 +1,689 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is one versioned schema step. Up steps only create what is
+// missing, so databases built by the AutoMigrate of earlier releases (which
+// already have some or all of the schema but no schema_migrations table)
+// upgrade to the same result as fresh ones. Each step declares its own
+// snapshot of the tables it touches instead of using the live models, so
+// later model changes cannot alter what an old step does.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB, opts MigrateOptions) error
+	down    func(tx *gorm.DB) error
+}
+
+// MigrateOptions carries the settings data migrations depend on.
+type MigrateOptions struct {
+	// DefaultSpaceSlug is the space that status rows recorded before
+	// multi-space support are assigned to.
+	DefaultSpaceSlug string
+}
+
+// MigrationState is a known migration and, if applied, when.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of schema_migrations.
+type schemaMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// migrationLockKey serialises migrations across replicas on PostgreSQL.
+const migrationLockKey = 0x5ede
+
+var migrations = []migration{
+	{1, "single_space_statuses", migrateSingleSpaceStatuses, dropTables("sede_statuses")},
+	{2, "multi_space", migrateMultiSpace, revertMultiSpace},
+	{3, "assign_legacy_statuses", migrateAssignLegacyStatuses, nil},
+	{4, "status_actor_and_webhooks", migrateStatusActorAndWebhooks, revertStatusActorAndWebhooks},
+	{5, "space_notifiers", addColumns(&spaceNotifiersV5{}, "Notifiers"), dropColumns(&spaceNotifiersV5{}, "Notifiers")},
+	{6, "spaceapi_sections", addColumns(&spaceAPISectionsV6{}, spaceAPISectionsV6Fields...), dropColumns(&spaceAPISectionsV6{}, spaceAPISectionsV6Fields...)},
+	{7, "sensor_readings", createTables(&sensorReadingV7{}), dropTables("sensor_readings")},
+	{8, "space_schedules", addColumns(&spaceSchedulesV8{}, spaceSchedulesV8Fields...), dropColumns(&spaceSchedulesV8{}, spaceSchedulesV8Fields...)},
+	{9, "space_card_resolver", addColumns(&spaceCardResolverV9{}, "CardResolver"), dropColumns(&spaceCardResolverV9{}, "CardResolver")},
+	{10, "members_and_cards", createTables(&memberV10{}, &cardV10{}, &cardSpaceV10{}), dropTables("card_spaces", "cards", "members")},
+	{11, "require_card_and_access_log", migrateRequireCard, revertRequireCard},
+	{12, "status_attribution", migrateStatusAttribution, revertStatusAttribution},
+	{13, "devices", createTables(&deviceV13{}), dropTables("devices")},
+	{14, "api_tokens", createTables(&apiTokenV14{}), dropTables("api_tokens")},
+	{15, "space_file_state", addColumns(&spaceFileStateV15{}, "FileState"), dropColumns(&spaceFileStateV15{}, "FileState")},
+	{16, "access_log_card_hash", migrateAccessCardHash, revertAccessCardHash},
+	{17, "latest_sensor_readings", migrateLatestSensorReadings, dropTables("latest_sensor_readings")},
+}
+
+// LatestSchemaVersion is the version New migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationStatus lists every known migration with its applied time.
+func (r *Repository) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		out[i] = MigrationState{Version: m.version, Name: m.name}
+		if row, ok := applied[m.version]; ok {
+			at := row.AppliedAt
+			out[i].AppliedAt = &at
+		}
+	}
+	return out, nil
+}
+
+// MigrateUp applies, in order, every pending migration up to and including
+// target (0 means the latest) and returns the versions it applied. Each
+// migration runs in its own transaction together with its
+// schema_migrations row.
+func (r *Repository) MigrateUp(ctx context.Context, opts MigrateOptions, target int) ([]int, error) {
+	if target == 0 {
+		target = LatestSchemaVersion()
+	}
+	if _, err := r.appliedMigrations(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, m := range migrations {
+		if m.version > target {
+			break
+		}
+		ran := false
+		err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			applied, err := r.lockMigrations(tx, m.version)
+			if err != nil || applied {
+				return err
+			}
+			if err := m.up(tx, opts); err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&schemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", m.version, m.name, err)
+		}
+		if ran {
+			slog.InfoContext(ctx, "applied migration", "version", m.version, "name", m.name)
+			done = append(done, m.version)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first,
+// and returns the versions it reverted. Data-only migrations have no down
+// step: reverting them just forgets they ran.
+func (r *Repository) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+		err := r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if _, err := r.lockMigrations(tx, m.version); err != nil {
+				return err
+			}
+			if m.down != nil {
+				if err := m.down(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Where("version = ?", m.version).Delete(&schemaMigration{}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("revert migration %d %s: %w", m.version, m.name, err)
+		}
+		slog.InfoContext(ctx, "reverted migration", "version", m.version, "name", m.name)
+		done = append(done, m.version)
+	}
+	return done, nil
+}
+
+// appliedMigrations creates schema_migrations if needed and returns its
+// rows by version. A version this binary doesn't know means the database
+// was migrated by a newer release, which is refused rather than guessed at.
+func (r *Repository) appliedMigrations(ctx context.Context) (map[int]schemaMigration, error) {
+	db := r.Db.WithContext(ctx)
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error; err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		if row.Version > LatestSchemaVersion() {
+			return nil, fmt.Errorf("database schema version %d is newer than this release (%d)", row.Version, LatestSchemaVersion())
+		}
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// lockMigrations takes the cross-replica migration lock for the rest of tx
+// (PostgreSQL only; SQLite serialises writers anyway) and reports whether
+// version was applied in the meantime.
+func (r *Repository) lockMigrations(tx *gorm.DB, version int) (bool, error) {
+	if r.Dialect() == "postgres" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			return false, err
+		}
+	}
+	var n int64
+	err := tx.Model(&schemaMigration{}).Where("version = ?", version).Count(&n).Error
+	return n > 0, err
+}
+
+func createTables(models ...any) func(*gorm.DB, MigrateOptions) error {
+	return func(tx *gorm.DB, _ MigrateOptions) error {
+		for _, m := range models {
+			if tx.Migrator().HasTable(m) {
+				continue
+			}
+			if err := tx.Migrator().CreateTable(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropTables(names ...string) func(*gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, name := range names {
+			if err := tx.Migrator().DropTable(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func addColumns(model any, fields ...string) func(*gorm.DB, MigrateOptions) error {
+	return func(tx *gorm.DB, _ MigrateOptions) error {
+		for _, f := range fields {
+			if tx.Migrator().HasColumn(model, f) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(model, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropColumns(model any, fields ...string) func(*gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, f := range fields {
+			if !tx.Migrator().HasColumn(model, f) {
+				continue
+			}
+			if err := tx.Migrator().DropColumn(model, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// 1: the original single-space schema.
+
+type sedeStatusV1 struct {
+	ID        uint      `gorm:"primarykey"`
+	IsOpen    bool      `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+func (sedeStatusV1) TableName() string { return "sede_statuses" }
+
+func migrateSingleSpaceStatuses(tx *gorm.DB, opts MigrateOptions) error {
+	return createTables(&sedeStatusV1{})(tx, opts)
+}
+
+// 2: spaces, and statuses scoped to one. Existing rows get space_id 0
+// until migration 3 assigns them.
+
+type spaceV2 struct {
+	ID             uint   `gorm:"primarykey"`
+	Slug           string `gorm:"uniqueIndex;not null"`
+	Name           string `gorm:"not null"`
+	Address        string
+	Lat            float64
+	Lon            float64
+	Timezone       string
+	LogoURL        string
+	URL            string
+	ContactEmail   string
+	Message        string
+	APIKeyHash     []byte `gorm:"not null"`
+	TelegramChatID int64
+	TelegramThread int
+	Projects       string
+	Links          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (spaceV2) TableName() string { return "spaces" }
+
+type sedeStatusV2 struct {
+	ID        uint      `gorm:"primarykey"`
+	SpaceID   uint      `gorm:"not null;default:0;index:idx_space_timestamp,priority:1"`
+	IsOpen    bool      `gorm:"not null"`
+	Reason    string    `gorm:"default:''"`
+	Timestamp time.Time `gorm:"not null;index:idx_space_timestamp,priority:2"`
+}
+
+func (sedeStatusV2) TableName() string { return "sede_statuses" }
+
+func migrateMultiSpace(tx *gorm.DB, opts MigrateOptions) error {
+	if err := createTables(&spaceV2{})(tx, opts); err != nil {
+		return err
+	}
+	if err := addColumns(&sedeStatusV2{}, "SpaceID", "Reason")(tx, opts); err != nil {
+		return err
+	}
+	if tx.Migrator().HasIndex(&sedeStatusV2{}, "idx_space_timestamp") {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(&sedeStatusV2{}, "idx_space_timestamp")
+}
+
+func revertMultiSpace(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&sedeStatusV2{}, "idx_space_timestamp") {
+		if err := tx.Migrator().DropIndex(&sedeStatusV2{}, "idx_space_timestamp"); err != nil {
+			return err
+		}
+	}
+	if err := dropColumns(&sedeStatusV2{}, "SpaceID", "Reason")(tx); err != nil {
+		return err
+	}
+	return dropTables("spaces")(tx)
+}
+
+// 3: assign single-space history to the default space, creating a
+// placeholder row for it when spaces.yaml hasn't been loaded yet; the boot
+// sync fills in the rest by slug.
+
+func migrateAssignLegacyStatuses(tx *gorm.DB, opts MigrateOptions) error {
+	var n int64
+	if err := tx.Model(&sedeStatusV2{}).Where("space_id = ?", 0).Count(&n).Error; err != nil || n == 0 {
+		return err
+	}
+	if opts.DefaultSpaceSlug == "" {
+		return fmt.Errorf("%d status rows predate multi-space support and no default space slug is configured", n)
+	}
+
+	sp := spaceV2{Slug: opts.DefaultSpaceSlug}
+	if err := tx.Where("slug = ?", sp.Slug).
+		Attrs(spaceV2{Name: sp.Slug, APIKeyHash: []byte{}}).
+		FirstOrCreate(&sp).Error; err != nil {
+		return fmt.Errorf("default space %q: %w", sp.Slug, err)
+	}
+	return tx.Model(&sedeStatusV2{}).Where("space_id = ?", 0).Update("space_id", sp.ID).Error
+}
+
+// 4: who toggled, and per-space webhooks with their delivery outbox.
+
+type sedeStatusV4 struct {
+	ActorName string `gorm:"default:''"`
+}
+
+func (sedeStatusV4) TableName() string { return "sede_statuses" }
+
+type spaceWebhooksV4 struct {
+	Webhooks string
+}
+
+func (spaceWebhooksV4) TableName() string { return "spaces" }
+
+type webhookDeliveryV4 struct {
+	ID            uint   `gorm:"primarykey"`
+	SpaceID       uint   `gorm:"not null;index"`
+	URL           string `gorm:"not null"`
+	Event         string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Attempts      int    `gorm:"not null;default:0"`
+	LastError     string
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+func (webhookDeliveryV4) TableName() string { return "webhook_deliveries" }
+
+func migrateStatusActorAndWebhooks(tx *gorm.DB, opts MigrateOptions) error {
+	if err := addColumns(&sedeStatusV4{}, "ActorName")(tx, opts); err != nil {
+		return err
+	}
+	if err := addColumns(&spaceWebhooksV4{}, "Webhooks")(tx, opts); err != nil {
+		return err
+	}
+	return createTables(&webhookDeliveryV4{})(tx, opts)
+}
+
+func revertStatusActorAndWebhooks(tx *gorm.DB) error {
+	if err := dropTables("webhook_deliveries")(tx); err != nil {
+		return err
+	}
+	if err := dropColumns(&spaceWebhooksV4{}, "Webhooks")(tx); err != nil {
+		return err
+	}
+	return dropColumns(&sedeStatusV4{}, "ActorName")(tx)
+}
+
+// 5: notification backends beyond Telegram.
+
+type spaceNotifiersV5 struct {
+	Notifiers string
+}
+
+func (spaceNotifiersV5) TableName() string { return "spaces" }
+
+// 6: the optional SpaceAPI v15 sections.
+
+type spaceAPISectionsV6 struct {
+	IconOpen         string
+	IconClosed       string
+	ContactMatrix    string
+	ContactMastodon  string
+	ContactIRC       string
+	ContactPhone     string
+	ContactIssueMail string
+	Feeds            string
+	Sensors          string
+	MembershipPlans  string
+	Areas            string
+	SpaceFed         string
+}
+
+func (spaceAPISectionsV6) TableName() string { return "spaces" }
+
+var spaceAPISectionsV6Fields = []string{
+	"IconOpen", "IconClosed", "ContactMatrix", "ContactMastodon", "ContactIRC",
+	"ContactPhone", "ContactIssueMail", "Feeds", "Sensors", "MembershipPlans",
+	"Areas", "SpaceFed",
+}
+
+// 7: device sensor readings.
+
+type sensorReadingV7 struct {
+	ID        uint      `gorm:"primarykey"`
+	SpaceID   uint      `gorm:"not null;index:idx_sensor_space_kind_ts,priority:1"`
+	Kind      string    `gorm:"not null;index:idx_sensor_space_kind_ts,priority:2"`
+	Location  string    `gorm:"not null;default:''"`
+	Name      string    `gorm:"not null;default:''"`
+	Unit      string    `gorm:"not null;default:''"`
+	Value     float64   `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null;index:idx_sensor_space_kind_ts,priority:3"`
+}
+
+func (sensorReadingV7) TableName() string { return "sensor_readings" }
+
+// 8: auto-close, stats hours and calendar settings.
+
+type spaceSchedulesV8 struct {
+	AutoClose  string
+	StatsHours string
+	Calendar   string
+}
+
+func (spaceSchedulesV8) TableName() string { return "spaces" }
+
+var spaceSchedulesV8Fields = []string{"AutoClose", "StatsHours", "Calendar"}
+
+// 9: per-space card identity backend.
+
+type spaceCardResolverV9 struct {
+	CardResolver string
+}
+
+func (spaceCardResolverV9) TableName() string { return "spaces" }
+
+// 10: local members and RFID cards registry.
+
+type memberV10 struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"not null"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (memberV10) TableName() string { return "members" }
+
+type cardV10 struct {
+	ID         uint   `gorm:"primarykey"`
+	MemberID   uint   `gorm:"not null;index"`
+	UID        string `gorm:"not null;uniqueIndex"`
+	HashSHA256 string `gorm:"not null"`
+	Active     bool   `gorm:"not null;default:true"`
+	CreatedAt  time.Time
+}
+
+func (cardV10) TableName() string { return "cards" }
+
+type cardSpaceV10 struct {
+	CardID  uint `gorm:"primaryKey;autoIncrement:false"`
+	SpaceID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+func (cardSpaceV10) TableName() string { return "card_spaces" }
+
+// 11: per-space card requirement and the access decision log.
+
+type spaceRequireCardV11 struct {
+	RequireCard bool
+}
+
+func (spaceRequireCardV11) TableName() string { return "spaces" }
+
+type accessDecisionV11 struct {
+	ID        uint      `gorm:"primarykey"`
+	SpaceID   uint      `gorm:"not null;index:idx_access_space_ts,priority:1"`
+	Timestamp time.Time `gorm:"not null;index:idx_access_space_ts,priority:2"`
+	Open      bool      `gorm:"not null"`
+	Allowed   bool      `gorm:"not null"`
+	Reason    string    `gorm:"not null"`
+	CardUID   string    `gorm:"not null;default:''"`
+	ActorName string    `gorm:"not null;default:''"`
+	ClientIP  string    `gorm:"not null;default:''"`
+}
+
+func (accessDecisionV11) TableName() string { return "access_decisions" }
+
+func migrateRequireCard(tx *gorm.DB, opts MigrateOptions) error {
+	if err := addColumns(&spaceRequireCardV11{}, "RequireCard")(tx, opts); err != nil {
+		return err
+	}
+	return createTables(&accessDecisionV11{})(tx, opts)
+}
+
+func revertRequireCard(tx *gorm.DB) error {
+	if err := dropTables("access_decisions")(tx); err != nil {
+		return err
+	}
+	return dropColumns(&spaceRequireCardV11{}, "RequireCard")(tx)
+}
+
+// 12: how and from where each status change came in, and the per-space
+// public names switch.
+
+type sedeStatusV12 struct {
+	CardHash string `gorm:"default:''"`
+	Source   string `gorm:"default:''"`
+	ClientIP string `gorm:"default:''"`
+}
+
+func (sedeStatusV12) TableName() string { return "sede_statuses" }
+
+var sedeStatusV12Fields = []string{"CardHash", "Source", "ClientIP"}
+
+type spaceHideNamesV12 struct {
+	HideNames bool
+}
+
+func (spaceHideNamesV12) TableName() string { return "spaces" }
+
+func migrateStatusAttribution(tx *gorm.DB, opts MigrateOptions) error {
+	if err := addColumns(&sedeStatusV12{}, sedeStatusV12Fields...)(tx, opts); err != nil {
+		return err
+	}
+	return addColumns(&spaceHideNamesV12{}, "HideNames")(tx, opts)
+}
+
+func revertStatusAttribution(tx *gorm.DB) error {
+	if err := dropColumns(&spaceHideNamesV12{}, "HideNames")(tx); err != nil {
+		return err
+	}
+	return dropColumns(&sedeStatusV12{}, sedeStatusV12Fields...)(tx)
+}
+
+// 13: per-device keys and heartbeats.
+
+type deviceV13 struct {
+	ID              uint   `gorm:"primarykey"`
+	SpaceID         uint   `gorm:"not null;index"`
+	Name            string `gorm:"not null"`
+	KeyHash         string `gorm:"not null;uniqueIndex"`
+	Actions         string `gorm:"not null;default:''"`
+	Active          bool   `gorm:"not null;default:true"`
+	LastHeartbeatAt *time.Time
+	Offline         bool `gorm:"not null;default:false"`
+	CreatedAt       time.Time
+}
+
+func (deviceV13) TableName() string { return "devices" }
+
+// 14: named, scoped API tokens.
+
+type apiTokenV14 struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"not null"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	Scopes    string `gorm:"not null"`
+	SpaceID   *uint
+	ExpiresAt *time.Time
+	Active    bool `gorm:"not null;default:true"`
+	CreatedAt time.Time
+}
+
+func (apiTokenV14) TableName() string { return "api_tokens" }
+
+// 15: what spaces.yaml last set for each space.
+
+type spaceFileStateV15 struct {
+	FileState string
+}
+
+func (spaceFileStateV15) TableName() string { return "spaces" }
+
+// 16: the access log keeps the SHA-256 of the card UID, like status rows,
+// instead of the UID itself. Hashing is one way: going down leaves the
+// UIDs empty.
+
+type accessCardHashV16 struct {
+	CardHash string `gorm:"not null;default:''"`
+}
+
+func (accessCardHashV16) TableName() string { return "access_decisions" }
+
+type accessCardUIDV16 struct {
+	CardUID string `gorm:"not null;default:''"`
+}
+
+func (accessCardUIDV16) TableName() string { return "access_decisions" }
+
+func migrateAccessCardHash(tx *gorm.DB, opts MigrateOptions) error {
+	if err := addColumns(&accessCardHashV16{}, "CardHash")(tx, opts); err != nil {
+		return err
+	}
+	if tx.Migrator().HasColumn(&accessCardUIDV16{}, "CardUID") {
+		var rows []struct {
+			ID      uint
+			CardUID string
+		}
+		err := tx.Table("access_decisions").Select("id, card_uid").Where("card_uid <> ''").
+			FindInBatches(&rows, 500, func(batch *gorm.DB, _ int) error {
+				for _, r := range rows {
+					if err := tx.Table("access_decisions").Where("id = ?", r.ID).Update("card_hash", sha256Hex(r.CardUID)).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return dropColumns(&accessCardUIDV16{}, "CardUID")(tx)
+}
+
+func revertAccessCardHash(tx *gorm.DB) error {
+	if err := addColumns(&accessCardUIDV16{}, "CardUID")(tx, MigrateOptions{}); err != nil {
+		return err
+	}
+	return dropColumns(&accessCardHashV16{}, "CardHash")(tx)
+}
+
+// 17: the latest reading of each sensor series, maintained on write, so
+// SpaceAPI doesn't scan the whole history. Filled from the readings so far.
+
+type latestSensorReadingV17 struct {
+	SpaceID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Kind      string    `gorm:"primaryKey"`
+	Location  string    `gorm:"primaryKey"`
+	Name      string    `gorm:"primaryKey"`
+	ReadingID uint      `gorm:"not null"`
+	Unit      string    `gorm:"not null;default:''"`
+	Value     float64   `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+func (latestSensorReadingV17) TableName() string { return "latest_sensor_readings" }
+
+func migrateLatestSensorReadings(tx *gorm.DB, _ MigrateOptions) error {
+	if tx.Migrator().HasTable(&latestSensorReadingV17{}) {
+		return nil
+	}
+	if err := tx.Migrator().CreateTable(&latestSensorReadingV17{}); err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO latest_sensor_readings (space_id, kind, location, name, reading_id, unit, value, timestamp)
+		SELECT space_id, kind, location, name, id, unit, value, timestamp FROM sensor_readings
+		WHERE id IN (SELECT MAX(id) FROM sensor_readings GROUP BY space_id, kind, location, name)`).Error
+}
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"gorm.io/gorm"
+)
+
+// openSQLite opens an unmigrated repository on a temporary SQLite file.
+// Fixture tests always use SQLite: the fixtures are dumps of databases
+// that only ever existed there.
+func openSQLite(t *testing.T) *Repository {
+	t.Helper()
+	repo, err := Open(config.Config{DatabasePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := repo.Db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return repo
+}
+
+func loadFixture(t *testing.T, repo *Repository, name string) {
+	t.Helper()
+	sql, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One statement per Exec: prepared statements stop at the first.
+	for _, stmt := range strings.Split(string(sql), ";\n") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if err := repo.Db.Exec(stmt).Error; err != nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+	}
+}
+
+func allVersions() []int {
+	out := make([]int, len(migrations))
+	for i, m := range migrations {
+		out[i] = m.version
+	}
+	return out
+}
+
+// assertSchemaMatchesModels checks that every column of the live models
+// exists, i.e. that the migrations haven't fallen behind the structs.
+func assertSchemaMatchesModels(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, model := range []any{&Space{}, &SedeStatus{}, &WebhookDelivery{}, &SensorReading{}, &Member{}, &Card{}, &CardSpace{}, &AccessDecision{}, &Device{}, &APIToken{}, &LatestSensorReading{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table %s missing", stmt.Schema.Table)
+			continue
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName != "" && !db.Migrator().HasColumn(model, f.DBName) {
+				t.Errorf("column %s.%s missing", stmt.Schema.Table, f.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrateUp_SingleSpaceFixture(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+	loadFixture(t, repo, "single_space.sql")
+
+	applied, err := repo.MigrateUp(ctx, MigrateOptions{DefaultSpaceSlug: "pescara"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, allVersions()) {
+		t.Errorf("applied %v, want %v", applied, allVersions())
+	}
+	assertSchemaMatchesModels(t, repo.Db)
+
+	sp, err := repo.GetSpaceBySlug(ctx, "pescara")
+	if err != nil {
+		t.Fatalf("default space not created: %v", err)
+	}
+	var orphans, owned int64
+	repo.Db.Model(&SedeStatus{}).Where("space_id = ?", 0).Count(&orphans)
+	repo.Db.Model(&SedeStatus{}).Where("space_id = ?", sp.ID).Count(&owned)
+	if orphans != 0 || owned != 3 {
+		t.Errorf("orphans %d, owned by pescara %d", orphans, owned)
+	}
+
+	latest, err := repo.GetLatestStatus(ctx, sp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.IsOpen || !latest.Timestamp.Equal(time.Date(2024, 3, 2, 17, 15, 0, 0, time.UTC)) {
+		t.Errorf("latest = %+v", latest)
+	}
+
+	// The boot sync fills in the placeholder by slug, keeping its ID.
+	synced, err := repo.UpsertSpace(ctx, Space{Slug: "pescara", Name: "Metro Olografix", APIKeyHash: []byte("hash")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.ID != sp.ID || synced.Name != "Metro Olografix" {
+		t.Errorf("synced = %+v, want ID %d", synced, sp.ID)
+	}
+
+	again, err := repo.MigrateUp(ctx, MigrateOptions{DefaultSpaceSlug: "pescara"}, 0)
+	if err != nil || len(again) != 0 {
+		t.Errorf("second run applied %v, err %v", again, err)
+	}
+}
+
+func TestMigrateUp_SingleSpaceFixtureNeedsDefaultSlug(t *testing.T) {
+	repo := openSQLite(t)
+	loadFixture(t, repo, "single_space.sql")
+
+	applied, err := repo.MigrateUp(context.Background(), MigrateOptions{}, 0)
+	if err == nil {
+		t.Fatal("expected an error without a default space slug")
+	}
+	if !reflect.DeepEqual(applied, []int{1, 2}) {
+		t.Errorf("applied %v, want [1 2]", applied)
+	}
+}
+
+// A database built by AutoMigrate in earlier releases already has the full
+// schema but no schema_migrations; migrating it must only record versions.
+func TestMigrateUp_AutoMigratedDatabase(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+	if err := repo.Db.AutoMigrate(&Space{}, &SedeStatus{}, &WebhookDelivery{}, &SensorReading{}); err != nil {
+		t.Fatal(err)
+	}
+	id := seedSpace(t, repo, "pescara")
+	if err := repo.CreateStatus(ctx, &SedeStatus{SpaceID: id, IsOpen: true, Timestamp: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := repo.MigrateUp(ctx, MigrateOptions{DefaultSpaceSlug: "pescara"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, allVersions()) {
+		t.Errorf("applied %v, want %v", applied, allVersions())
+	}
+	if _, err := repo.GetLatestStatus(ctx, id); err != nil {
+		t.Errorf("status lost: %v", err)
+	}
+}
+
+func TestMigrateUp_Target(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+
+	applied, err := repo.MigrateUp(ctx, MigrateOptions{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []int{1, 2}) {
+		t.Errorf("applied %v, want [1 2]", applied)
+	}
+
+	status, err := repo.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if (s.AppliedAt != nil) != (s.Version <= 2) {
+			t.Errorf("version %d applied at %v", s.Version, s.AppliedAt)
+		}
+	}
+
+	applied, err = repo.MigrateUp(ctx, MigrateOptions{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, allVersions()[2:]) {
+		t.Errorf("applied %v, want %v", applied, allVersions()[2:])
+	}
+}
+
+func TestMigrateUp_HashesAccessLogCards(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 15); err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range []string{"0102", ""} {
+		if err := repo.Db.Exec(
+			"INSERT INTO access_decisions (space_id, timestamp, open, allowed, reason, card_uid) VALUES (1, ?, true, true, 'member', ?)",
+			time.Now().UTC(), uid).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 16); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []AccessDecision
+	if err := repo.Db.Order("id asc").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].CardHash != sha256Hex("0102") || rows[1].CardHash != "" {
+		t.Errorf("rows: %+v", rows)
+	}
+	if repo.Db.Migrator().HasColumn(&AccessDecision{}, "card_uid") {
+		t.Error("card_uid kept")
+	}
+}
+
+func TestMigrateUp_FillsLatestSensorReadings(t *testing.T) {
+	repo := openSQLite(t)
+	ctx := context.Background()
+
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 16); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, r := range []struct {
+		location string
+		value    float64
+	}{{"sala", 20}, {"lab", 18}, {"sala", 21}} {
+		if err := repo.Db.Exec(
+			"INSERT INTO sensor_readings (space_id, kind, location, name, unit, value, timestamp) VALUES (1, 'temperature', ?, '', '°C', ?, ?)",
+			r.location, r.value, base.Add(time.Duration(i)*time.Minute)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 17); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.LatestSensorReadings(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Location != "lab" || got[0].Value != 18 || got[1].Location != "sala" || got[1].Value != 21 || got[1].ID != 3 {
+		t.Errorf("latest readings: %+v", got)
+	}
+}
+
+func TestMigrateDown_Roundtrip(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	reverted, err := repo.MigrateDown(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reverted, []int{LatestSchemaVersion()}) {
+		t.Errorf("reverted %v", reverted)
+	}
+	if repo.Db.Migrator().HasTable("latest_sensor_readings") {
+		t.Error("latest_sensor_readings not dropped by its down step")
+	}
+
+	if _, err := repo.MigrateDown(ctx, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"spaces", "sede_statuses", "webhook_deliveries", "sensor_readings"} {
+		if repo.Db.Migrator().HasTable(table) {
+			t.Errorf("table %s survived migrating down", table)
+		}
+	}
+	status, err := repo.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.AppliedAt != nil {
+			t.Errorf("version %d still applied", s.Version)
+		}
+	}
+
+	if _, err := repo.MigrateUp(ctx, MigrateOptions{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	assertSchemaMatchesModels(t, repo.Db)
+}
+
+func TestMigrateUp_RefusesNewerSchema(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	future := schemaMigration{Version: LatestSchemaVersion() + 1, Name: "future", AppliedAt: time.Now().UTC()}
+	if err := repo.Db.Create(&future).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.MigrateUp(context.Background(), MigrateOptions{}, 0); err == nil {
+		t.Error("expected an error for a schema newer than the binary")
+	}
+	if _, err := repo.MigrationStatus(context.Background()); err == nil {
+		t.Error("expected status to report the newer schema")
+	}
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SensorReading is one measurement pushed by a space's device. Kind is the
+// SpaceAPI sensor key (temperature, humidity, people_now_present, ...);
+// Location and Name tell apart several sensors of the same kind, and the
+// latest reading of each (kind, location, name) series is what SpaceAPI
+// publishes. Timestamp is assigned on receipt: the devices have no reliable
+// clock.
+type SensorReading struct {
+	ID        uint      `gorm:"primarykey"`
+	SpaceID   uint      `gorm:"not null;index:idx_sensor_space_kind_ts,priority:1"`
+	Kind      string    `gorm:"not null;index:idx_sensor_space_kind_ts,priority:2"`
+	Location  string    `gorm:"not null;default:''"`
+	Name      string    `gorm:"not null;default:''"`
+	Unit      string    `gorm:"not null;default:''"`
+	Value     float64   `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null;index:idx_sensor_space_kind_ts,priority:3"`
+}
+
+// LatestSensorReading is the newest reading of one series, kept apart from
+// the ever-growing sensor_readings so that SpaceAPI requests read one row
+// per series. ReadingID is the sensor_readings row it copies.
+type LatestSensorReading struct {
+	SpaceID   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Kind      string    `gorm:"primaryKey"`
+	Location  string    `gorm:"primaryKey"`
+	Name      string    `gorm:"primaryKey"`
+	ReadingID uint      `gorm:"not null"`
+	Unit      string    `gorm:"not null;default:''"`
+	Value     float64   `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+// CreateSensorReadings stores a batch of readings and updates the latest
+// value of their series, in one transaction.
+func (r *Repository) CreateSensorReadings(ctx context.Context, readings []SensorReading) error {
+	if len(readings) == 0 {
+		return nil
+	}
+	return r.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&readings).Error; err != nil {
+			return err
+		}
+		// One row per series: an upsert can't touch the same row twice.
+		type series struct {
+			space                uint
+			kind, location, name string
+		}
+		index := make(map[series]int)
+		var latest []LatestSensorReading
+		for _, rd := range readings {
+			l := LatestSensorReading{
+				SpaceID: rd.SpaceID, Kind: rd.Kind, Location: rd.Location, Name: rd.Name,
+				ReadingID: rd.ID, Unit: rd.Unit, Value: rd.Value, Timestamp: rd.Timestamp,
+			}
+			k := series{rd.SpaceID, rd.Kind, rd.Location, rd.Name}
+			if i, ok := index[k]; ok {
+				latest[i] = l
+				continue
+			}
+			index[k] = len(latest)
+			latest = append(latest, l)
+		}
+		// A concurrent push may have committed a newer reading already.
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "space_id"}, {Name: "kind"}, {Name: "location"}, {Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reading_id", "unit", "value", "timestamp"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "latest_sensor_readings.reading_id < excluded.reading_id"},
+			}},
+		}).Create(&latest).Error
+	})
+}
+
+// LatestSensorReadings returns the most recent reading of every series
+// (kind, location, name) of the space, ordered by kind, location and name.
+func (r *Repository) LatestSensorReadings(ctx context.Context, spaceID uint) ([]SensorReading, error) {
+	var latest []LatestSensorReading
+	err := r.Db.WithContext(ctx).
+		Where("space_id = ?", spaceID).
+		Order("kind asc, location asc, name asc").
+		Find(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	readings := make([]SensorReading, len(latest))
+	for i, l := range latest {
+		readings[i] = SensorReading{
+			ID: l.ReadingID, SpaceID: l.SpaceID, Kind: l.Kind, Location: l.Location, Name: l.Name,
+			Unit: l.Unit, Value: l.Value, Timestamp: l.Timestamp,
+		}
+	}
+	return readings, nil
+}
+
+// ListSensorReadings returns the newest limit readings of the space in
+// [since, until), optionally restricted to one kind, oldest first, and
+// whether older readings in the window were left out.
+func (r *Repository) ListSensorReadings(ctx context.Context, spaceID uint, kind string, since, until time.Time, limit int) ([]SensorReading, bool, error) {
+	q := r.Db.WithContext(ctx).
+		Where("space_id = ? AND timestamp >= ? AND timestamp < ?", spaceID, since, until)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	var readings []SensorReading
+	if err := q.Order("timestamp desc, id desc").Limit(limit + 1).Find(&readings).Error; err != nil {
+		return nil, false, err
+	}
+	truncated := len(readings) > limit
+	if truncated {
+		readings = readings[:limit]
+	}
+	slices.Reverse(readings)
+	return readings, truncated, nil
+}
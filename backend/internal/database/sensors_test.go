@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatestSensorReadings_PerSeries(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	pescara := seedSpace(t, repo, "pescara")
+	aquila := seedSpace(t, repo, "aquila")
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := repo.CreateSensorReadings(ctx, []SensorReading{
+		{SpaceID: pescara, Kind: "temperature", Location: "sala", Unit: "°C", Value: 20, Timestamp: base},
+		{SpaceID: pescara, Kind: "temperature", Location: "lab", Unit: "°C", Value: 18, Timestamp: base},
+		{SpaceID: pescara, Kind: "people_now_present", Value: 2, Timestamp: base},
+		{SpaceID: aquila, Kind: "temperature", Location: "sala", Unit: "°C", Value: 30, Timestamp: base},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateSensorReadings(ctx, []SensorReading{
+		{SpaceID: pescara, Kind: "temperature", Location: "sala", Unit: "°C", Value: 21, Timestamp: base.Add(time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.LatestSensorReadings(ctx, pescara)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind, location string
+		value          float64
+	}{
+		{"people_now_present", "", 2},
+		{"temperature", "lab", 18},
+		{"temperature", "sala", 21},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d readings, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].Location != w.location || got[i].Value != w.value {
+			t.Errorf("reading %d: got %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestLatestSensorReadings_NewestWins(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	sp := seedSpace(t, repo, "pescara")
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Two readings of one series in the same push: the last one counts.
+	if err := repo.CreateSensorReadings(ctx, []SensorReading{
+		{SpaceID: sp, Kind: "temperature", Value: 20, Timestamp: base},
+		{SpaceID: sp, Kind: "temperature", Value: 21, Timestamp: base},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.LatestSensorReadings(ctx, sp)
+	if err != nil || len(got) != 1 || got[0].Value != 21 {
+		t.Fatalf("latest %+v, %v", got, err)
+	}
+
+	// A push that committed late, with an ID allocated before the newest
+	// reading's, must not replace it.
+	for _, rd := range []SensorReading{
+		{ID: 100, SpaceID: sp, Kind: "temperature", Value: 23, Timestamp: base.Add(2 * time.Minute)},
+		{ID: 50, SpaceID: sp, Kind: "temperature", Value: 22, Timestamp: base.Add(time.Minute)},
+	} {
+		if err := repo.CreateSensorReadings(ctx, []SensorReading{rd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := repo.LatestSensorReadings(ctx, sp); len(got) != 1 || got[0].Value != 23 || got[0].ID != 100 {
+		t.Errorf("latest %+v", got)
+	}
+}
+
+func TestLatestSensorReadings_Empty(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	got, err := repo.LatestSensorReadings(context.Background(), seedSpace(t, repo, "pescara"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want no readings, got %+v", got)
+	}
+}
+
+func TestListSensorReadings_RangeKindAndLimit(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sp := seedSpace(t, repo, "pescara")
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var batch []SensorReading
+	for i := range 5 {
+		ts := base.Add(time.Duration(i) * time.Hour)
+		batch = append(batch,
+			SensorReading{SpaceID: sp, Kind: "temperature", Location: "sala", Unit: "°C", Value: float64(20 + i), Timestamp: ts},
+			SensorReading{SpaceID: sp, Kind: "humidity", Location: "sala", Unit: "%", Value: 50, Timestamp: ts},
+		)
+	}
+	if err := repo.CreateSensorReadings(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	got, truncated, err := repo.ListSensorReadings(ctx, sp, "temperature", base.Add(time.Hour), base.Add(4*time.Hour), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Value != 21 || got[2].Value != 23 || truncated {
+		t.Errorf("range: got %+v, truncated %v", got, truncated)
+	}
+
+	// Over the limit, the newest readings are kept.
+	got, truncated, err = repo.ListSensorReadings(ctx, sp, "", base, base.Add(5*time.Hour), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || !got[0].Timestamp.Equal(base.Add(3*time.Hour)) || !got[3].Timestamp.Equal(base.Add(4*time.Hour)) || !truncated {
+		t.Errorf("limit: got %+v, truncated %v", got, truncated)
+	}
+
+	if got, truncated, _ := repo.ListSensorReadings(ctx, sp, "temperature", base, base.Add(5*time.Hour), 5); len(got) != 5 || truncated {
+		t.Errorf("exactly the limit: %d readings, truncated %v", len(got), truncated)
+	}
+}
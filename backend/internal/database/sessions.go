@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is one open interval of a space, rebuilt from consecutive status
+// rows: it starts at the row that opened the space and ends at the next row
+// that closed it. End is nil while the space is still open. OpenedVia and
+// ClosedVia are the Source of those rows.
+type Session struct {
+	Start       time.Time
+	End         *time.Time
+	OpenedBy    string
+	OpenedVia   string
+	ClosedBy    string
+	ClosedVia   string
+	CloseReason string
+}
+
+// ListSessions returns the sessions of a space that overlap [from, to),
+// oldest first. A session that started before from or ended after to is
+// returned whole.
+func (r *Repository) ListSessions(ctx context.Context, spaceID uint, from, to time.Time) ([]Session, error) {
+	db := r.Db.WithContext(ctx)
+
+	var before *SedeStatus
+	var row SedeStatus
+	err := db.Where("space_id = ? AND timestamp < ?", spaceID, from).
+		Order("timestamp desc, id desc").
+		First(&row).Error
+	switch {
+	case err == nil:
+		before = &row
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	var rows []SedeStatus
+	if err := db.Where("space_id = ? AND timestamp >= ? AND timestamp < ?", spaceID, from, to).
+		Order("timestamp asc, id asc").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// The close of a session still open at to.
+	var closing SedeStatus
+	err = db.Where("space_id = ? AND timestamp >= ? AND is_open = ?", spaceID, to, false).
+		Order("timestamp asc, id asc").
+		First(&closing).Error
+	switch {
+	case err == nil:
+		rows = append(rows, closing)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	// The opening row before from only matters if the space was open.
+	if before != nil && before.IsOpen {
+		start, err := r.sessionStart(ctx, spaceID, *before)
+		if err != nil {
+			return nil, err
+		}
+		rows = append([]SedeStatus{start}, rows...)
+	}
+	return buildSessions(rows), nil
+}
+
+// sessionStart walks back from an open row to the row that opened the
+// session, skipping repeated "open" events.
+func (r *Repository) sessionStart(ctx context.Context, spaceID uint, open SedeStatus) (SedeStatus, error) {
+	var lastClose SedeStatus
+	err := r.Db.WithContext(ctx).
+		Where("space_id = ? AND timestamp <= ? AND is_open = ?", spaceID, open.Timestamp, false).
+		Order("timestamp desc, id desc").
+		First(&lastClose).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		lastClose.Timestamp = time.Time{}
+	} else if err != nil {
+		return SedeStatus{}, err
+	}
+
+	var first SedeStatus
+	err = r.Db.WithContext(ctx).
+		Where("space_id = ? AND timestamp > ? AND timestamp <= ? AND is_open = ?", spaceID, lastClose.Timestamp, open.Timestamp, true).
+		Order("timestamp asc, id asc").
+		First(&first).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return open, nil
+	}
+	return first, err
+}
+
+// buildSessions folds status rows, oldest first, into sessions. Repeated
+// open rows extend the current session and close rows without an open
+// session are ignored.
+func buildSessions(rows []SedeStatus) []Session {
+	sessions := []Session{}
+	var cur *Session
+	for _, row := range rows {
+		switch {
+		case row.IsOpen && cur == nil:
+			sessions = append(sessions, Session{Start: row.Timestamp, OpenedBy: row.ActorName, OpenedVia: row.Source})
+			cur = &sessions[len(sessions)-1]
+		case !row.IsOpen && cur != nil:
+			end := row.Timestamp
+			cur.End = &end
+			cur.ClosedBy, cur.ClosedVia = row.ActorName, row.Source
+			cur.CloseReason = row.Reason
+			cur = nil
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBuildSessions(t *testing.T) {
+	base := time.Date(2024, 5, 6, 18, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+
+	cases := []struct {
+		name string
+		rows []SedeStatus
+		want []Session
+	}{
+		{"empty", nil, []Session{}},
+		{
+			"open and close",
+			[]SedeStatus{
+				{IsOpen: true, ActorName: "Mario", Source: SourceButton, Timestamp: at(0)},
+				{IsOpen: false, ActorName: "Luigi", Source: SourceAdmin, Timestamp: at(90)},
+			},
+			[]Session{{Start: at(0), End: ptr(at(90)), OpenedBy: "Mario", OpenedVia: SourceButton, ClosedBy: "Luigi", ClosedVia: SourceAdmin}},
+		},
+		{
+			"repeated opens extend the session",
+			[]SedeStatus{
+				{IsOpen: true, ActorName: "Mario", Timestamp: at(0)},
+				{IsOpen: true, ActorName: "Anna", Timestamp: at(10)},
+				{IsOpen: false, Reason: "gelatino", Timestamp: at(30)},
+			},
+			[]Session{{Start: at(0), End: ptr(at(30)), OpenedBy: "Mario", CloseReason: "gelatino"}},
+		},
+		{
+			"stray close and open tail",
+			[]SedeStatus{
+				{IsOpen: false, Timestamp: at(0)},
+				{IsOpen: true, Timestamp: at(10)},
+				{IsOpen: false, Reason: "auto", Timestamp: at(20)},
+				{IsOpen: false, Timestamp: at(25)},
+				{IsOpen: true, Timestamp: at(40)},
+			},
+			[]Session{
+				{Start: at(10), End: ptr(at(20)), CloseReason: "auto"},
+				{Start: at(40)},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := buildSessions(c.rows)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+			for i := range got {
+				if !sameSession(got[i], c.want[i]) {
+					t.Errorf("session %d: got %+v, want %+v", i, got[i], c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListSessions_OverlappingRange(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sp := seedSpace(t, repo, "pescara")
+	other := seedSpace(t, repo, "aquila")
+	day := func(d, h int) time.Time { return time.Date(2024, 5, d, h, 0, 0, 0, time.UTC) }
+	for _, s := range []SedeStatus{
+		{SpaceID: sp, IsOpen: true, ActorName: "Mario", Timestamp: day(1, 20)},
+		{SpaceID: sp, IsOpen: true, ActorName: "Anna", Timestamp: day(1, 21)},
+		{SpaceID: sp, IsOpen: false, Timestamp: day(2, 1)}, // crosses from
+		{SpaceID: sp, IsOpen: true, Timestamp: day(3, 18)},
+		{SpaceID: sp, IsOpen: false, Reason: "gelatino", Timestamp: day(3, 22)},
+		{SpaceID: sp, IsOpen: true, Timestamp: day(4, 22)},
+		{SpaceID: sp, IsOpen: false, Timestamp: day(5, 2)}, // crosses to
+		{SpaceID: sp, IsOpen: true, Timestamp: day(9, 18)}, // after to
+		{SpaceID: other, IsOpen: true, Timestamp: day(3, 10)},
+	} {
+		if err := repo.CreateStatus(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.ListSessions(ctx, sp, day(2, 0), day(5, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Session{
+		{Start: day(1, 20), End: ptr(day(2, 1)), OpenedBy: "Mario"},
+		{Start: day(3, 18), End: ptr(day(3, 22)), CloseReason: "gelatino"},
+		{Start: day(4, 22), End: ptr(day(5, 2))},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range got {
+		if !sameSession(got[i], want[i]) {
+			t.Errorf("session %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// A session still open has no end.
+	got, err = repo.ListSessions(ctx, sp, day(9, 0), day(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].End != nil {
+		t.Errorf("open session: %+v", got)
+	}
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func sameSession(a, b Session) bool {
+	if !a.Start.Equal(b.Start) || a.OpenedBy != b.OpenedBy || a.ClosedBy != b.ClosedBy || a.CloseReason != b.CloseReason ||
+		a.OpenedVia != b.OpenedVia || a.ClosedVia != b.ClosedVia {
+		return false
+	}
+	if a.End == nil || b.End == nil {
+		return a.End == nil && b.End == nil
+	}
+	return a.End.Equal(*b.End)
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// weeklyStatsDays is how far back GetWeeklyStats looks.
+const weeklyStatsDays = 90
+
+// StatsWindow controls how GetWeeklyStats buckets a space's history:
+// weekdays and hours are taken in Location, so the heatmap follows the
+// space's wall clock across DST changes, and only hours in
+// [FromHour, ToHour] are reported. The 90 days analysed end at End, or now
+// when End is zero.
+type StatsWindow struct {
+	Location *time.Location
+	FromHour int
+	ToHour   int
+	End      time.Time
+}
+
+// DefaultStatsWindow is the 9-21 hour range used when a space does not
+// configure one.
+func DefaultStatsWindow(loc *time.Location) StatsWindow {
+	return StatsWindow{Location: loc, FromHour: 9, ToHour: 21}
+}
+
+var weekdayOrder = []time.Weekday{
+	time.Sunday, time.Monday, time.Tuesday, time.Wednesday,
+	time.Thursday, time.Friday, time.Saturday,
+}
+
+// GetWeeklyStats returns, for each local weekday and hour, the fraction of
+// time the space was actually open over the last 90 days. Open intervals
+// are rebuilt from consecutive status rows, so a space opened at 18:30 and
+// closed at 20:00 counts as half of the 18:00 slot and all of the 19:00 one,
+// however many times the button was pressed.
+func (r *Repository) GetWeeklyStats(ctx context.Context, spaceID uint, w StatsWindow) ([]WeeklyStatsDetailed, error) {
+	end := w.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	since := end.UTC().AddDate(0, 0, -weeklyStatsDays).Truncate(24 * time.Hour)
+
+	// The row before the window tells whether the space was already open
+	// when it starts.
+	var before SedeStatus
+	err := r.Db.WithContext(ctx).
+		Where("space_id = ? AND timestamp < ?", spaceID, since).
+		Order("timestamp desc").
+		First(&before).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	hasBefore := err == nil
+
+	var rows []SedeStatus
+	err = r.Db.WithContext(ctx).
+		Select("is_open", "timestamp").
+		Where("space_id = ? AND timestamp >= ? AND timestamp < ?", spaceID, since, end).
+		Order("timestamp asc, id asc").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	start := since
+	if !hasBefore {
+		if len(rows) == 0 {
+			return []WeeklyStatsDetailed{}, nil
+		}
+		// Time before the first ever event is unknown, not closed.
+		start = rows[0].Timestamp
+	}
+	return weeklyOccupancy(before.IsOpen && hasBefore, rows, start, end, w), nil
+}
+
+// weeklyOccupancy splits [start, end) into local hour slots and measures how
+// much of each the space was open. openAtStart is the state at start; rows
+// are the later status changes, oldest first.
+func weeklyOccupancy(openAtStart bool, rows []SedeStatus, start, end time.Time, w StatsWindow) []WeeklyStatsDetailed {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	type slot struct{ open, total time.Duration }
+	var daily [7]slot
+	var hourly [7][24]slot
+
+	open := openAtStart
+	next := 0
+	for t := start; t.Before(end); {
+		local := t.In(loc)
+		day, hour := local.Weekday(), local.Hour()
+
+		// Advance to the next local hour boundary. Zone offsets are not
+		// always whole hours, so compute it from the local clock rather
+		// than truncating UTC.
+		_, offset := local.Zone()
+		sec := (t.Unix() + int64(offset)) % 3600
+		if sec < 0 {
+			sec += 3600
+		}
+		segEnd := t.Add(time.Duration(3600-sec)*time.Second - time.Duration(t.Nanosecond()))
+		if segEnd.After(end) {
+			segEnd = end
+		}
+
+		// Walk the status changes inside this slot.
+		for cur := t; cur.Before(segEnd); {
+			for next < len(rows) && !rows[next].Timestamp.After(cur) {
+				open = rows[next].IsOpen
+				next++
+			}
+			stop := segEnd
+			if next < len(rows) && rows[next].Timestamp.Before(segEnd) {
+				stop = rows[next].Timestamp
+			}
+			d := stop.Sub(cur)
+			daily[day].total += d
+			hourly[day][hour].total += d
+			if open {
+				daily[day].open += d
+				hourly[day][hour].open += d
+			}
+			cur = stop
+		}
+		t = segEnd
+	}
+
+	result := []WeeklyStatsDetailed{}
+	for _, day := range weekdayOrder {
+		if daily[day].total == 0 {
+			continue
+		}
+		stat := WeeklyStatsDetailed{
+			Day:              day.String(),
+			DailyProbability: daily[day].open.Seconds() / daily[day].total.Seconds(),
+			Hourly:           []HourlyStat{},
+		}
+		for hour := w.FromHour; hour <= w.ToHour && hour < 24; hour++ {
+			s := hourly[day][hour]
+			if s.total == 0 {
+				continue
+			}
+			stat.Hourly = append(stat.Hourly, HourlyStat{
+				Hour:        fmt.Sprintf("%02d", hour),
+				Probability: s.open.Seconds() / s.total.Seconds(),
+			})
+		}
+		result = append(result, stat)
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWeeklyOccupancy_SyntheticTimelines(t *testing.T) {
+	// Monday 6 May 2024, UTC, so local and UTC hours match.
+	monday := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	at := func(day int, hour, minute int) time.Time {
+		return monday.AddDate(0, 0, day).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	ev := func(open bool, ts time.Time) SedeStatus { return SedeStatus{IsOpen: open, Timestamp: ts} }
+
+	type slot struct {
+		day  string
+		hour string
+		want float64
+	}
+	cases := []struct {
+		name        string
+		openAtStart bool
+		rows        []SedeStatus
+		start, end  time.Time
+		slots       []slot
+		daily       map[string]float64
+	}{
+		{
+			name:  "open for two full hours",
+			rows:  []SedeStatus{ev(true, at(0, 18, 0)), ev(false, at(0, 20, 0))},
+			start: at(0, 0, 0), end: at(1, 0, 0),
+			slots: []slot{{"Monday", "17", 0}, {"Monday", "18", 1}, {"Monday", "19", 1}, {"Monday", "20", 0}},
+			daily: map[string]float64{"Monday": 2.0 / 24},
+		},
+		{
+			name:  "partial hours",
+			rows:  []SedeStatus{ev(true, at(0, 18, 30)), ev(false, at(0, 19, 15))},
+			start: at(0, 0, 0), end: at(1, 0, 0),
+			slots: []slot{{"Monday", "18", 0.5}, {"Monday", "19", 0.25}},
+		},
+		{
+			// Repeated "open" rows are not extra occupancy: only the time
+			// between the first open and the close counts.
+			name:  "duplicate open events",
+			rows:  []SedeStatus{ev(true, at(0, 18, 0)), ev(true, at(0, 18, 10)), ev(true, at(0, 18, 20)), ev(false, at(0, 18, 30))},
+			start: at(0, 0, 0), end: at(1, 0, 0),
+			slots: []slot{{"Monday", "18", 0.5}},
+		},
+		{
+			name:        "open when the window starts",
+			openAtStart: true,
+			rows:        []SedeStatus{ev(false, at(0, 10, 0))},
+			start:       at(0, 9, 0), end: at(0, 12, 0),
+			slots: []slot{{"Monday", "09", 1}, {"Monday", "10", 0}, {"Monday", "11", 0}},
+			daily: map[string]float64{"Monday": 1.0 / 3},
+		},
+		{
+			name:  "still open at the end",
+			rows:  []SedeStatus{ev(true, at(0, 20, 0))},
+			start: at(0, 0, 0), end: at(0, 21, 30),
+			slots: []slot{{"Monday", "20", 1}, {"Monday", "21", 1}},
+		},
+		{
+			name:  "open across midnight",
+			rows:  []SedeStatus{ev(true, at(0, 23, 0)), ev(false, at(1, 1, 0))},
+			start: at(0, 0, 0), end: at(2, 0, 0),
+			slots: []slot{{"Monday", "23", 1}, {"Tuesday", "00", 1}, {"Tuesday", "01", 0}},
+		},
+		{
+			// Same slot on two Mondays: open the first week only.
+			name:  "averaged over weeks",
+			rows:  []SedeStatus{ev(true, at(0, 18, 0)), ev(false, at(0, 19, 0))},
+			start: at(0, 0, 0), end: at(14, 0, 0),
+			slots: []slot{{"Monday", "18", 0.5}, {"Sunday", "18", 0}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := StatsWindow{Location: time.UTC, FromHour: 0, ToHour: 23}
+			stats := weeklyOccupancy(c.openAtStart, c.rows, c.start, c.end, w)
+			for _, s := range c.slots {
+				got, ok := hourOf(stats, s.day, s.hour)
+				if !ok || math.Abs(got-s.want) > 1e-9 {
+					t.Errorf("%s %s:00 = %v (present %v), want %v", s.day, s.hour, got, ok, s.want)
+				}
+			}
+			for day, want := range c.daily {
+				var got float64
+				for _, d := range stats {
+					if d.Day == day {
+						got = d.DailyProbability
+					}
+				}
+				if math.Abs(got-want) > 1e-9 {
+					t.Errorf("%s daily = %v, want %v", day, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWeeklyOccupancy_DSTHours(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := StatsWindow{Location: rome, FromHour: 0, ToHour: 23}
+
+	// 27 October 2024: the 02:00 hour happens twice. Open for the first one
+	// only (00:00-01:00 UTC), closed for the repeat (01:00-02:00 UTC).
+	start := time.Date(2024, 10, 26, 22, 0, 0, 0, time.UTC) // Sunday 00:00 CEST
+	rows := []SedeStatus{
+		{IsOpen: true, Timestamp: time.Date(2024, 10, 27, 0, 0, 0, 0, time.UTC)},
+		{IsOpen: false, Timestamp: time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC)},
+	}
+	end := time.Date(2024, 10, 27, 23, 0, 0, 0, time.UTC) // Monday 00:00 CET
+	stats := weeklyOccupancy(false, rows, start, end, w)
+	if p, _ := hourOf(stats, "Sunday", "02"); p != 0.5 {
+		t.Errorf("repeated 02:00 hour: got %v, want 0.5", p)
+	}
+	if len(stats) != 1 || math.Abs(stats[0].DailyProbability-1.0/25) > 1e-9 {
+		t.Errorf("a 25-hour Sunday open for one hour: %+v", stats)
+	}
+
+	// 31 March 2024: 02:00 does not exist; 03:00 follows 01:00.
+	start = time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC) // Sunday 00:00 CET
+	end = time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC)   // Monday 00:00 CEST
+	stats = weeklyOccupancy(true, nil, start, end, w)
+	if _, ok := hourOf(stats, "Sunday", "02"); ok {
+		t.Error("spring-forward day should have no 02:00 slot")
+	}
+	if p, _ := hourOf(stats, "Sunday", "03"); p != 1 {
+		t.Errorf("Sunday 03:00: got %v, want 1", p)
+	}
+}
+
+func TestWeeklyOccupancy_HalfHourOffset(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata") // UTC+5:30
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 12:30-13:30 UTC is exactly the local 18:00 hour.
+	rows := []SedeStatus{
+		{IsOpen: true, Timestamp: time.Date(2024, 5, 6, 12, 30, 0, 0, time.UTC)},
+		{IsOpen: false, Timestamp: time.Date(2024, 5, 6, 13, 30, 0, 0, time.UTC)},
+	}
+	start := time.Date(2024, 5, 5, 18, 30, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	stats := weeklyOccupancy(false, rows, start, end, StatsWindow{Location: kolkata, FromHour: 0, ToHour: 23})
+	if p, _ := hourOf(stats, "Monday", "18"); p != 1 {
+		t.Errorf("Monday 18:00: got %v, want 1", p)
+	}
+	if p, _ := hourOf(stats, "Monday", "17"); p != 0 {
+		t.Errorf("Monday 17:00: got %v, want 0", p)
+	}
+}
@@ -0,0 +1,6 @@
+-- Schema and data of a database created by the single-space releases,
+-- before spaces and space_id existed (GORM AutoMigrate on SQLite).
+CREATE TABLE `sede_statuses` (`id` integer PRIMARY KEY AUTOINCREMENT,`is_open` numeric NOT NULL,`timestamp` datetime NOT NULL);
+INSERT INTO `sede_statuses` (`is_open`,`timestamp`) VALUES (1,'2024-03-01 18:00:00+00:00');
+INSERT INTO `sede_statuses` (`is_open`,`timestamp`) VALUES (0,'2024-03-01 22:30:00+00:00');
+INSERT INTO `sede_statuses` (`is_open`,`timestamp`) VALUES (1,'2024-03-02 17:15:00+00:00');
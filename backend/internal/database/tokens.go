@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Token scopes.
+const (
+	ScopeStatusWrite  = "status:write"  // toggle the status
+	ScopeStatsRead    = "stats:read"    // export the status history
+	ScopeSensorsWrite = "sensors:write" // push sensor readings
+	ScopeAdmin        = "admin"         // the admin API; never tied to a space
+)
+
+// Scopes lists every scope a token can hold, in the order they are stored.
+var Scopes = []string{ScopeStatusWrite, ScopeStatsRead, ScopeSensorsWrite, ScopeAdmin}
+
+// APITokenPrefix starts every API token, so they can be told apart from
+// space and device keys without a lookup.
+const APITokenPrefix = "sede_"
+
+// APIToken is a named credential for integrations, limited to Scopes
+// (comma-separated) and, when SpaceID is set, to one space. Like device
+// keys, tokens are generated by us and only their SHA-256 is stored. A
+// token stops working when it is revoked (Active false) or past ExpiresAt;
+// nil never expires.
+type APIToken struct {
+	ID        uint   `gorm:"primarykey"`
+	Name      string `gorm:"not null"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	Scopes    string `gorm:"not null"`
+	SpaceID   *uint
+	ExpiresAt *time.Time
+	Active    bool `gorm:"not null;default:true"`
+	CreatedAt time.Time
+}
+
+// Allows reports whether t holds scope for spaceID. Tokens tied to a space
+// never hold the admin scope, which is checked with spaceID 0.
+func (t *APIToken) Allows(scope string, spaceID uint) bool {
+	if !slices.Contains(strings.Split(t.Scopes, ","), scope) {
+		return false
+	}
+	return t.SpaceID == nil || (spaceID != 0 && *t.SpaceID == spaceID)
+}
+
+// NormalizeScopes validates scopes and returns them deduplicated, in Scopes
+// order, ready for APIToken.Scopes.
+func NormalizeScopes(scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("at least one scope is required (%s)", strings.Join(Scopes, ", "))
+	}
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return "", fmt.Errorf("unknown scope %q (want %s)", s, strings.Join(Scopes, ", "))
+		}
+	}
+	var out []string
+	for _, s := range Scopes {
+		if slices.Contains(scopes, s) {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// NewAPIToken generates a random token; only its APITokenHash is stored, so
+// it must be handed out right away.
+func NewAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APITokenHash is the TokenHash stored for token.
+func APITokenHash(token string) string {
+	return sha256Hex(token)
+}
+
+// CreateAPIToken adds t, which must carry its TokenHash.
+func (r *Repository) CreateAPIToken(ctx context.Context, t *APIToken) error {
+	t.Active = true
+	return r.Db.WithContext(ctx).Create(t).Error
+}
+
+// AuthenticateAPIToken returns the token matching token if it is active
+// and not expired at now, or gorm.ErrRecordNotFound.
+func (r *Repository) AuthenticateAPIToken(ctx context.Context, token string, now time.Time) (*APIToken, error) {
+	var t APIToken
+	err := r.Db.WithContext(ctx).
+		Where("token_hash = ? AND active = ?", APITokenHash(token), true).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		First(&t).Error
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListAPITokens returns every token, revoked and expired ones included, in
+// creation order.
+func (r *Repository) ListAPITokens(ctx context.Context) ([]APIToken, error) {
+	var tokens []APIToken
+	err := r.Db.WithContext(ctx).Order("id asc").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken deactivates one token.
+func (r *Repository) RevokeAPIToken(ctx context.Context, id uint) error {
+	res := r.Db.WithContext(ctx).Model(&APIToken{}).Where("id = ?", id).Update("active", false)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestAuthenticateAPIToken_ExpiryAndRevocation(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	space := seedSpace(t, repo, "spaceA")
+	expires := now.Add(time.Hour)
+	ci := APIToken{Name: "ci", TokenHash: APITokenHash("sede_ci"), Scopes: "stats:read", SpaceID: &space, ExpiresAt: &expires}
+	ops := APIToken{Name: "ops", TokenHash: APITokenHash("sede_ops"), Scopes: "status:write,admin"}
+	for _, tok := range []*APIToken{&ci, &ops} {
+		if err := repo.CreateAPIToken(ctx, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tok, err := repo.AuthenticateAPIToken(ctx, "sede_ci", now)
+	if err != nil || tok.ID != ci.ID {
+		t.Fatalf("ci: %+v, %v", tok, err)
+	}
+	if _, err := repo.AuthenticateAPIToken(ctx, "sede_ci", now.Add(2*time.Hour)); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expired token accepted: %v", err)
+	}
+	if _, err := repo.AuthenticateAPIToken(ctx, "sede_nope", now); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("unknown token accepted: %v", err)
+	}
+
+	if err := repo.RevokeAPIToken(ctx, ops.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AuthenticateAPIToken(ctx, "sede_ops", now); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoked token accepted: %v", err)
+	}
+	if err := repo.RevokeAPIToken(ctx, 999); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("revoking a missing token: %v", err)
+	}
+
+	tokens, err := repo.ListAPITokens(ctx)
+	if err != nil || len(tokens) != 2 || tokens[1].Active {
+		t.Errorf("list: %+v, %v", tokens, err)
+	}
+}
+
+func TestAPIToken_Allows(t *testing.T) {
+	space := uint(1)
+	global := APIToken{Scopes: "status:write,admin"}
+	scoped := APIToken{Scopes: "status:write,admin", SpaceID: &space}
+
+	for _, tc := range []struct {
+		name    string
+		tok     APIToken
+		scope   string
+		spaceID uint
+		want    bool
+	}{
+		{"global, held scope", global, ScopeStatusWrite, 2, true},
+		{"global, missing scope", global, ScopeStatsRead, 1, false},
+		{"global admin", global, ScopeAdmin, 0, true},
+		{"scoped, own space", scoped, ScopeStatusWrite, 1, true},
+		{"scoped, other space", scoped, ScopeStatusWrite, 2, false},
+		{"scoped admin", scoped, ScopeAdmin, 0, false},
+	} {
+		if got := tc.tok.Allows(tc.scope, tc.spaceID); got != tc.want {
+			t.Errorf("%s: got %v", tc.name, got)
+		}
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := NormalizeScopes([]string{"admin", "stats:read", "admin"})
+	if err != nil || got != "stats:read,admin" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := NormalizeScopes(nil); err == nil {
+		t.Error("no scopes accepted")
+	}
+	if _, err := NormalizeScopes([]string{"status:read"}); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	a, err := NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewAPIToken()
+	if !strings.HasPrefix(a, APITokenPrefix) || a == b || len(a) < 40 {
+		t.Errorf("tokens %q, %q", a, b)
+	}
+}
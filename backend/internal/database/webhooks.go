@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookDelivery is one pending or finished POST of an event payload to a
+// space's webhook URL. Rows are written in the same transaction as the
+// status change and drained by the delivery worker, so an event is never
+// lost to a crash or a restart. DeliveredAt and FailedAt are both nil while the
+// delivery is still being retried.
+type WebhookDelivery struct {
+	ID            uint   `gorm:"primarykey"`
+	SpaceID       uint   `gorm:"not null;index"`
+	URL           string `gorm:"not null"`
+	Event         string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Attempts      int    `gorm:"not null;default:0"`
+	LastError     string
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	DeliveredAt   *time.Time
+	FailedAt      *time.Time
+	CreatedAt     time.Time
+}
+
+// WebhookDeliveries builds the deliveries announcing status once it has its
+// ID. It runs inside the transaction that inserts status; an error rolls
+// the status back.
+type WebhookDeliveries func(status *SedeStatus) ([]WebhookDelivery, error)
+
+// EnqueueWebhookDeliveries persists deliveries in a single batch. An empty
+// slice is a no-op.
+func (r *Repository) EnqueueWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.Db.WithContext(ctx).Create(&deliveries).Error
+}
+
+// DueWebhookDeliveries returns up to limit deliveries that are neither
+// delivered nor abandoned and whose next attempt is due at now, oldest first.
+func (r *Repository) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := r.Db.WithContext(ctx).
+		Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+		Order("next_attempt_at asc, id asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimWebhookDelivery reserves d, as returned by DueWebhookDeliveries, for
+// one attempt by pushing its next attempt to lease, and reports whether
+// this caller got it. Only one of the replicas polling the outbox wins a
+// delivery; if it dies before recording the outcome, the delivery is due
+// again at lease.
+func (r *Repository) ClaimWebhookDelivery(ctx context.Context, d WebhookDelivery, now, lease time.Time) (bool, error) {
+	res := r.Db.WithContext(ctx).
+		Model(&WebhookDelivery{}).
+		Where("id = ? AND attempts = ? AND delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", d.ID, d.Attempts, now).
+		Update("next_attempt_at", lease)
+	return res.RowsAffected > 0, res.Error
+}
+
+// MarkWebhookDelivered records a successful attempt.
+func (r *Repository) MarkWebhookDelivered(ctx context.Context, id uint, at time.Time) error {
+	return r.Db.WithContext(ctx).
+		Model(&WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"delivered_at": at,
+			"last_error":   "",
+		}).Error
+}
+
+// MarkWebhookRetry records a failed attempt and schedules the next one.
+func (r *Repository) MarkWebhookRetry(ctx context.Context, id uint, next time.Time, lastErr string) error {
+	return r.Db.WithContext(ctx).
+		Model(&WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": next,
+			"last_error":      lastErr,
+		}).Error
+}
+
+// MarkWebhookFailed abandons a delivery after its final failed attempt.
+func (r *Repository) MarkWebhookFailed(ctx context.Context, id uint, at time.Time, lastErr string) error {
+	return r.Db.WithContext(ctx).
+		Model(&WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"failed_at":  at,
+			"last_error": lastErr,
+		}).Error
+}
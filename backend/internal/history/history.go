@@ -0,0 +1,215 @@
+// Package history reads and writes status history in the portable formats
+// shared by `sede export`, `sede import` and GET /s/{slug}/history.csv, so
+// a file produced by any of them can be imported into another instance.
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Record is one status change. Space is the slug it was recorded under;
+// Source, ClientIP and CardHash carry the attribution kept for the admin
+// view and are empty for changes recorded without one.
+type Record struct {
+	Space     string    `json:"space"`
+	Timestamp time.Time `json:"timestamp"`
+	Open      bool      `json:"open"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	CardHash  string    `json:"card_hash,omitempty"`
+}
+
+var csvHeader = []string{"space", "timestamp", "open", "reason", "actor", "source", "client_ip", "card_hash"}
+
+// FormatFor returns format if set, otherwise the format implied by path's
+// extension, defaulting to CSV.
+func FormatFor(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			format = FormatJSONL
+		default:
+			format = FormatCSV
+		}
+	}
+	if format != FormatCSV && format != FormatJSONL {
+		return "", fmt.Errorf("unknown history format %q (want csv or jsonl)", format)
+	}
+	return format, nil
+}
+
+// Writer encodes records.
+type Writer interface {
+	Write(Record) error
+	// Flush writes any buffered data and reports earlier write errors.
+	Flush() error
+}
+
+// NewWriter returns a Writer for format; CSV output starts with a header.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return csvWriter{cw}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return jsonlWriter{bw, json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf("unknown history format %q", format)
+}
+
+type csvWriter struct{ w *csv.Writer }
+
+func (c csvWriter) Write(r Record) error {
+	return c.w.Write([]string{
+		r.Space,
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.FormatBool(r.Open),
+		escapeCell(r.Reason),
+		escapeCell(r.Actor),
+		escapeCell(r.Source),
+		escapeCell(r.ClientIP),
+		escapeCell(r.CardHash),
+	})
+}
+
+func (c csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j jsonlWriter) Write(r Record) error {
+	r.Timestamp = r.Timestamp.UTC()
+	return j.enc.Encode(r)
+}
+
+func (j jsonlWriter) Flush() error { return j.w.Flush() }
+
+// Reader decodes records; Read returns io.EOF after the last one.
+type Reader interface {
+	Read() (Record, error)
+}
+
+// NewReader returns a Reader for format. CSV input must start with the
+// header written by NewWriter; columns may come in any order, and all but
+// space, timestamp and open may be missing.
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read header: %w", err)
+		}
+		cols := map[string]int{}
+		for i, name := range header {
+			cols[strings.TrimSpace(name)] = i
+		}
+		for _, name := range csvHeader[:3] {
+			if _, ok := cols[name]; !ok {
+				return nil, fmt.Errorf("missing %q column", name)
+			}
+		}
+		return &csvReader{r: cr, cols: cols}, nil
+	case FormatJSONL:
+		return &jsonlReader{dec: json.NewDecoder(r)}, nil
+	}
+	return nil, fmt.Errorf("unknown history format %q", format)
+}
+
+type csvReader struct {
+	r    *csv.Reader
+	cols map[string]int
+}
+
+func (c *csvReader) Read() (Record, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	line, _ := c.r.FieldPos(0)
+	cell := func(name string) string {
+		if i, ok := c.cols[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	rec := Record{
+		Space:    cell("space"),
+		Reason:   unescapeCell(cell("reason")),
+		Actor:    unescapeCell(cell("actor")),
+		Source:   unescapeCell(cell("source")),
+		ClientIP: unescapeCell(cell("client_ip")),
+		CardHash: unescapeCell(cell("card_hash")),
+	}
+	if rec.Timestamp, err = time.Parse(time.RFC3339Nano, cell("timestamp")); err != nil {
+		return Record{}, fmt.Errorf("line %d: invalid timestamp: %w", line, err)
+	}
+	if rec.Open, err = strconv.ParseBool(cell("open")); err != nil {
+		return Record{}, fmt.Errorf("line %d: invalid open: %w", line, err)
+	}
+	return rec, nil
+}
+
+type jsonlReader struct {
+	dec  *json.Decoder
+	line int
+}
+
+func (j *jsonlReader) Read() (Record, error) {
+	var rec Record
+	j.line++
+	if err := j.dec.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return Record{}, err
+		}
+		return Record{}, fmt.Errorf("record %d: %w", j.line, err)
+	}
+	if rec.Timestamp.IsZero() {
+		return Record{}, fmt.Errorf("record %d: missing timestamp", j.line)
+	}
+	return rec, nil
+}
+
+// escapeCell stops spreadsheet apps from evaluating text that starts like
+// a formula by prefixing a quote; values already starting with a quote get
+// one too, so unescapeCell can always strip exactly one.
+func escapeCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r'", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func unescapeCell(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@\t\r'", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
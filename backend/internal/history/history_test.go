@@ -0,0 +1,136 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func roundtrip(t *testing.T, format string, in []Record) []Record {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range in {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []Record
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	rome, _ := time.LoadLocation("Europe/Rome")
+	in := []Record{
+		{Space: "pescara", Timestamp: time.Date(2024, 5, 1, 18, 0, 0, 123456789, time.UTC), Open: true, Actor: "Alice", Source: "button", ClientIP: "2001:db8::1", CardHash: "9f86d081884c7d65"},
+		{Space: "pescara", Timestamp: time.Date(2024, 5, 1, 23, 30, 0, 0, rome), Open: false, Reason: "gelatino, \"subito\""},
+		{Space: "aquila", Timestamp: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC), Open: true, Actor: "=HYPERLINK()"},
+		{Space: "aquila", Timestamp: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), Reason: "'quoted"},
+	}
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			out := roundtrip(t, format, in)
+			if len(out) != len(in) {
+				t.Fatalf("got %d records, want %d", len(out), len(in))
+			}
+			for i := range in {
+				want := in[i]
+				want.Timestamp = want.Timestamp.UTC()
+				if !reflect.DeepEqual(out[i], want) {
+					t.Errorf("record %d = %+v, want %+v", i, out[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatCSV)
+	w.Write(Record{Space: "pescara", Timestamp: time.Unix(0, 0), Actor: "=cmd()"})
+	w.Flush()
+	if !strings.Contains(buf.String(), ",'=cmd()") {
+		t.Errorf("formula not escaped:\n%s", buf.String())
+	}
+}
+
+func TestCSVReader_ColumnOrderAndOptionalColumns(t *testing.T) {
+	r, err := NewReader(strings.NewReader("open,timestamp,space\ntrue,2024-05-01T18:00:00Z,pescara\n"), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Record{Space: "pescara", Timestamp: time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC), Open: true}
+	if !reflect.DeepEqual(rec, want) {
+		t.Errorf("got %+v, want %+v", rec, want)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name, format, input string
+	}{
+		{"missing column", FormatCSV, "space,timestamp\npescara,2024-05-01T18:00:00Z\n"},
+		{"bad timestamp", FormatCSV, "space,timestamp,open\npescara,yesterday,true\n"},
+		{"bad open", FormatCSV, "space,timestamp,open\npescara,2024-05-01T18:00:00Z,maybe\n"},
+		{"bad json", FormatJSONL, "{\"space\": \n"},
+		{"no timestamp", FormatJSONL, "{\"space\": \"pescara\", \"open\": true}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tt.input), tt.format)
+			if err == nil {
+				_, err = r.Read()
+			}
+			if err == nil || errors.Is(err, io.EOF) {
+				t.Errorf("expected an error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatFor(t *testing.T) {
+	tests := []struct {
+		format, path, want string
+		wantErr            bool
+	}{
+		{"", "out.csv", FormatCSV, false},
+		{"", "out.jsonl", FormatJSONL, false},
+		{"", "", FormatCSV, false},
+		{"jsonl", "out.csv", FormatJSONL, false},
+		{"xml", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := FormatFor(tt.format, tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("FormatFor(%q, %q) = %q, %v", tt.format, tt.path, got, err)
+		}
+	}
+}
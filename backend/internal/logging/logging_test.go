@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_JSONWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.DebugContext(context.Background(), "hidden")
+	logger.With("space", "pescara").InfoContext(WithRequestID(context.Background(), "abc123"), "toggled", "open", true)
+	logger.Info("no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 records, got %d:\n%s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "toggled" || rec["request_id"] != "abc123" || rec["space"] != "pescara" || rec["open"] != true {
+		t.Errorf("record: %v", rec)
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("record without request context: %s", lines[1])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if got, err := ParseLevel(in); err != nil || got != want {
+			t.Errorf("%s: got %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("verbose should be rejected")
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"":                      false,
+		"3f2a-b_c.d":            true,
+		"with space":            false,
+		"evil\n{\"level\":1}":   false,
+		strings.Repeat("a", 65): false,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("%q: got %v", id, got)
+		}
+	}
+	if id := NewRequestID(); len(id) != 32 || !ValidRequestID(id) {
+		t.Errorf("generated id %q", id)
+	}
+}
@@ -0,0 +1,50 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// discordNotifier posts to a Discord channel webhook. The webhook URL embeds
+// its own secret, so it is the only setting.
+type discordNotifier struct {
+	client     *http.Client
+	webhookURL string
+	username   string
+}
+
+func newDiscordFactory(client *http.Client) Factory {
+	return func(s Settings) (Notifier, error) {
+		hook, err := s.Required("webhook_url")
+		if err != nil {
+			return nil, err
+		}
+		if u, err := url.Parse(hook); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("webhook_url must be an absolute URL")
+		}
+		return &discordNotifier{client: client, webhookURL: hook, username: s["username"]}, nil
+	}
+}
+
+func (d *discordNotifier) Type() string { return "discord" }
+
+func (d *discordNotifier) Notify(ctx context.Context, ev Event) error {
+	payload := map[string]string{"content": Message(ev)}
+	if d.username != "" {
+		payload["username"] = d.username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, d.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(ctx, d.client, req)
+}
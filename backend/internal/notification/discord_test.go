@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscordNotifier_PostsContent(t *testing.T) {
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/webhooks/1/tok" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n, err := NewRegistry(&Dispatcher{}).Build("discord", Settings{
+		"webhook_url": srv.URL + "/api/webhooks/1/tok",
+		"username":    "Sede",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := n.Notify(context.Background(), Event{Open: false, Reason: "gelatino"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if gotBody["content"] != "🍦 sede chiusa per gelatino" || gotBody["username"] != "Sede" {
+		t.Errorf("body %+v", gotBody)
+	}
+}
+
+func TestDiscordNotifier_RateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	n, _ := NewRegistry(&Dispatcher{}).Build("discord", Settings{"webhook_url": srv.URL})
+	if err := n.Notify(context.Background(), Event{}); err == nil {
+		t.Error("expected error on 429")
+	}
+}
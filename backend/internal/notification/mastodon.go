@@ -0,0 +1,67 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mastodonNotifier publishes a status on a Mastodon (or API-compatible)
+// instance with an application access token.
+type mastodonNotifier struct {
+	client     *http.Client
+	instance   string
+	token      string
+	visibility string
+}
+
+var mastodonVisibilities = map[string]bool{"public": true, "unlisted": true, "private": true, "direct": true}
+
+func newMastodonFactory(client *http.Client) Factory {
+	return func(s Settings) (Notifier, error) {
+		instance, err := s.Required("instance")
+		if err != nil {
+			return nil, err
+		}
+		if u, err := url.Parse(instance); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("instance %q must be an absolute URL", instance)
+		}
+		token, err := s.Required("access_token")
+		if err != nil {
+			return nil, err
+		}
+		visibility := s["visibility"]
+		if visibility == "" {
+			visibility = "unlisted"
+		}
+		if !mastodonVisibilities[visibility] {
+			return nil, fmt.Errorf("visibility %q is not one of public, unlisted, private, direct", visibility)
+		}
+		return &mastodonNotifier{
+			client:     client,
+			instance:   strings.TrimRight(instance, "/"),
+			token:      token,
+			visibility: visibility,
+		}, nil
+	}
+}
+
+func (m *mastodonNotifier) Type() string { return "mastodon" }
+
+func (m *mastodonNotifier) Notify(ctx context.Context, ev Event) error {
+	form := url.Values{}
+	form.Set("status", Message(ev))
+	form.Set("visibility", m.visibility)
+
+	req, err := http.NewRequest(http.MethodPost, m.instance+"/api/v1/statuses", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	// Same event, same key: a retried request never double-posts.
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("sede-%s-%d", ev.Slug, ev.Timestamp.UnixNano()))
+	return doRequest(ctx, m.client, req)
+}
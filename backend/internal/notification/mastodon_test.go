@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMastodonNotifier_PostsStatus(t *testing.T) {
+	var gotAuth, gotStatus, gotVisibility, gotIdem string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/statuses" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		gotIdem = r.Header.Get("Idempotency-Key")
+		gotStatus = r.PostForm.Get("status")
+		gotVisibility = r.PostForm.Get("visibility")
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+
+	n, err := NewRegistry(&Dispatcher{}).Build("mastodon", Settings{
+		"instance":     srv.URL,
+		"access_token": "masto-token",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ev := Event{Slug: "pescara", Open: true, Timestamp: time.Unix(1700000000, 0)}
+	if err := n.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if gotAuth != "Bearer masto-token" {
+		t.Errorf("auth %q", gotAuth)
+	}
+	if gotStatus != "🟢 sede aperta" {
+		t.Errorf("status %q", gotStatus)
+	}
+	if gotVisibility != "unlisted" {
+		t.Errorf("default visibility %q", gotVisibility)
+	}
+	if gotIdem == "" {
+		t.Error("missing Idempotency-Key")
+	}
+}
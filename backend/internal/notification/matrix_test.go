@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatrixNotifier_SendsRoomMessage(t *testing.T) {
+	var gotMethod, gotPath, gotAuth string
+	var gotBody map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.EscapedPath(), r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(`{"event_id":"$abc"}`))
+	}))
+	defer srv.Close()
+
+	n, err := NewRegistry(&Dispatcher{}).Build("matrix", Settings{
+		"homeserver":   srv.URL + "/",
+		"room_id":      "!sede:matrix.example",
+		"access_token": "syt_token",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := n.Notify(context.Background(), Event{Open: true, By: "Mario"}); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if gotMethod != http.MethodPut {
+		t.Errorf("method %s", gotMethod)
+	}
+	if !strings.HasPrefix(gotPath, "/_matrix/client/v3/rooms/%21sede:matrix.example/send/m.room.message/") {
+		t.Errorf("path %s", gotPath)
+	}
+	if gotAuth != "Bearer syt_token" {
+		t.Errorf("auth %q", gotAuth)
+	}
+	if gotBody["msgtype"] != "m.text" || gotBody["body"] != "🟢 sede aperta da Mario" {
+		t.Errorf("body %+v", gotBody)
+	}
+}
+
+func TestMatrixNotifier_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errcode":"M_FORBIDDEN"}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	n, _ := NewRegistry(&Dispatcher{}).Build("matrix", Settings{
+		"homeserver": srv.URL, "room_id": "!r:m", "access_token": "t",
+	})
+	err := n.Notify(context.Background(), Event{})
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "M_FORBIDDEN") {
+		t.Errorf("expected 403 error with body, got %v", err)
+	}
+}
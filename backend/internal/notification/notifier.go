@@ -0,0 +1,71 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// reasonGelatino and reasonAuto mirror the app-level tags for the "chiusa per
+// gelatino" closure and the scheduled auto-close; they change how the
+// message is worded.
+const (
+	reasonGelatino = "gelatino"
+	reasonAuto     = "auto"
+)
+
+// Event is a status change to announce. Space is the human-readable space
+// name; By is the display name resolved from the toggling card, if any.
+//
+// An event with Device set is a device alert instead: the named device
+// stopped sending heartbeats (Offline) or started again. Open, Reason and
+// By are unused then.
+type Event struct {
+	Slug      string
+	Space     string
+	Open      bool
+	Reason    string
+	By        string
+	Device    string
+	Offline   bool
+	Timestamp time.Time
+}
+
+// Notifier delivers an Event to one external channel. Implementations must
+// be safe for concurrent use and honour ctx for cancellation.
+type Notifier interface {
+	// Type returns the backend name as written in spaces.yaml.
+	Type() string
+	Notify(ctx context.Context, ev Event) error
+}
+
+// Message renders the Italian one-liner every text backend posts, e.g.
+// "🟢 sede aperta da Mario" or "🍦 sede chiusa per gelatino".
+func Message(ev Event) string {
+	if ev.Device != "" {
+		if ev.Offline {
+			return fmt.Sprintf("⚠️ dispositivo %s offline", ev.Device)
+		}
+		return fmt.Sprintf("✅ dispositivo %s di nuovo online", ev.Device)
+	}
+
+	emoji := "🟢"
+	action := "aperta"
+	if !ev.Open {
+		emoji = "🔴"
+		action = "chiusa"
+	}
+	switch ev.Reason {
+	case reasonGelatino:
+		emoji = "🍦"
+		action = "chiusa per gelatino"
+	case reasonAuto:
+		emoji = "🌙"
+		action = "chiusa automaticamente"
+	}
+
+	if ev.By != "" {
+		return fmt.Sprintf("%s sede %s da %s", emoji, action, ev.By)
+	}
+	return fmt.Sprintf("%s sede %s", emoji, action)
+}
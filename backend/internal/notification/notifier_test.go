@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   Event
+		want string
+	}{
+		{"open anonymous", Event{Open: true}, "🟢 sede aperta"},
+		{"open by card", Event{Open: true, By: "Mario"}, "🟢 sede aperta da Mario"},
+		{"closed", Event{Open: false}, "🔴 sede chiusa"},
+		{"closed by card", Event{Open: false, By: "Luigi"}, "🔴 sede chiusa da Luigi"},
+		{"gelatino", Event{Open: false, Reason: "gelatino"}, "🍦 sede chiusa per gelatino"},
+		{"gelatino by card", Event{Open: false, Reason: "gelatino", By: "Mario"}, "🍦 sede chiusa per gelatino da Mario"},
+		{"auto close", Event{Open: false, Reason: "auto"}, "🌙 sede chiusa automaticamente"},
+		{"device offline", Event{Device: "pulsante", Offline: true}, "⚠️ dispositivo pulsante offline"},
+		{"device back", Event{Device: "pulsante", Open: true, By: "Mario"}, "✅ dispositivo pulsante di nuovo online"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Message(c.ev); got != c.want {
+				t.Errorf("Message = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_BuiltinsAndUnknownType(t *testing.T) {
+	r := NewRegistry(&Dispatcher{})
+	want := []string{"discord", "mastodon", "matrix", "smtp", "telegram"}
+	if got := r.Types(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Types = %v, want %v", got, want)
+	}
+
+	_, err := r.Build("carrier-pigeon", Settings{})
+	if err == nil || !strings.Contains(err.Error(), `unknown notifier type "carrier-pigeon"`) {
+		t.Errorf("expected unknown type error, got %v", err)
+	}
+}
+
+type recordingNotifier struct{ got []Event }
+
+func (r *recordingNotifier) Type() string { return "recording" }
+func (r *recordingNotifier) Notify(_ context.Context, ev Event) error {
+	r.got = append(r.got, ev)
+	return nil
+}
+
+func TestRegistry_RegisterCustomBackend(t *testing.T) {
+	r := NewRegistry(&Dispatcher{})
+	rec := &recordingNotifier{}
+	r.Register("recording", func(Settings) (Notifier, error) { return rec, nil })
+
+	n, err := r.Build("recording", nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if err := n.Notify(context.Background(), Event{Open: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.got) != 1 {
+		t.Errorf("custom backend not invoked: %+v", rec.got)
+	}
+}
+
+func TestRegistry_InvalidSettingsFailAtBuild(t *testing.T) {
+	r := NewRegistry(&Dispatcher{})
+	cases := []struct {
+		typ  string
+		s    Settings
+		want string
+	}{
+		{"telegram", Settings{}, "chat_id is required"},
+		{"telegram", Settings{"chat_id": "abc"}, "not an integer"},
+		{"matrix", Settings{"homeserver": "https://m.example", "room_id": "!r:m"}, "access_token is required"},
+		{"matrix", Settings{"homeserver": "m.example", "room_id": "!r:m", "access_token": "t"}, "absolute URL"},
+		{"discord", Settings{}, "webhook_url is required"},
+		{"mastodon", Settings{"instance": "https://x.social", "access_token": "t", "visibility": "loud"}, "visibility"},
+		{"smtp", Settings{"host": "mail", "from": "sede@example.org"}, "to is required"},
+		{"smtp", Settings{"host": "mail", "from": "not an address", "to": "a@example.org"}, "from"},
+	}
+	for _, c := range cases {
+		t.Run(c.typ+"/"+c.want, func(t *testing.T) {
+			_, err := r.Build(c.typ, c.s)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("expected error containing %q, got %v", c.want, err)
+			}
+		})
+	}
+}
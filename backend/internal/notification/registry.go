@@ -0,0 +1,32 @@
+package notification
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/registry"
+)
+
+const httpTimeout = 10 * time.Second
+
+// Settings is the configuration of one notifier entry in spaces.yaml.
+type Settings = registry.Settings
+
+// Factory builds a Notifier from its settings.
+type Factory = registry.Factory[Notifier]
+
+// Registry maps notifier type names to factories.
+type Registry = registry.Registry[Notifier]
+
+// NewRegistry returns a registry with every built-in backend registered.
+// The Telegram backend shares d, so all spaces reuse one bot client.
+func NewRegistry(d *Dispatcher) *Registry {
+	client := &http.Client{Timeout: httpTimeout}
+	r := registry.New[Notifier]("notifier")
+	r.Register("telegram", newTelegramFactory(d))
+	r.Register("matrix", newMatrixFactory(client))
+	r.Register("discord", newDiscordFactory(client))
+	r.Register("mastodon", newMastodonFactory(client))
+	r.Register("smtp", newSMTPFactory())
+	return r
+}
@@ -0,0 +1,117 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpNotifier mails the status message to a fixed list of recipients.
+// net/smtp upgrades to STARTTLS whenever the server offers it; PLAIN auth is
+// only attempted over TLS or to localhost.
+type smtpNotifier struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+	subject  string
+	send     func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func newSMTPFactory() Factory {
+	return func(s Settings) (Notifier, error) {
+		host, err := s.Required("host")
+		if err != nil {
+			return nil, err
+		}
+		port, err := s.Int("port", 587)
+		if err != nil {
+			return nil, err
+		}
+		from, err := s.Required("from")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := mail.ParseAddress(from); err != nil {
+			return nil, fmt.Errorf("from %q: %w", from, err)
+		}
+		rawTo, err := s.Required("to")
+		if err != nil {
+			return nil, err
+		}
+		var to []string
+		for _, addr := range strings.Split(rawTo, ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return nil, fmt.Errorf("to %q: %w", addr, err)
+			}
+			to = append(to, addr)
+		}
+		if len(to) == 0 {
+			return nil, fmt.Errorf("to is required")
+		}
+		return &smtpNotifier{
+			addr:     net.JoinHostPort(host, strconv.FormatInt(port, 10)),
+			host:     host,
+			username: s["username"],
+			password: s["password"],
+			from:     from,
+			to:       to,
+			subject:  s["subject"],
+			send:     smtp.SendMail,
+		}, nil
+	}
+}
+
+func (n *smtpNotifier) Type() string { return "smtp" }
+
+// Notify runs the blocking SMTP exchange in a goroutine so ctx can still cut
+// it short; the exchange itself finishes in the background.
+func (n *smtpNotifier) Notify(ctx context.Context, ev Event) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	subject := n.subject
+	if subject == "" {
+		subject = "Sede " + ev.Space
+	}
+	ts := ev.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ts.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(Message(ev))
+	msg.WriteString("\r\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- n.send(n.addr, auth, n.from, n.to, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts a single unauthenticated session on a loopback port and
+// sends the received envelope and DATA on the returned channel.
+type smtpSession struct {
+	from string
+	to   []string
+	data string
+}
+
+func fakeSMTP(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 fake")
+			case "MAIL":
+				s.from = line
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				s.to = append(s.to, line)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(b)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				out <- s
+				return
+			default:
+				tp.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestSMTPNotifier_SendsMail(t *testing.T) {
+	addr, sessions := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	n, err := NewRegistry(&Dispatcher{}).Build("smtp", Settings{
+		"host": host,
+		"port": port,
+		"from": "sede@example.org",
+		"to":   "board@example.org, soci@example.org",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	ev := Event{Space: "Metro Olografix Pescara", Open: false, By: "Mario", Timestamp: time.Unix(1700000000, 0)}
+	if err := n.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var s smtpSession
+	select {
+	case s = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server got no session")
+	}
+	if !strings.Contains(s.from, "<sede@example.org>") {
+		t.Errorf("MAIL FROM %q", s.from)
+	}
+	if len(s.to) != 2 || !strings.Contains(s.to[1], "<soci@example.org>") {
+		t.Errorf("RCPT TO %v", s.to)
+	}
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(s.data)))
+	hdr, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("parse headers: %v", err)
+	}
+	if !strings.Contains(hdr.Get("Subject"), "Sede") {
+		t.Errorf("subject %q", hdr.Get("Subject"))
+	}
+	if !strings.Contains(s.data, "🔴 sede chiusa da Mario") {
+		t.Errorf("body %q", s.data)
+	}
+}
+
+func TestSMTPNotifier_HonoursContext(t *testing.T) {
+	n, _ := NewRegistry(&Dispatcher{}).Build("smtp", Settings{
+		"host": "127.0.0.1", "from": "a@example.org", "to": "b@example.org",
+	})
+	block := make(chan struct{})
+	defer close(block)
+	n.(*smtpNotifier).send = func(string, smtp.Auth, string, []string, []byte) error {
+		<-block
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := n.Notify(ctx, Event{}); err != context.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
@@ -37,14 +37,52 @@ func (d *Dispatcher) IsInitialized() bool {
 // Telegram target" and returns nil — lets spaces without Telegram config
 // go through the toggle flow cleanly.
 func (d *Dispatcher) Send(chatID int64, threadID int, msg string) error {
+	return d.SendContext(context.TODO(), chatID, threadID, msg)
+}
+
+// SendContext is Send bound to ctx.
+func (d *Dispatcher) SendContext(ctx context.Context, chatID int64, threadID int, msg string) error {
 	if !d.IsInitialized() || chatID == 0 {
 		return nil
 	}
 
-	_, err := d.client.SendMessage(context.TODO(), &bot.SendMessageParams{
+	_, err := d.client.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:          chatID,
 		Text:            msg,
 		MessageThreadID: threadID,
 	})
 	return err
 }
+
+// telegramNotifier is one chat/thread target on the shared Dispatcher.
+type telegramNotifier struct {
+	d        *Dispatcher
+	chatID   int64
+	threadID int
+}
+
+func newTelegramFactory(d *Dispatcher) Factory {
+	return func(s Settings) (Notifier, error) {
+		chatID, err := s.Int("chat_id", 0)
+		if err != nil {
+			return nil, err
+		}
+		if chatID == 0 {
+			return nil, fmt.Errorf("chat_id is required")
+		}
+		threadID, err := s.Int("thread_id", 0)
+		if err != nil {
+			return nil, err
+		}
+		return &telegramNotifier{d: d, chatID: chatID, threadID: int(threadID)}, nil
+	}
+}
+
+func (t *telegramNotifier) Type() string { return "telegram" }
+
+// Notify is a no-op when the bot token is not configured, matching
+// Dispatcher.Send, so a space can keep its telegram block while the
+// instance runs without a bot.
+func (t *telegramNotifier) Notify(ctx context.Context, ev Event) error {
+	return t.d.SendContext(ctx, t.chatID, t.threadID, Message(ev))
+}
@@ -1,6 +1,7 @@
 package notification
 
 import (
+	"context"
 	"testing"
 )
 
@@ -42,3 +43,17 @@ func TestDispatcher_Send_NoOpWhenChatIDZero(t *testing.T) {
 		t.Errorf("expected nil error when chatID is 0, got %v", err)
 	}
 }
+
+func TestTelegramNotifier_NoOpWithoutBot(t *testing.T) {
+	n, err := NewRegistry(&Dispatcher{}).Build("telegram", Settings{"chat_id": "-100123", "thread_id": "4"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	tn := n.(*telegramNotifier)
+	if tn.chatID != -100123 || tn.threadID != 4 {
+		t.Errorf("settings not parsed: %+v", tn)
+	}
+	if err := n.Notify(context.Background(), Event{Open: true}); err != nil {
+		t.Errorf("expected no-op without bot token, got %v", err)
+	}
+}
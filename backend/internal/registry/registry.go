@@ -0,0 +1,110 @@
+// Package registry holds what the pluggable per-space backends have in
+// common: the flat settings of their spaces.yaml block and a registry
+// mapping type names to the factories that build them. The notification
+// and cards packages instantiate it for notifiers and card resolvers.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Settings is the flat key/value configuration of one backend entry in
+// spaces.yaml, with $ENV_VAR references already resolved.
+type Settings map[string]string
+
+// Required returns the value of key or an error naming the missing key.
+func (s Settings) Required(key string) (string, error) {
+	v := s[key]
+	if v == "" {
+		return "", fmt.Errorf("%s is required", key)
+	}
+	return v, nil
+}
+
+// Int parses key as an integer, returning def when the key is absent.
+func (s Settings) Int(key string, def int64) (int64, error) {
+	v := s[key]
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an integer", key, v)
+	}
+	return n, nil
+}
+
+// Duration parses key as a Go duration, returning def when it is absent.
+func (s Settings) Duration(key string, def time.Duration) (time.Duration, error) {
+	v := s[key]
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: %q is not a valid duration", key, v)
+	}
+	return d, nil
+}
+
+// Factory builds a backend from its settings, validating them up front so
+// a typo in spaces.yaml fails at load time rather than on first use.
+type Factory[T any] func(Settings) (T, error)
+
+// Registry maps backend type names to factories. The zero value is not
+// usable; build one with New.
+type Registry[T any] struct {
+	kind      string
+	mu        sync.RWMutex
+	factories map[string]Factory[T]
+}
+
+// New returns an empty registry for backends of kind, the name used in
+// errors (e.g. "notifier").
+func New[T any](kind string) *Registry[T] {
+	return &Registry[T]{kind: kind, factories: make(map[string]Factory[T])}
+}
+
+// Register adds or replaces the factory for typ.
+func (r *Registry[T]) Register(typ string, f Factory[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[typ] = f
+}
+
+// Build instantiates a backend of type typ.
+func (r *Registry[T]) Build(typ string, s Settings) (T, error) {
+	r.mu.RLock()
+	f, ok := r.factories[typ]
+	r.mu.RUnlock()
+	var zero T
+	if !ok {
+		return zero, fmt.Errorf("unknown %s type %q (known: %v)", r.kind, typ, r.Types())
+	}
+	b, err := f(s)
+	if err != nil {
+		return zero, r.Wrap(typ, err)
+	}
+	return b, nil
+}
+
+// Wrap prefixes err with the backend it is about, e.g. "smtp notifier".
+func (r *Registry[T]) Wrap(typ string, err error) error {
+	return fmt.Errorf("%s %s: %w", typ, r.kind, err)
+}
+
+// Types lists the registered backend names, sorted.
+func (r *Registry[T]) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.factories))
+	for t := range r.factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	s := Settings{"token": "t", "port": "587", "bad_port": "x", "timeout": "2s", "negative": "-1s"}
+
+	if v, err := s.Required("token"); err != nil || v != "t" {
+		t.Errorf("Required(token) = %q, %v", v, err)
+	}
+	if _, err := s.Required("url"); err == nil || err.Error() != "url is required" {
+		t.Errorf("Required(url) error = %v", err)
+	}
+
+	if n, err := s.Int("port", 25); err != nil || n != 587 {
+		t.Errorf("Int(port) = %d, %v", n, err)
+	}
+	if n, err := s.Int("missing", 25); err != nil || n != 25 {
+		t.Errorf("Int(missing) = %d, %v", n, err)
+	}
+	if _, err := s.Int("bad_port", 25); err == nil {
+		t.Error("Int(bad_port): expected an error")
+	}
+
+	if d, err := s.Duration("timeout", time.Second); err != nil || d != 2*time.Second {
+		t.Errorf("Duration(timeout) = %v, %v", d, err)
+	}
+	if d, err := s.Duration("missing", time.Second); err != nil || d != time.Second {
+		t.Errorf("Duration(missing) = %v, %v", d, err)
+	}
+	if _, err := s.Duration("negative", time.Second); err == nil {
+		t.Error("Duration(negative): expected an error")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := New[string]("greeter")
+	r.Register("hello", func(s Settings) (string, error) {
+		name, err := s.Required("name")
+		return "hello " + name, err
+	})
+	r.Register("bye", func(Settings) (string, error) { return "bye", nil })
+
+	if got := r.Types(); strings.Join(got, ",") != "bye,hello" {
+		t.Errorf("Types = %v", got)
+	}
+	if v, err := r.Build("hello", Settings{"name": "Mario"}); err != nil || v != "hello Mario" {
+		t.Errorf("Build = %q, %v", v, err)
+	}
+
+	_, err := r.Build("hello", Settings{})
+	if err == nil || err.Error() != "hello greeter: name is required" {
+		t.Errorf("invalid settings error = %v", err)
+	}
+	_, err = r.Build("wave", nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown greeter type "wave" (known: [bye hello])`) {
+		t.Errorf("unknown type error = %v", err)
+	}
+
+	cause := errors.New("boom")
+	if err := r.Wrap("bye", cause); !errors.Is(err, cause) || err.Error() != "bye greeter: boom" {
+		t.Errorf("Wrap = %v", err)
+	}
+}
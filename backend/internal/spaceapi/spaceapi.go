@@ -0,0 +1,50 @@
+// Package spaceapi validates SpaceAPI documents against the official v15 JSON
+// schema, vendored under schema/ so validation works offline and cannot
+// drift with upstream edits between releases.
+package spaceapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaURL is the $id of the vendored schema.
+const SchemaURL = "https://schema.spaceapi.io/15.json"
+
+//go:embed schema/15.json
+var schemaV15 []byte
+
+var compiled = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft7
+	if err := c.AddResource(SchemaURL, bytes.NewReader(schemaV15)); err != nil {
+		return nil, err
+	}
+	return c.Compile(SchemaURL)
+})
+
+// Validate checks that doc, once marshalled to JSON, is a valid SpaceAPI v15
+// document. doc can be any value encoding/json accepts.
+func Validate(doc any) error {
+	sch, err := compiled()
+	if err != nil {
+		return fmt.Errorf("compile spaceapi schema: %w", err)
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("encode spaceapi document: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("decode spaceapi document: %w", err)
+	}
+	if err := sch.Validate(v); err != nil {
+		return fmt.Errorf("spaceapi v15: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package spaceapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const minimalDoc = `{
+	"api_compatibility": ["15"],
+	"space": "Metro Olografix",
+	"logo": "https://olografix.org/logo.png",
+	"url": "https://olografix.org",
+	"location": {"lat": 42.45, "lon": 14.22, "timezone": "Europe/Rome"},
+	"contact": {"email": "info@olografix.org"}
+}`
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestValidate_Minimal(t *testing.T) {
+	if err := Validate(decode(t, minimalDoc)); err != nil {
+		t.Fatalf("minimal document rejected: %v", err)
+	}
+}
+
+func TestValidate_FullDocument(t *testing.T) {
+	doc := decode(t, minimalDoc)
+	doc["state"] = map[string]any{
+		"open": true, "lastchange": 1700000000, "message": "aperti",
+		"icon": map[string]any{"open": "https://x/open.png", "closed": "https://x/closed.png"},
+	}
+	doc["spacefed"] = map[string]any{"spacenet": false, "spacesaml": false}
+	doc["feeds"] = map[string]any{"calendar": map[string]any{"type": "ical", "url": "https://x/cal.ics"}}
+	doc["sensors"] = map[string]any{
+		"temperature":        []any{map[string]any{"value": 21.5, "unit": "°C", "location": "sala"}},
+		"people_now_present": []any{map[string]any{"value": 3}},
+	}
+	doc["membership_plans"] = []any{map[string]any{"name": "socio", "value": 50, "currency": "EUR", "billing_interval": "yearly"}}
+	doc["location"].(map[string]any)["areas"] = []any{map[string]any{"name": "sala", "square_meters": 80}}
+
+	if err := Validate(doc); err != nil {
+		t.Fatalf("full document rejected: %v", err)
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	for name, mutate := range map[string]func(map[string]any){
+		"missing contact":     func(d map[string]any) { delete(d, "contact") },
+		"wrong compatibility": func(d map[string]any) { d["api_compatibility"] = []any{"14"} },
+		"icon without closed": func(d map[string]any) { d["state"] = map[string]any{"icon": map[string]any{"open": "x"}} },
+		"bad currency": func(d map[string]any) {
+			d["membership_plans"] = []any{map[string]any{"name": "x", "value": 1, "currency": "euro", "billing_interval": "yearly"}}
+		},
+		"bad billing interval": func(d map[string]any) {
+			d["membership_plans"] = []any{map[string]any{"name": "x", "value": 1, "currency": "EUR", "billing_interval": "annually"}}
+		},
+		"feed without url": func(d map[string]any) { d["feeds"] = map[string]any{"blog": map[string]any{"type": "rss"}} },
+		"temperature bad unit": func(d map[string]any) {
+			d["sensors"] = map[string]any{"temperature": []any{map[string]any{"value": 1, "unit": "C", "location": "x"}}}
+		},
+		"negative people count": func(d map[string]any) {
+			d["sensors"] = map[string]any{"people_now_present": []any{map[string]any{"value": -1}}}
+		},
+		"area without size": func(d map[string]any) { d["location"].(map[string]any)["areas"] = []any{map[string]any{"name": "x"}} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			doc := decode(t, minimalDoc)
+			mutate(doc)
+			err := Validate(doc)
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			if !strings.Contains(err.Error(), "spaceapi v15") {
+				t.Errorf("error not labelled: %v", err)
+			}
+		})
+	}
+}
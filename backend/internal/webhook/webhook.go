@@ -0,0 +1,251 @@
+// Package webhook delivers status-change events to the outgoing webhooks
+// declared per space in spaces.yaml. Deliveries are read from the
+// webhook_deliveries outbox table, signed with the target's secret and
+// retried with exponential backoff until they succeed or run out of attempts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex>" over "<timestamp>.<body>".
+	SignatureHeader = "X-Sede-Signature"
+	TimestampHeader = "X-Sede-Timestamp"
+	EventHeader     = "X-Sede-Event"
+	DeliveryHeader  = "X-Sede-Delivery"
+
+	defaultPollInterval = 10 * time.Second
+	defaultBatchSize    = 50
+	defaultMaxAttempts  = 10
+	defaultBaseBackoff  = 30 * time.Second
+	defaultMaxBackoff   = time.Hour
+	requestTimeout      = 10 * time.Second
+	// claimLease is how long a claimed delivery is kept from the other
+	// replicas; past it, an attempt that never recorded its outcome is
+	// retried.
+	claimLease        = 3 * requestTimeout
+	maxErrorBodyBytes = 512
+)
+
+// Target mirrors the JSON stored in database.Space.Webhooks.
+type Target struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+// Receivers recompute it and compare in constant time; binding the timestamp
+// lets them reject replays older than a tolerance of their choosing.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Worker drains the outbox. A single worker per instance is enough for the
+// volume a handful of spaces generate; it processes deliveries sequentially.
+type Worker struct {
+	repo   *database.Repository
+	client *http.Client
+	kick   chan struct{}
+	now    func() time.Time
+
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+func NewWorker(repo *database.Repository) *Worker {
+	return &Worker{
+		repo:         repo,
+		client:       &http.Client{Timeout: requestTimeout},
+		kick:         make(chan struct{}, 1),
+		now:          time.Now,
+		PollInterval: defaultPollInterval,
+		MaxAttempts:  defaultMaxAttempts,
+		BaseBackoff:  defaultBaseBackoff,
+		MaxBackoff:   defaultMaxBackoff,
+	}
+}
+
+// Kick wakes the worker so freshly enqueued deliveries go out immediately
+// instead of waiting for the next poll. Never blocks.
+func (w *Worker) Kick() {
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		w.ProcessDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.kick:
+		}
+	}
+}
+
+// ProcessDue attempts every delivery that is currently due.
+func (w *Worker) ProcessDue(ctx context.Context) {
+	deliveries, err := w.repo.DueWebhookDeliveries(ctx, w.now().UTC(), defaultBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "webhook: load due deliveries", "error", err)
+		}
+		return
+	}
+
+	targets := make(map[uint][]Target)
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		ts, ok := targets[d.SpaceID]
+		if !ok {
+			ts, err = w.loadTargets(ctx, d.SpaceID)
+			if err != nil {
+				slog.ErrorContext(ctx, "webhook: load targets", "space_id", d.SpaceID, "error", err)
+				continue
+			}
+			targets[d.SpaceID] = ts
+		}
+		w.attempt(ctx, d, ts)
+	}
+}
+
+func (w *Worker) loadTargets(ctx context.Context, spaceID uint) ([]Target, error) {
+	sp, err := w.repo.GetSpaceByID(ctx, spaceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Space deleted: no targets, so its pending deliveries are abandoned.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ts []Target
+	if sp.Webhooks != "" {
+		if err := json.Unmarshal([]byte(sp.Webhooks), &ts); err != nil {
+			return nil, fmt.Errorf("decode webhooks: %w", err)
+		}
+	}
+	return ts, nil
+}
+
+func (w *Worker) attempt(ctx context.Context, d database.WebhookDelivery, targets []Target) {
+	now := w.now().UTC()
+
+	claimed, err := w.repo.ClaimWebhookDelivery(ctx, d, now, now.Add(claimLease))
+	if err != nil {
+		slog.ErrorContext(ctx, "webhook: claim delivery", "delivery_id", d.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return // another replica got it
+	}
+
+	// The secret is looked up at send time rather than stored in the
+	// outbox, so a rotated secret applies to pending retries too. A target
+	// removed from spaces.yaml abandons its pending deliveries.
+	secret, ok := "", false
+	for _, t := range targets {
+		if t.URL == d.URL {
+			secret, ok = t.Secret, true
+			break
+		}
+	}
+	if !ok {
+		w.record(ctx, w.repo.MarkWebhookFailed(ctx, d.ID, now, "webhook no longer configured"))
+		return
+	}
+
+	sendErr := w.send(ctx, d, secret, now)
+	if sendErr == nil {
+		w.record(ctx, w.repo.MarkWebhookDelivered(ctx, d.ID, now))
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	attempts := d.Attempts + 1
+	if attempts >= w.MaxAttempts {
+		slog.WarnContext(ctx, "webhook: delivery abandoned", "delivery_id", d.ID, "url", d.URL, "attempts", attempts, "error", sendErr)
+		w.record(ctx, w.repo.MarkWebhookFailed(ctx, d.ID, now, sendErr.Error()))
+		return
+	}
+	w.record(ctx, w.repo.MarkWebhookRetry(ctx, d.ID, now.Add(w.backoff(attempts)), sendErr.Error()))
+}
+
+func (w *Worker) send(ctx context.Context, d database.WebhookDelivery, secret string, now time.Time) error {
+	body := []byte(d.Payload)
+	ts := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sede-webhook/1")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(secret, ts, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// backoff returns BaseBackoff doubled for every attempt already made,
+// capped at MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= w.MaxBackoff {
+			return w.MaxBackoff
+		}
+	}
+	return d
+}
+
+func (w *Worker) record(ctx context.Context, err error) {
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "webhook: update delivery", "error", err)
+	}
+}
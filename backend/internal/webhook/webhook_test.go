@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metro-olografix/sede/internal/config"
+	"github.com/metro-olografix/sede/internal/database"
+)
+
+func setupRepo(t *testing.T) *database.Repository {
+	t.Helper()
+	repo, err := database.New(config.Config{DatabasePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("database.New: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := repo.Db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return repo
+}
+
+func seedSpaceWithTargets(t *testing.T, repo *database.Repository, targets []Target) uint {
+	t.Helper()
+	raw, _ := json.Marshal(targets)
+	sp, err := repo.UpsertSpace(context.Background(), database.Space{
+		Slug:       "pescara",
+		Name:       "Pescara",
+		APIKeyHash: []byte("hash"),
+		Webhooks:   string(raw),
+	})
+	if err != nil {
+		t.Fatalf("seed space: %v", err)
+	}
+	return sp.ID
+}
+
+func enqueue(t *testing.T, repo *database.Repository, spaceID uint, url string, at time.Time) uint {
+	t.Helper()
+	d := []database.WebhookDelivery{{
+		SpaceID:       spaceID,
+		URL:           url,
+		Event:         "status.changed",
+		Payload:       `{"event":"status.changed","open":true}`,
+		NextAttemptAt: at,
+	}}
+	if err := repo.EnqueueWebhookDeliveries(context.Background(), d); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return d[0].ID
+}
+
+func loadDelivery(t *testing.T, repo *database.Repository, id uint) database.WebhookDelivery {
+	t.Helper()
+	var d database.WebhookDelivery
+	if err := repo.Db.First(&d, id).Error; err != nil {
+		t.Fatalf("load delivery %d: %v", id, err)
+	}
+	return d
+}
+
+func TestSign_KnownVector(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	got := Sign("secret", 1700000000, []byte(`{"a":1}`))
+	if want := "49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"; got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	if got == Sign("secret", 1700000001, []byte(`{"a":1}`)) {
+		t.Error("signature must bind the timestamp")
+	}
+	if got == Sign("other", 1700000000, []byte(`{"a":1}`)) {
+		t.Error("signature must depend on the secret")
+	}
+}
+
+func TestWorker_DeliversSignedPayload(t *testing.T) {
+	repo := setupRepo(t)
+
+	var gotSig, gotTS, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get(SignatureHeader)
+		gotTS = r.Header.Get(TimestampHeader)
+		gotEvent = r.Header.Get(EventHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	spaceID := seedSpaceWithTargets(t, repo, []Target{{URL: srv.URL, Secret: "hook-secret"}})
+	id := enqueue(t, repo, spaceID, srv.URL, time.Now().UTC())
+
+	NewWorker(repo).ProcessDue(context.Background())
+
+	ts, err := strconv.ParseInt(gotTS, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header %q: %v", gotTS, err)
+	}
+	if want := "sha256=" + Sign("hook-secret", ts, gotBody); gotSig != want {
+		t.Errorf("signature %q, want %q", gotSig, want)
+	}
+	if gotEvent != "status.changed" {
+		t.Errorf("event header %q", gotEvent)
+	}
+
+	d := loadDelivery(t, repo, id)
+	if d.DeliveredAt == nil || d.Attempts != 1 || d.FailedAt != nil {
+		t.Errorf("delivery not marked delivered: %+v", d)
+	}
+}
+
+func TestWorker_SkipsDeliveriesClaimedElsewhere(t *testing.T) {
+	repo := setupRepo(t)
+	ctx := context.Background()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	spaceID := seedSpaceWithTargets(t, repo, []Target{{URL: srv.URL, Secret: "s"}})
+	now := time.Now().UTC()
+	id := enqueue(t, repo, spaceID, srv.URL, now.Add(-time.Second))
+
+	// Two replicas load the same batch; the first claims the delivery.
+	due, err := repo.DueWebhookDeliveries(ctx, now, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("due: %v %v", due, err)
+	}
+	if ok, err := repo.ClaimWebhookDelivery(ctx, due[0], now, now.Add(claimLease)); !ok || err != nil {
+		t.Fatalf("first claim: %v %v", ok, err)
+	}
+	w := NewWorker(repo)
+	w.now = func() time.Time { return now }
+	w.attempt(ctx, due[0], []Target{{URL: srv.URL, Secret: "s"}})
+	w.ProcessDue(ctx)
+
+	if n := hits.Load(); n != 0 {
+		t.Errorf("delivery claimed by another replica was sent %d times", n)
+	}
+	if d := loadDelivery(t, repo, id); d.Attempts != 0 || !d.NextAttemptAt.After(now) {
+		t.Errorf("claimed delivery touched: %+v", d)
+	}
+}
+
+func TestWorker_RetriesWithBackoffThenGivesUp(t *testing.T) {
+	repo := setupRepo(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	spaceID := seedSpaceWithTargets(t, repo, []Target{{URL: srv.URL, Secret: "s"}})
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	id := enqueue(t, repo, spaceID, srv.URL, start)
+
+	w := NewWorker(repo)
+	w.MaxAttempts = 3
+	w.BaseBackoff = time.Minute
+	clock := start
+	w.now = func() time.Time { return clock }
+
+	w.ProcessDue(context.Background())
+	d := loadDelivery(t, repo, id)
+	if d.Attempts != 1 || !d.NextAttemptAt.Equal(start.Add(time.Minute)) || d.LastError == "" {
+		t.Fatalf("after 1st failure: %+v", d)
+	}
+
+	// Not yet due: nothing is sent.
+	w.ProcessDue(context.Background())
+	if hits.Load() != 1 {
+		t.Fatalf("retried before backoff elapsed: %d hits", hits.Load())
+	}
+
+	clock = start.Add(time.Minute)
+	w.ProcessDue(context.Background())
+	d = loadDelivery(t, repo, id)
+	if d.Attempts != 2 || !d.NextAttemptAt.Equal(clock.Add(2*time.Minute)) {
+		t.Fatalf("after 2nd failure: %+v", d)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	w.ProcessDue(context.Background())
+	d = loadDelivery(t, repo, id)
+	if d.Attempts != 3 || d.FailedAt == nil || d.DeliveredAt != nil {
+		t.Fatalf("expected abandoned after MaxAttempts: %+v", d)
+	}
+
+	clock = clock.Add(time.Hour)
+	w.ProcessDue(context.Background())
+	if hits.Load() != 3 {
+		t.Errorf("abandoned delivery was retried: %d hits", hits.Load())
+	}
+}
+
+func TestWorker_AbandonsRemovedTarget(t *testing.T) {
+	repo := setupRepo(t)
+	spaceID := seedSpaceWithTargets(t, repo, nil)
+	id := enqueue(t, repo, spaceID, "https://gone.example/hook", time.Now().UTC())
+
+	NewWorker(repo).ProcessDue(context.Background())
+
+	d := loadDelivery(t, repo, id)
+	if d.FailedAt == nil || d.LastError != "webhook no longer configured" {
+		t.Errorf("expected abandoned delivery: %+v", d)
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	w := NewWorker(nil)
+	w.BaseBackoff = 30 * time.Second
+	w.MaxBackoff = 5 * time.Minute
+	for _, c := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{20, 5 * time.Minute},
+	} {
+		if got := w.backoff(c.attempts); got != c.want {
+			t.Errorf("backoff(%d) = %s, want %s", c.attempts, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package ui embeds the static web pages served under /ui: the opening
+// heatmap and the admin dashboard.
+package ui
+
+import "embed"
+
+// FS holds the pages, at its root.
+//
+//go:embed *.html
+var FS embed.FS